@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/policy"
+	"github.com/sing3demons/users/repository"
+	"github.com/sing3demons/users/security"
+	log "github.com/sirupsen/logrus"
+)
+
+// registerOAuthClients upserts the clients listed in OAUTH_CLIENTS_FILE, a
+// JSON array of model.OAuthClient, so they can be managed as configuration.
+func registerOAuthClients(repo repository.IOAuthClientRepository) {
+	file := os.Getenv("OAUTH_CLIENTS_FILE")
+	if file == "" {
+		return
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+			"func":  "registerOAuthClients",
+			"file":  "bootstrap.go",
+			"tag":   "error",
+		}).Fatal("read oauth clients error")
+	}
+
+	var clients []model.OAuthClient
+	if err := json.Unmarshal(b, &clients); err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+			"func":  "registerOAuthClients",
+			"file":  "bootstrap.go",
+			"tag":   "error",
+		}).Fatal("parse oauth clients error")
+	}
+
+	for _, client := range clients {
+		if client.Secret != "" {
+			hash, err := security.EncryptPassword(client.Secret)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error":    err.Error(),
+					"func":     "registerOAuthClients",
+					"file":     "bootstrap.go",
+					"tag":      "error",
+					"clientId": client.ClientID,
+				}).Fatal("hash oauth client secret error")
+			}
+			client.SecretHash = hash
+		}
+
+		if err := repo.Upsert("bootstrap", client); err != nil {
+			log.WithFields(log.Fields{
+				"error":    err.Error(),
+				"func":     "registerOAuthClients",
+				"file":     "bootstrap.go",
+				"tag":      "error",
+				"clientId": client.ClientID,
+			}).Fatal("register oauth client error")
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"func":    "registerOAuthClients",
+		"file":    "bootstrap.go",
+		"clients": len(clients),
+	}).Info("oauth clients registered")
+}
+
+// bootstrapAdmin makes BOOTSTRAP_ADMIN_EMAIL an admin, creating the account
+// with BOOTSTRAP_ADMIN_PASSWORD if it does not exist yet. An existing account
+// is only promoted once its email is verified, so registering the address
+// first does not make a stranger admin. It is idempotent, so the variables
+// can stay set, but should be removed once real admins exist.
+func bootstrapAdmin(repo repository.IUserRepository) {
+	email := strings.TrimSpace(os.Getenv("BOOTSTRAP_ADMIN_EMAIL"))
+	if email == "" {
+		return
+	}
+
+	fields := log.Fields{
+		"func": "bootstrapAdmin",
+		"file": "bootstrap.go",
+		"tag":  "bootstrap",
+	}
+
+	user, err := repo.FindByIdentifier("bootstrap", email)
+	if err == nil {
+		if user.RoleName() == model.RoleAdmin {
+			return
+		}
+		if user.EmailVerifiedAt == nil {
+			log.WithFields(fields).Error("bootstrap admin not promoted: the existing account's email is not verified")
+			return
+		}
+		if _, err := repo.SetRole("bootstrap", user.ID.Hex(), model.RoleAdmin); err != nil {
+			log.WithFields(fields).WithError(err).Error("promote bootstrap admin error")
+			os.Exit(1)
+		}
+		log.WithFields(fields).Info("bootstrap admin promoted")
+		return
+	}
+
+	password := os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+	if password == "" {
+		log.WithFields(fields).Error("BOOTSTRAP_ADMIN_PASSWORD is required to create the bootstrap admin")
+		os.Exit(1)
+	}
+	if err := security.ValidatePassword(password, email); err != nil {
+		log.WithFields(fields).WithError(err).Error("bootstrap admin password rejected")
+		os.Exit(1)
+	}
+
+	hash, err := security.EncryptPassword(password)
+	if err != nil {
+		log.WithFields(fields).WithError(err).Error("hash bootstrap admin password error")
+		os.Exit(1)
+	}
+
+	now := time.Now()
+	if _, err := repo.CreateUser("bootstrap", model.User{
+		Email:           email,
+		Password:        hash,
+		Type:            "users",
+		Status:          model.UserStatusActive,
+		Role:            model.RoleAdmin,
+		EmailVerifiedAt: &now,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}); err != nil {
+		log.WithFields(fields).WithError(err).Error("create bootstrap admin error")
+		os.Exit(1)
+	}
+
+	log.WithFields(fields).Info("bootstrap admin created")
+}
+
+// loadPolicyEngine reads the ABAC policies from POLICY_FILE (YAML, or JSON
+// by extension), falling back to policy.Default. POLICY_MODE overrides the
+// file's mode, e.g. POLICY_MODE=dry_run to trial new policies.
+func loadPolicyEngine() policy.IEngine {
+	fields := log.Fields{
+		"func": "loadPolicyEngine",
+		"file": "bootstrap.go",
+		"tag":  "bootstrap",
+	}
+
+	doc := policy.Default()
+	if file := os.Getenv("POLICY_FILE"); file != "" {
+		loaded, err := policy.LoadFile(file)
+		if err != nil {
+			log.WithFields(fields).WithError(err).Error("read policy file error")
+			os.Exit(1)
+		}
+		doc = loaded
+	}
+	if mode := os.Getenv("POLICY_MODE"); mode != "" {
+		doc.Mode = mode
+	}
+
+	engine, err := policy.NewEngine(doc)
+	if err != nil {
+		log.WithFields(fields).WithError(err).Error("invalid policies")
+		os.Exit(1)
+	}
+
+	log.WithFields(fields).WithFields(log.Fields{
+		"policies": len(doc.Policies),
+		"dryRun":   engine.DryRun(),
+	}).Info("policies loaded")
+
+	return engine
+}
@@ -2,5 +2,6 @@ package constant
 
 const (
 	XSessionId = "X-Session-Id"
+	XAPIKey    = "X-API-Key"
 	BEARER	 = "Bearer "
 )
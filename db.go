@@ -11,7 +11,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-func NewDatabase(dbName, collectionName string) *mongo.Collection {
+func NewDatabase(dbName string) *mongo.Database {
 
 	dsn := os.Getenv("MONGO_URI")
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
@@ -20,39 +20,36 @@ func NewDatabase(dbName, collectionName string) *mongo.Collection {
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(dsn))
 	if err != nil {
 		log.WithFields(log.Fields{
-			"error":          err.Error(),
-			"type":           "database",
-			"func":           "NewDatabase",
-			"file":           "db.go",
-			"tag":            "error",
-			"host":           dsn,
-			"dbName":         dbName,
-			"collectionName": collectionName,
+			"error":  err.Error(),
+			"type":   "database",
+			"func":   "NewDatabase",
+			"file":   "db.go",
+			"tag":    "error",
+			"host":   dsn,
+			"dbName": dbName,
 		}).Error("error connecting to database")
 		os.Exit(1)
 	}
 
 	if err := client.Ping(ctx, readpref.Primary()); err != nil {
 		log.WithFields(log.Fields{
-			"error":          err.Error(),
-			"type":           "database",
-			"func":           "NewDatabase",
-			"file":           "db.go",
-			"tag":            "error",
-			"host":           dsn,
-			"dbName":         dbName,
-			"collectionName": collectionName,
+			"error":  err.Error(),
+			"type":   "database",
+			"func":   "NewDatabase",
+			"file":   "db.go",
+			"tag":    "error",
+			"host":   dsn,
+			"dbName": dbName,
 		}).Error("error connecting to database")
 		os.Exit(1)
 	}
 
 	log.WithFields(log.Fields{
-		"type":           "database",
-		"host":           dsn,
-		"dbName":         dbName,
-		"collectionName": collectionName,
-		"status":         "OK",
+		"type":   "database",
+		"host":   dsn,
+		"dbName": dbName,
+		"status": "OK",
 	}).Info("connected to database")
 
-	return client.Database(dbName).Collection(collectionName)
+	return client.Database(dbName)
 }
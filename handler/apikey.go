@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sing3demons/users/middleware"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/security"
+	"github.com/sing3demons/users/service"
+	logger "github.com/sirupsen/logrus"
+)
+
+type IAPIKeyHandler interface {
+	Create(c router.IContext)
+	List(c router.IContext)
+	Revoke(c router.IContext)
+}
+
+type apiKeyHandler struct {
+	service service.IAPIKeyService
+}
+
+func NewAPIKeyHandler(service service.IAPIKeyService) IAPIKeyHandler {
+	return &apiKeyHandler{service: service}
+}
+
+// Create needs an interactive session; an API key cannot mint more keys.
+func (a *apiKeyHandler) Create(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	if method, _ := c.Get("authMethod"); method == middleware.AuthMethodAPIKey {
+		c.JSON(403, gin.H{
+			"message": "api keys cannot create api keys",
+		})
+		return
+	}
+
+	var body model.CreateAPIKeyRequest
+	if err := c.ReadBodyJSON(&body); err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if value, ok := c.Get("claims"); ok {
+		if claims, ok := value.(jwt.MapClaims); ok {
+			body.Granted = security.ClaimScopes(claims)
+		}
+	}
+
+	key, err := a.service.Create(sessionId, userId.(string), body)
+	if err != nil {
+		a.error(c, "Create", err)
+		return
+	}
+
+	c.JSON(201, gin.H{
+		"message": "success",
+		"data":    key,
+	})
+}
+
+func (a *apiKeyHandler) List(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	keys, err := a.service.List(sessionId, userId.(string))
+	if err != nil {
+		a.error(c, "List", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+		"data":    keys,
+	})
+}
+
+func (a *apiKeyHandler) Revoke(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	if err := a.service.Revoke(sessionId, userId.(string), c.Param("id")); err != nil {
+		a.error(c, "Revoke", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+func (a *apiKeyHandler) error(c router.IContext, fn string, err error) {
+	logger.WithFields(logger.Fields{
+		"uuid":  c.GetSessionId(),
+		"error": err.Error(),
+		"type":  "handler",
+		"func":  fn,
+		"file":  "apiKeyHandler",
+		"tag":   "error",
+	}).Error("API_KEY")
+
+	switch {
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		c.JSON(404, gin.H{
+			"message": err.Error(),
+		})
+	case errors.Is(err, service.ErrTooManyAPIKeys):
+		c.JSON(409, gin.H{
+			"message": err.Error(),
+		})
+	default:
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/service"
+	logger "github.com/sirupsen/logrus"
+)
+
+type ILockoutHandler interface {
+	Unlock(c router.IContext)
+}
+
+type lockoutHandler struct {
+	service service.ILockoutService
+}
+
+func NewLockoutHandler(service service.ILockoutService) ILockoutHandler {
+	return &lockoutHandler{service: service}
+}
+
+func (l *lockoutHandler) Unlock(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, _ := c.Get("userId")
+	actorId, _ := userId.(string)
+
+	var body model.UnlockRequest
+	if err := c.ReadBodyJSON(&body); err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := l.service.Unlock(sessionId, actorId, body); err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  sessionId,
+			"error": err.Error(),
+			"type":  "handler",
+			"func":  "Unlock",
+			"file":  "lockoutHandler",
+			"tag":   "error",
+		}).Error("UNLOCK")
+
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+// clientIP is the caller address as resolved by router.GetHeaders: the peer
+// address, or X-Forwarded-For when the peer is in TRUSTED_PROXIES.
+func clientIP(c router.IContext) string {
+	ip, _ := c.GetHeaders()["client_ip"].(string)
+	return ip
+}
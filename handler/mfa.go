@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/service"
+	logger "github.com/sirupsen/logrus"
+)
+
+type IMFAHandler interface {
+	EnrollTOTP(c router.IContext)
+	ConfirmTOTP(c router.IContext)
+	DisableTOTP(c router.IContext)
+	Verify(c router.IContext)
+}
+
+type mfaHandler struct {
+	service service.IMFAService
+}
+
+func NewMFAHandler(service service.IMFAService) IMFAHandler {
+	return &mfaHandler{service: service}
+}
+
+func (m *mfaHandler) EnrollTOTP(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	enrollment, err := m.service.EnrollTOTP(sessionId, userId.(string))
+	if err != nil {
+		m.error(c, "EnrollTOTP", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+		"secret":  enrollment.Secret,
+		"uri":     enrollment.URI,
+	})
+}
+
+func (m *mfaHandler) ConfirmTOTP(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	var body model.MFACode
+	if err := c.ReadBodyJSON(&body); err != nil || body.Code == "" {
+		c.JSON(400, gin.H{
+			"message": "code is required",
+		})
+		return
+	}
+
+	codes, err := m.service.ConfirmTOTP(sessionId, userId.(string), body.Code)
+	if err != nil {
+		m.error(c, "ConfirmTOTP", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":        "success",
+		"recovery_codes": codes,
+	})
+}
+
+func (m *mfaHandler) DisableTOTP(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	var body model.MFACode
+	if err := c.ReadBodyJSON(&body); err != nil || body.Code == "" {
+		c.JSON(400, gin.H{
+			"message": "code is required",
+		})
+		return
+	}
+
+	if err := m.service.DisableTOTP(sessionId, userId.(string), body.Code); err != nil {
+		m.error(c, "DisableTOTP", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+func (m *mfaHandler) Verify(c router.IContext) {
+	sessionId := c.GetSessionId()
+
+	var body model.MFAVerifyRequest
+	if err := c.ReadBodyJSON(&body); err != nil || body.MFAToken == "" || (body.Code == "" && body.RecoveryCode == "") {
+		c.JSON(400, gin.H{
+			"message": "mfa_token and code or recovery_code are required",
+		})
+		return
+	}
+	body.Device = device(c)
+
+	token, err := m.service.Verify(sessionId, body)
+	if err != nil {
+		m.error(c, "Verify", err)
+		return
+	}
+
+	c.JSON(200, tokenResponse(token))
+}
+
+func (m *mfaHandler) error(c router.IContext, fn string, err error) {
+	logger.WithFields(logger.Fields{
+		"uuid":  c.GetSessionId(),
+		"error": err.Error(),
+		"type":  "handler",
+		"func":  fn,
+		"file":  "mfaHandler",
+		"tag":   "error",
+	}).Error("MFA")
+
+	switch {
+	case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, service.ErrInvalidMFAToken):
+		c.JSON(401, gin.H{
+			"message": err.Error(),
+		})
+	case errors.Is(err, service.ErrMFANotEnrolled), errors.Is(err, service.ErrMFAAlreadyActive):
+		c.JSON(409, gin.H{
+			"message": err.Error(),
+		})
+	default:
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/service"
+	logger "github.com/sirupsen/logrus"
+)
+
+type IOAuthHandler interface {
+	Authorize(c router.IContext)
+	AuthorizeLogin(c router.IContext)
+	Token(c router.IContext)
+}
+
+type oauthHandler struct {
+	service service.IOAuthService
+}
+
+func NewOAuthHandler(service service.IOAuthService) IOAuthHandler {
+	return &oauthHandler{service: service}
+}
+
+// Authorize validates the request and sends the browser to the hosted login
+// page (OAUTH_LOGIN_URL), which posts the credentials back to AuthorizeLogin.
+func (o *oauthHandler) Authorize(c router.IContext) {
+	sessionId := c.GetSessionId()
+	req := model.AuthorizeRequest{
+		ResponseType:        c.QueryString("response_type"),
+		ClientID:            c.QueryString("client_id"),
+		RedirectURI:         c.QueryString("redirect_uri"),
+		Scope:               c.QueryString("scope"),
+		State:               c.QueryString("state"),
+		Nonce:               c.QueryString("nonce"),
+		CodeChallenge:       c.QueryString("code_challenge"),
+		CodeChallengeMethod: c.QueryString("code_challenge_method"),
+	}
+
+	redirectURI, err := o.service.ValidateAuthorize(sessionId, req)
+	if err != nil {
+		o.authorizeError(c, req, redirectURI, err)
+		return
+	}
+
+	loginURL := os.Getenv("OAUTH_LOGIN_URL")
+	if loginURL == "" {
+		c.JSON(500, gin.H{
+			"message": "login page not configured",
+		})
+		return
+	}
+
+	c.Redirect(302, service.AuthorizeRedirect(loginURL, authorizeParams(req), ""))
+}
+
+func (o *oauthHandler) AuthorizeLogin(c router.IContext) {
+	sessionId := c.GetSessionId()
+	var body model.AuthorizeLogin
+
+	if err := c.Body(&body); err != nil {
+		c.JSON(400, gin.H{
+			"error":             "invalid_request",
+			"error_description": err.Error(),
+		})
+		return
+	}
+
+	redirectURI, err := o.service.ValidateAuthorize(sessionId, body.AuthorizeRequest)
+	if err != nil {
+		var oauthErr *service.OAuthError
+		if redirectURI != "" && errors.As(err, &oauthErr) {
+			c.JSON(400, gin.H{
+				"error":             oauthErr.Code,
+				"error_description": oauthErr.Description,
+				"redirect_to":       service.AuthorizeRedirect(redirectURI, url.Values{"error": {oauthErr.Code}, "error_description": {oauthErr.Description}}, body.State),
+			})
+			return
+		}
+
+		writeOAuthError(c, err)
+		return
+	}
+
+	body.ClientIP = clientIP(c)
+
+	location, err := o.service.Authorize(sessionId, body)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":     sessionId,
+			"error":    err.Error(),
+			"type":     "handler",
+			"func":     "AuthorizeLogin",
+			"file":     "oauthHandler",
+			"tag":      "error",
+			"clientId": body.ClientID,
+		}).Error("OAUTH_AUTHORIZE")
+
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			c.JSON(401, gin.H{
+				"error":             "access_denied",
+				"error_description": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			c.JSON(403, gin.H{
+				"error":             "email_not_verified",
+				"error_description": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, service.ErrMFARequired) {
+			c.JSON(401, gin.H{
+				"error":             "mfa_required",
+				"error_description": err.Error(),
+			})
+			return
+		}
+
+		writeOAuthError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"redirect_to": location,
+	})
+}
+
+func (o *oauthHandler) Token(c router.IContext) {
+	sessionId := c.GetSessionId()
+	c.SetHeader("Cache-Control", "no-store")
+	c.SetHeader("Pragma", "no-cache")
+
+	var body model.TokenRequest
+	if err := c.Body(&body); err != nil {
+		c.JSON(400, gin.H{
+			"error":             "invalid_request",
+			"error_description": err.Error(),
+		})
+		return
+	}
+	body.Device = device(c)
+
+	// client_secret_basic takes precedence over credentials in the body.
+	if clientId, clientSecret, ok := parseBasicAuth(c.GetAuthorization()); ok {
+		body.ClientID = clientId
+		body.ClientSecret = clientSecret
+	}
+
+	token, err := o.service.Token(sessionId, body)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":      sessionId,
+			"error":     err.Error(),
+			"type":      "handler",
+			"func":      "Token",
+			"file":      "oauthHandler",
+			"tag":       "error",
+			"grantType": body.GrantType,
+			"clientId":  body.ClientID,
+		}).Error("OAUTH_TOKEN")
+
+		writeOAuthError(c, err)
+		return
+	}
+
+	c.JSON(200, token)
+}
+
+func (o *oauthHandler) authorizeError(c router.IContext, req model.AuthorizeRequest, redirectURI string, err error) {
+	var oauthErr *service.OAuthError
+	if redirectURI == "" || !errors.As(err, &oauthErr) {
+		writeOAuthError(c, err)
+		return
+	}
+
+	c.Redirect(302, service.AuthorizeRedirect(redirectURI, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+	}, req.State))
+}
+
+func writeOAuthError(c router.IContext, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		c.JSON(500, gin.H{
+			"error":             "server_error",
+			"error_description": err.Error(),
+		})
+		return
+	}
+
+	status := 400
+	if oauthErr.Code == "invalid_client" {
+		status = 401
+	}
+	c.JSON(status, oauthErr)
+}
+
+// parseBasicAuth decodes client_secret_basic credentials, which RFC 6749
+// requires to be form-urlencoded before base64 encoding.
+func parseBasicAuth(header string) (string, string, bool) {
+	const prefix = "Basic "
+	if !strings.HasPrefix(header, prefix) {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, prefix))
+	if err != nil {
+		return "", "", false
+	}
+
+	id, secret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+
+	id, err = url.QueryUnescape(id)
+	if err != nil {
+		return "", "", false
+	}
+	secret, err = url.QueryUnescape(secret)
+	if err != nil {
+		return "", "", false
+	}
+
+	return id, secret, true
+}
+
+func authorizeParams(req model.AuthorizeRequest) url.Values {
+	params := url.Values{}
+	for key, value := range map[string]string{
+		"response_type":         req.ResponseType,
+		"client_id":             req.ClientID,
+		"redirect_uri":          req.RedirectURI,
+		"scope":                 req.Scope,
+		"state":                 req.State,
+		"nonce":                 req.Nonce,
+		"code_challenge":        req.CodeChallenge,
+		"code_challenge_method": req.CodeChallengeMethod,
+	} {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+	return params
+}
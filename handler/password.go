@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/security"
+	"github.com/sing3demons/users/service"
+	logger "github.com/sirupsen/logrus"
+)
+
+type IPasswordHandler interface {
+	Forgot(c router.IContext)
+	Reset(c router.IContext)
+	Change(c router.IContext)
+}
+
+type passwordHandler struct {
+	service service.IPasswordService
+}
+
+func NewPasswordHandler(service service.IPasswordService) IPasswordHandler {
+	return &passwordHandler{service: service}
+}
+
+func (p *passwordHandler) Forgot(c router.IContext) {
+	sessionId := c.GetSessionId()
+
+	var body model.ForgotPasswordRequest
+	if err := c.ReadBodyJSON(&body); err != nil || body.Email == "" {
+		c.JSON(400, gin.H{
+			"message": "email is required",
+		})
+		return
+	}
+
+	p.service.Forgot(sessionId, body)
+
+	c.JSON(200, gin.H{
+		"message": "if the account exists, a reset link has been sent",
+	})
+}
+
+func (p *passwordHandler) Reset(c router.IContext) {
+	sessionId := c.GetSessionId()
+
+	var body model.ResetPasswordRequest
+	if err := c.ReadBodyJSON(&body); err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := p.service.Reset(sessionId, body); err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  sessionId,
+			"error": err.Error(),
+			"type":  "handler",
+			"func":  "Reset",
+			"file":  "passwordHandler",
+			"tag":   "error",
+		}).Error("RESET_PASSWORD")
+
+		if writePolicyError(c, err) {
+			return
+		}
+
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+func (p *passwordHandler) Change(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	var body model.ChangePasswordRequest
+	if err := c.ReadBodyJSON(&body); err != nil || body.CurrentPassword == "" || body.NewPassword == "" {
+		c.JSON(400, gin.H{
+			"message": "current_password and new_password are required",
+		})
+		return
+	}
+	body.Device = device(c)
+
+	var scopes []string
+	if claims, ok := c.Get("claims"); ok {
+		if mapClaims, ok := claims.(jwt.MapClaims); ok {
+			scope, _ := mapClaims["scope"].(string)
+			scopes = security.ParseScope(scope)
+		}
+	}
+
+	token, err := p.service.Change(sessionId, userId.(string), scopes, body)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  sessionId,
+			"error": err.Error(),
+			"type":  "handler",
+			"func":  "Change",
+			"file":  "passwordHandler",
+			"tag":   "error",
+		}).Error("CHANGE_PASSWORD")
+
+		if writePolicyError(c, err) {
+			return
+		}
+
+		if errors.Is(err, service.ErrInvalidCurrentPassword) {
+			c.JSON(403, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, tokenResponse(token))
+}
+
+// writePolicyError answers with one entry per broken rule when err is a
+// password policy failure, and reports whether it did.
+func writePolicyError(c router.IContext, err error) bool {
+	var policyErr *security.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	c.JSON(400, gin.H{
+		"message": "password does not meet policy",
+		"error":   "invalid_password",
+		"errors":  policyErr.Violations,
+	})
+	return true
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/users/middleware"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/policy"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/service"
+	logger "github.com/sirupsen/logrus"
+)
+
+type IPolicyHandler interface {
+	Explain(c router.IContext)
+}
+
+type policyHandler struct {
+	engine policy.IEngine
+	users  service.IUserService
+}
+
+func NewPolicyHandler(engine policy.IEngine, users service.IUserService) IPolicyHandler {
+	return &policyHandler{engine: engine, users: users}
+}
+
+// Explain evaluates a hypothetical request and returns the full decision
+// trace, whatever the engine's explain setting, to debug unexpected denies.
+func (p *policyHandler) Explain(c router.IContext) {
+	sessionId := c.GetSessionId()
+
+	var body model.ExplainPolicyRequest
+	if err := c.ReadBodyJSON(&body); err != nil || body.Action == "" {
+		c.JSON(400, gin.H{
+			"message": "action is required",
+		})
+		return
+	}
+
+	input := middleware.PolicyInput(c, p.engine, body.Action)
+	if body.Subject != nil {
+		input.Subject = body.Subject
+	}
+	for k, v := range body.Request {
+		input.Request[k] = v
+	}
+
+	switch {
+	case body.Resource != nil:
+		input.Resource = body.Resource
+	case body.UserID != "":
+		user, err := p.users.GetProfile(sessionId, body.UserID)
+		if err != nil {
+			c.JSON(404, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		input.Resource = policy.UserAttributes(*user)
+	}
+
+	decision := p.engine.Evaluate(input)
+
+	logger.WithFields(logger.Fields{
+		"uuid":     sessionId,
+		"func":     "Explain",
+		"file":     "policyHandler",
+		"tag":      "policy",
+		"action":   body.Action,
+		"allowed":  decision.Allowed,
+		"policyId": decision.PolicyID,
+	}).Info("POLICY_EXPLAIN")
+
+	c.JSON(200, gin.H{
+		"message":  "success",
+		"input":    input,
+		"decision": decision,
+	})
+}
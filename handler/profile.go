@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/service"
+	logger "github.com/sirupsen/logrus"
+)
+
+type IProfileHandler interface {
+	List(c router.IContext)
+	Save(c router.IContext)
+	Delete(c router.IContext)
+	SetDefault(c router.IContext)
+}
+
+type profileHandler struct {
+	service service.IProfileService
+}
+
+func NewProfileHandler(service service.IProfileService) IProfileHandler {
+	return &profileHandler{service: service}
+}
+
+func (p *profileHandler) List(c router.IContext) {
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	user, err := p.service.List(c.GetSessionId(), userId.(string))
+	if err != nil {
+		p.error(c, "List", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":         "success",
+		"data":            user.Profiles,
+		"defaultLanguage": user.DefaultLanguage,
+	})
+}
+
+// Save is PUT /profile/profiles/:lang, creating or replacing that language.
+func (p *profileHandler) Save(c router.IContext) {
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	var body model.ProfileRequest
+	if err := c.ReadBodyJSON(&body); err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	profile, err := p.service.Save(c.GetSessionId(), userId.(string), c.Param("lang"), body)
+	if err != nil {
+		p.error(c, "Save", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+		"data":    profile,
+	})
+}
+
+func (p *profileHandler) Delete(c router.IContext) {
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	if err := p.service.Delete(c.GetSessionId(), userId.(string), c.Param("lang")); err != nil {
+		p.error(c, "Delete", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+func (p *profileHandler) SetDefault(c router.IContext) {
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	var body model.DefaultLanguageRequest
+	if err := c.ReadBodyJSON(&body); err != nil || body.LanguageCode == "" {
+		c.JSON(400, gin.H{
+			"message": "languageCode is required",
+		})
+		return
+	}
+
+	if err := p.service.SetDefault(c.GetSessionId(), userId.(string), body.LanguageCode); err != nil {
+		p.error(c, "SetDefault", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+func (p *profileHandler) error(c router.IContext, fn string, err error) {
+	logger.WithFields(logger.Fields{
+		"uuid":  c.GetSessionId(),
+		"error": err.Error(),
+		"type":  "handler",
+		"func":  fn,
+		"file":  "profileHandler",
+		"tag":   "error",
+	}).Error("PROFILE")
+
+	switch {
+	case errors.Is(err, service.ErrProfileNotFound), errors.Is(err, service.ErrUserNotFound):
+		c.JSON(404, gin.H{
+			"message": err.Error(),
+		})
+	case errors.Is(err, service.ErrDefaultProfile), errors.Is(err, service.ErrTooManyProfiles):
+		c.JSON(409, gin.H{
+			"message": err.Error(),
+		})
+	default:
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"errors"
+	"mime"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/service"
+	logger "github.com/sirupsen/logrus"
+)
+
+type IProfileImageHandler interface {
+	Upload(c router.IContext)
+}
+
+type profileImageHandler struct {
+	service service.IProfileImageService
+}
+
+func NewProfileImageHandler(service service.IProfileImageService) IProfileImageHandler {
+	return &profileImageHandler{service: service}
+}
+
+// Upload is POST /profile/image with the image in the multipart/form-data
+// field "image". The type is sniffed from the content, whatever the part's
+// Content-Type says.
+func (p *profileImageHandler) Upload(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type")); mediaType != "multipart/form-data" {
+		c.JSON(415, gin.H{
+			"message": "content type must be multipart/form-data",
+		})
+		return
+	}
+
+	maxBytes := p.service.MaxBytes()
+	data, err := c.FormFile("image", maxBytes)
+	if errors.Is(err, router.ErrBodyTooLarge) {
+		c.JSON(413, gin.H{
+			"message":  service.ErrImageTooLarge.Error(),
+			"maxBytes": maxBytes,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "image is required",
+		})
+		return
+	}
+
+	image, err := p.service.Upload(sessionId, userId.(string), data)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  sessionId,
+			"error": err.Error(),
+			"type":  "handler",
+			"func":  "Upload",
+			"file":  "profileImageHandler",
+			"tag":   "error",
+		}).Error("PROFILE_IMAGE")
+
+		switch {
+		case errors.Is(err, service.ErrImageTooLarge):
+			c.JSON(413, gin.H{
+				"message":  err.Error(),
+				"maxBytes": maxBytes,
+			})
+		case errors.Is(err, service.ErrUnsupportedImage):
+			c.JSON(415, gin.H{
+				"message": err.Error(),
+			})
+		case errors.Is(err, service.ErrInvalidImage), errors.Is(err, service.ErrImageDimensions):
+			c.JSON(400, gin.H{
+				"message": err.Error(),
+			})
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(404, gin.H{
+				"message": err.Error(),
+			})
+		default:
+			c.JSON(500, gin.H{
+				"message": "internal server error",
+			})
+		}
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+		"data":    image,
+	})
+}
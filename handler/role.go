@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/service"
+	logger "github.com/sirupsen/logrus"
+)
+
+type IRoleHandler interface {
+	List(c router.IContext)
+	Save(c router.IContext)
+	Delete(c router.IContext)
+	Assign(c router.IContext)
+}
+
+type roleHandler struct {
+	service service.IRoleService
+}
+
+func NewRoleHandler(service service.IRoleService) IRoleHandler {
+	return &roleHandler{service: service}
+}
+
+func (r *roleHandler) List(c router.IContext) {
+	roles, err := r.service.List(c.GetSessionId())
+	if err != nil {
+		r.error(c, "List", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+		"data":    roles,
+	})
+}
+
+// Save creates or replaces the custom role named in the path.
+func (r *roleHandler) Save(c router.IContext) {
+	var body model.Role
+	if err := c.ReadBodyJSON(&body); err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	body.Name = c.Param("name")
+
+	if err := r.service.Save(c.GetSessionId(), body); err != nil {
+		r.error(c, "Save", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+func (r *roleHandler) Delete(c router.IContext) {
+	if err := r.service.Delete(c.GetSessionId(), c.Param("name")); err != nil {
+		r.error(c, "Delete", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+func (r *roleHandler) Assign(c router.IContext) {
+	userId, _ := c.Get("userId")
+	actorId, _ := userId.(string)
+
+	var body model.AssignRoleRequest
+	if err := c.ReadBodyJSON(&body); err != nil || body.Role == "" {
+		c.JSON(400, gin.H{
+			"message": "role is required",
+		})
+		return
+	}
+
+	if err := r.service.Assign(c.GetSessionId(), actorId, c.Param("id"), body.Role); err != nil {
+		r.error(c, "Assign", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+func (r *roleHandler) error(c router.IContext, fn string, err error) {
+	logger.WithFields(logger.Fields{
+		"uuid":  c.GetSessionId(),
+		"error": err.Error(),
+		"type":  "handler",
+		"func":  fn,
+		"file":  "roleHandler",
+		"tag":   "error",
+	}).Error("ROLE")
+
+	switch {
+	case errors.Is(err, service.ErrRoleNotFound), errors.Is(err, service.ErrUserNotFound):
+		c.JSON(404, gin.H{
+			"message": err.Error(),
+		})
+	case errors.Is(err, service.ErrRoleBuiltIn), errors.Is(err, service.ErrRoleInUse), errors.Is(err, service.ErrLastAdmin):
+		c.JSON(409, gin.H{
+			"message": err.Error(),
+		})
+	default:
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/service"
+	logger "github.com/sirupsen/logrus"
+)
+
+type ISessionHandler interface {
+	List(c router.IContext)
+	Revoke(c router.IContext)
+}
+
+type sessionHandler struct {
+	service service.ISessionService
+}
+
+func NewSessionHandler(service service.ISessionService) ISessionHandler {
+	return &sessionHandler{service: service}
+}
+
+func (s *sessionHandler) List(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	sessions, err := s.service.List(sessionId, userId.(string), currentSid(c))
+	if err != nil {
+		s.error(c, "List", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+		"data":    sessions,
+	})
+}
+
+// Revoke signs the user out on the given device, which may be this one.
+func (s *sessionHandler) Revoke(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	if err := s.service.Revoke(sessionId, userId.(string), c.Param("id")); err != nil {
+		s.error(c, "Revoke", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+func (s *sessionHandler) error(c router.IContext, fn string, err error) {
+	logger.WithFields(logger.Fields{
+		"uuid":  c.GetSessionId(),
+		"error": err.Error(),
+		"type":  "handler",
+		"func":  fn,
+		"file":  "sessionHandler",
+		"tag":   "error",
+	}).Error("SESSION")
+
+	if errors.Is(err, service.ErrSessionNotFound) {
+		c.JSON(404, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(500, gin.H{
+		"message": err.Error(),
+	})
+}
+
+func currentSid(c router.IContext) string {
+	value, ok := c.Get("claims")
+	if !ok {
+		return ""
+	}
+	claims, _ := value.(jwt.MapClaims)
+	sid, _ := claims["sid"].(string)
+	return sid
+}
+
+// device describes the caller for a new session, from the headers collected
+// by router.GetHeaders.
+func device(c router.IContext) model.Device {
+	headers := c.GetHeaders()
+
+	userAgent, _ := headers["user_agent"].(string)
+	ip, _ := headers["client_ip"].(string)
+	platform, _ := headers["OS"].(string)
+	mobile, _ := headers["Mobile"].(string)
+
+	return model.Device{
+		UserAgent: userAgent,
+		IPAddress: ip,
+		Platform:  strings.Trim(platform, `"`),
+		Mobile:    mobile == "?1",
+	}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/service"
+	logger "github.com/sirupsen/logrus"
+)
+
+type ITokenHandler interface {
+	Refresh(c router.IContext)
+	Logout(c router.IContext)
+}
+
+type tokenHandler struct {
+	service service.ITokenService
+}
+
+func NewTokenHandler(service service.ITokenService) ITokenHandler {
+	return &tokenHandler{service: service}
+}
+
+func (t *tokenHandler) Refresh(c router.IContext) {
+	sessionId := c.GetSessionId()
+	var body model.RefreshTokenRequest
+
+	if err := c.ReadBodyJSON(&body); err != nil || body.RefreshToken == "" {
+		c.JSON(400, gin.H{
+			"message": "refresh_token is required",
+		})
+		return
+	}
+
+	token, err := t.service.Refresh(sessionId, body.RefreshToken, "")
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  sessionId,
+			"error": err.Error(),
+			"type":  "handler",
+			"func":  "Refresh",
+			"file":  "tokenHandler",
+			"tag":   "handler",
+		}).Error("REFRESH")
+
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			c.JSON(401, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(500, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, tokenResponse(token))
+}
+
+func (t *tokenHandler) Logout(c router.IContext) {
+	sessionId := c.GetSessionId()
+	value, ok := c.Get("claims")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	claims := value.(jwt.MapClaims)
+	sub, _ := claims.GetSubject()
+	jti, _ := claims["jti"].(string)
+	sid, _ := claims["sid"].(string)
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil || jti == "" {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	// The refresh token is optional; tokens with a sid end their whole
+	// session anyway.
+	var body model.RefreshTokenRequest
+	_ = c.ReadBodyJSON(&body)
+
+	if err := t.service.Logout(sessionId, sub, sid, jti, exp.Time, body.RefreshToken); err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  sessionId,
+			"error": err.Error(),
+			"type":  "handler",
+			"func":  "Logout",
+			"file":  "tokenHandler",
+			"tag":   "handler",
+		}).Error("LOGOUT")
+
+		c.JSON(500, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+func tokenResponse(token *model.Token) gin.H {
+	response := gin.H{
+		"message":       "success",
+		"token":         token.AccessToken,
+		"refresh_token": token.RefreshToken,
+		"token_type":    token.TokenType,
+		"expires_in":    token.ExpiresIn,
+	}
+
+	if token.IDToken != "" {
+		response["id_token"] = token.IDToken
+	}
+
+	if token.Scope != "" {
+		response["scope"] = token.Scope
+	}
+
+	return response
+}
@@ -1,9 +1,15 @@
 package handler
 
 import (
+	"errors"
+	"strconv"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/sing3demons/users/model"
 	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/security"
 	"github.com/sing3demons/users/service"
 	"github.com/sing3demons/users/utils"
 	logger "github.com/sirupsen/logrus"
@@ -13,6 +19,11 @@ type IUserHandler interface {
 	Register(c router.IContext)
 	Login(c router.IContext)
 	GetProfile(c router.IContext)
+	UpdateProfile(c router.IContext)
+	GetUser(c router.IContext)
+	List(c router.IContext)
+	Search(c router.IContext)
+	UserInfo(c router.IContext)
 }
 
 type userHandler struct {
@@ -64,15 +75,264 @@ func (u *userHandler) GetProfile(c router.IContext) {
 		"func":   "GetProfile",
 		"file":   "userHandler",
 		"tag":    "info",
-		"result": utils.MaskSensitiveData(user),
+		"userId": user.ID.Hex(),
 	}).Info("GET_PROFILE")
 
+	// profile is the user's names in the language that best fits
+	// Accept-Language; user.profiles still lists every language.
+	body := gin.H{
+		"message": "success",
+		"user":    user,
+	}
+	c.SetHeader("Vary", "Accept-Language")
+	if profile := service.SelectProfile(*user, c.GetHeader("Accept-Language")); profile != nil {
+		body["profile"] = profile
+		c.SetHeader("Content-Language", profile.LanguageCode)
+	}
+	c.JSON(200, body)
+}
+
+// UpdateProfile is PATCH /profile with an RFC 7396 merge patch body.
+func (u *userHandler) UpdateProfile(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	contentType, _, _ := strings.Cut(c.GetHeader("Content-Type"), ";")
+	if contentType = strings.TrimSpace(contentType); contentType != "application/merge-patch+json" && contentType != "application/json" {
+		c.JSON(415, gin.H{
+			"message": "content type must be application/merge-patch+json",
+		})
+		return
+	}
+
+	var patch map[string]any
+	if err := c.ReadBodyJSON(&patch); err != nil || patch == nil {
+		c.JSON(400, gin.H{
+			"message": "patch must be a JSON object",
+		})
+		return
+	}
+
+	user, err := u.service.UpdateProfile(sessionId, userId.(string), patch)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  sessionId,
+			"error": err.Error(),
+			"type":  "handler",
+			"func":  "UpdateProfile",
+			"file":  "userHandler",
+			"tag":   "error",
+		}).Error("UPDATE_PROFILE")
+
+		var fieldErr *service.ProfileFieldError
+		switch {
+		case errors.As(err, &fieldErr) && fieldErr.ReadOnly:
+			c.JSON(400, gin.H{
+				"message": err.Error(),
+				"error":   "read_only_field",
+				"field":   fieldErr.Field,
+			})
+		case errors.As(err, &fieldErr):
+			c.JSON(400, gin.H{
+				"message": err.Error(),
+				"error":   "invalid_field",
+				"field":   fieldErr.Field,
+			})
+		case errors.Is(err, service.ErrUsernameTaken):
+			c.JSON(409, gin.H{
+				"message": err.Error(),
+			})
+		default:
+			c.JSON(400, gin.H{
+				"message": err.Error(),
+			})
+		}
+		return
+	}
+
 	c.JSON(200, gin.H{
 		"message": "success",
 		"user":    user,
 	})
 }
 
+// GetUser returns the user in the path. Access is decided by the policy
+// middleware in front of it.
+func (u *userHandler) GetUser(c router.IContext) {
+	sessionId := c.GetSessionId()
+
+	user, err := u.service.GetProfile(sessionId, c.Param("id"))
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  sessionId,
+			"error": err.Error(),
+			"type":  "handler",
+			"func":  "GetUser",
+			"file":  "userHandler",
+			"tag":   "error",
+		}).Error("GET_USER")
+
+		c.JSON(404, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+		"user":    user,
+	})
+}
+
+// List is GET /admin/users. Filters: status, role, created_from, created_to,
+// email_domain; paging: sort, limit, cursor, include_total.
+func (u *userHandler) List(c router.IContext) {
+	sessionId := c.GetSessionId()
+
+	query := model.UserListQuery{
+		Status:      c.QueryString("status"),
+		Role:        c.QueryString("role"),
+		CreatedFrom: c.QueryString("created_from"),
+		CreatedTo:   c.QueryString("created_to"),
+		EmailDomain: c.QueryString("email_domain"),
+		Sort:        c.QueryString("sort"),
+		Cursor:      c.QueryString("cursor"),
+	}
+
+	if limit := c.QueryString("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": "limit must be a number",
+			})
+			return
+		}
+		query.Limit = n
+	}
+
+	if total := c.QueryString("include_total"); total != "" {
+		include, err := strconv.ParseBool(total)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": "include_total must be true or false",
+			})
+			return
+		}
+		query.IncludeTotal = include
+	}
+
+	page, err := u.service.List(sessionId, query)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  sessionId,
+			"error": err.Error(),
+			"type":  "handler",
+			"func":  "List",
+			"file":  "userHandler",
+			"tag":   "error",
+		}).Error("LIST_USERS")
+
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	body := gin.H{
+		"message": "success",
+		"data":    page.Users,
+	}
+	if page.NextCursor != "" {
+		body["next_cursor"] = page.NextCursor
+	}
+	if page.Total != nil {
+		body["total"] = *page.Total
+	}
+	c.JSON(200, body)
+}
+
+// Search is GET /admin/users/search?q=...&limit=..., best matches first.
+func (u *userHandler) Search(c router.IContext) {
+	sessionId := c.GetSessionId()
+
+	search := model.UserSearch{Text: c.QueryString("q")}
+	if limit := c.QueryString("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": "limit must be a number",
+			})
+			return
+		}
+		search.Limit = n
+	}
+
+	results, err := u.service.Search(sessionId, search)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  sessionId,
+			"error": err.Error(),
+			"type":  "handler",
+			"func":  "Search",
+			"file":  "userHandler",
+			"tag":   "error",
+		}).Error("SEARCH_USERS")
+
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+		"data":    results,
+	})
+}
+
+// UserInfo is the OIDC userinfo endpoint, routed behind
+// RequireScopes(openid); it only releases the claims the access token's
+// scope grants.
+func (u *userHandler) UserInfo(c router.IContext) {
+	sessionId := c.GetSessionId()
+	value, ok := c.Get("claims")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	claims := value.(jwt.MapClaims)
+	scopes := security.ClaimScopes(claims)
+
+	sub, _ := claims.GetSubject()
+	user, err := u.service.GetProfile(sessionId, sub)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  sessionId,
+			"error": err.Error(),
+			"type":  "handler",
+			"func":  "UserInfo",
+			"file":  "userHandler",
+			"tag":   "error",
+		}).Error("USER_INFO")
+
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	c.JSON(200, security.UserClaims(*user, scopes))
+}
+
 func (u *userHandler) Register(c router.IContext) {
 	sessionId := c.GetSessionId()
 
@@ -108,6 +368,10 @@ func (u *userHandler) Register(c router.IContext) {
 			"tag":   "error",
 		}).Error("REGISTER")
 
+		if writePolicyError(c, err) {
+			return
+		}
+
 		c.JSON(400, gin.H{
 			"message": err.Error(),
 		})
@@ -150,7 +414,21 @@ func (u *userHandler) Login(c router.IContext) {
 		return
 	}
 
+	body.ClientIP = clientIP(c)
+	body.Device = device(c)
+
 	token, err := u.service.Login(sessionId, body)
+	var mfaErr *service.MFARequiredError
+	if errors.As(err, &mfaErr) {
+		c.JSON(401, gin.H{
+			"message":    "mfa required",
+			"error":      "mfa_required",
+			"mfa_token":  mfaErr.Challenge,
+			"expires_in": mfaErr.ExpiresIn,
+		})
+		return
+	}
+
 	if err != nil {
 		logger.WithFields(logger.Fields{
 			"uuid":  sessionId,
@@ -162,6 +440,30 @@ func (u *userHandler) Login(c router.IContext) {
 			"tag":   "handler",
 		}).Error("LOGIN")
 
+		var scopeErr *security.InvalidScopeError
+		if errors.As(err, &scopeErr) {
+			c.JSON(400, gin.H{
+				"message": err.Error(),
+				"error":   "invalid_scope",
+			})
+			return
+		}
+
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			c.JSON(401, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			c.JSON(403, gin.H{
+				"message": err.Error(),
+				"error":   "email_not_verified",
+			})
+			return
+		}
+
 		c.JSON(400, gin.H{
 			"message": err.Error(),
 		})
@@ -174,11 +476,8 @@ func (u *userHandler) Login(c router.IContext) {
 		"func":   "Login",
 		"file":   "userHandler",
 		"tag":    "info",
-		"result": token,
+		"result": nil,
 	}).Info("LOGIN")
 
-	c.JSON(200, gin.H{
-		"message": "success",
-		"token":   token,
-	})
+	c.JSON(200, tokenResponse(token))
 }
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/service"
+	logger "github.com/sirupsen/logrus"
+)
+
+type IVerificationHandler interface {
+	Verify(c router.IContext)
+	Resend(c router.IContext)
+}
+
+type verificationHandler struct {
+	service service.IVerificationService
+}
+
+func NewVerificationHandler(service service.IVerificationService) IVerificationHandler {
+	return &verificationHandler{service: service}
+}
+
+// Verify accepts the token either as ?token= (the emailed link) or as a
+// JSON body posted by a frontend page.
+func (v *verificationHandler) Verify(c router.IContext) {
+	sessionId := c.GetSessionId()
+
+	token := c.QueryString("token")
+	if token == "" {
+		var body model.VerifyEmailRequest
+		if err := c.ReadBodyJSON(&body); err == nil {
+			token = body.Token
+		}
+	}
+
+	if err := v.service.Verify(sessionId, token); err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  sessionId,
+			"error": err.Error(),
+			"type":  "handler",
+			"func":  "Verify",
+			"file":  "verificationHandler",
+			"tag":   "error",
+		}).Error("VERIFY_EMAIL")
+
+		if errors.Is(err, service.ErrInvalidVerificationToken) {
+			c.JSON(400, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(500, gin.H{
+			"message": "internal server error",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "email verified",
+	})
+}
+
+func (v *verificationHandler) Resend(c router.IContext) {
+	sessionId := c.GetSessionId()
+
+	var body model.ResendVerificationRequest
+	if err := c.ReadBodyJSON(&body); err != nil || body.Email == "" {
+		c.JSON(400, gin.H{
+			"message": "email is required",
+		})
+		return
+	}
+
+	v.service.Resend(sessionId, body)
+
+	c.JSON(200, gin.H{
+		"message": "if the account is awaiting verification, a new link has been sent",
+	})
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/service"
+	logger "github.com/sirupsen/logrus"
+)
+
+type IWebAuthnHandler interface {
+	BeginRegistration(c router.IContext)
+	FinishRegistration(c router.IContext)
+	RemoveCredential(c router.IContext)
+	BeginLogin(c router.IContext)
+	FinishLogin(c router.IContext)
+}
+
+type webAuthnHandler struct {
+	service service.IWebAuthnService
+}
+
+func NewWebAuthnHandler(service service.IWebAuthnService) IWebAuthnHandler {
+	return &webAuthnHandler{service: service}
+}
+
+func (w *webAuthnHandler) BeginRegistration(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	options, err := w.service.BeginRegistration(sessionId, userId.(string))
+	if err != nil {
+		w.error(c, "BeginRegistration", err)
+		return
+	}
+
+	c.JSON(200, options)
+}
+
+func (w *webAuthnHandler) FinishRegistration(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	var body model.WebAuthnCredentialResponse
+	if err := c.ReadBodyJSON(&body); err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	credential, err := w.service.FinishRegistration(sessionId, userId.(string), body)
+	if err != nil {
+		w.error(c, "FinishRegistration", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":    "success",
+		"credential": credential,
+	})
+}
+
+func (w *webAuthnHandler) RemoveCredential(c router.IContext) {
+	sessionId := c.GetSessionId()
+	userId, ok := c.Get("userId")
+	if !ok {
+		c.JSON(401, gin.H{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	if err := w.service.RemoveCredential(sessionId, userId.(string), c.Param("id")); err != nil {
+		w.error(c, "RemoveCredential", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+func (w *webAuthnHandler) BeginLogin(c router.IContext) {
+	sessionId := c.GetSessionId()
+
+	// The email is optional; discoverable passkeys need none.
+	var body model.WebAuthnLoginRequest
+	_ = c.ReadBodyJSON(&body)
+
+	options, err := w.service.BeginLogin(sessionId, body)
+	if err != nil {
+		w.error(c, "BeginLogin", err)
+		return
+	}
+
+	c.JSON(200, options)
+}
+
+func (w *webAuthnHandler) FinishLogin(c router.IContext) {
+	sessionId := c.GetSessionId()
+
+	var body model.WebAuthnCredentialResponse
+	if err := c.ReadBodyJSON(&body); err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	body.Device = device(c)
+
+	token, err := w.service.FinishLogin(sessionId, body)
+	if err != nil {
+		w.error(c, "FinishLogin", err)
+		return
+	}
+
+	c.JSON(200, tokenResponse(token))
+}
+
+func (w *webAuthnHandler) error(c router.IContext, fn string, err error) {
+	logger.WithFields(logger.Fields{
+		"uuid":  c.GetSessionId(),
+		"error": err.Error(),
+		"type":  "handler",
+		"func":  fn,
+		"file":  "webAuthnHandler",
+		"tag":   "error",
+	}).Error("WEBAUTHN")
+
+	switch {
+	case errors.Is(err, service.ErrWebAuthnFailed):
+		c.JSON(401, gin.H{
+			"message": err.Error(),
+		})
+	case errors.Is(err, service.ErrWebAuthnCredentialExists):
+		c.JSON(409, gin.H{
+			"message": err.Error(),
+		})
+	case errors.Is(err, service.ErrEmailNotVerified):
+		c.JSON(403, gin.H{
+			"message": err.Error(),
+		})
+	case errors.Is(err, service.ErrWebAuthnCredentialUnknown):
+		c.JSON(404, gin.H{
+			"message": err.Error(),
+		})
+	default:
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+	}
+}
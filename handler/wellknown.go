@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/security"
+	logger "github.com/sirupsen/logrus"
+)
+
+type IWellKnownHandler interface {
+	JWKS(c router.IContext)
+	OpenIDConfiguration(c router.IContext)
+}
+
+type wellKnownHandler struct{}
+
+func NewWellKnownHandler() IWellKnownHandler {
+	return &wellKnownHandler{}
+}
+
+func (w *wellKnownHandler) JWKS(c router.IContext) {
+	keys, err := security.GetKeySet()
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  c.GetSessionId(),
+			"error": err.Error(),
+			"type":  "handler",
+			"func":  "JWKS",
+			"file":  "wellKnownHandler",
+			"tag":   "error",
+		}).Error("JWKS")
+
+		c.JSON(500, gin.H{
+			"message": "key set unavailable",
+		})
+		return
+	}
+
+	c.JSON(200, keys.JWKS())
+}
+
+func (w *wellKnownHandler) OpenIDConfiguration(c router.IContext) {
+	issuer := strings.TrimSuffix(os.Getenv("ISSUER"), "/")
+	if issuer == "" {
+		c.JSON(500, gin.H{
+			"message": "issuer not configured",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token", "client_credentials"},
+		"code_challenge_methods_supported":      []string{security.PKCEMethodS256},
+		"token_endpoint_auth_methods_supported": []string{"none", "client_secret_basic", "client_secret_post"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      security.UserScopes,
+		"claims_supported": []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"name", "given_name", "family_name", "nickname", "preferred_username",
+			"gender", "birthdate", "picture", "locale", "updated_at", "email",
+		},
+	})
+}
@@ -0,0 +1,186 @@
+// Package imaging validates uploaded images and renders the resized copies
+// that are actually stored. Decoding and re-encoding drops all metadata
+// (EXIF, ICC profiles, comments), after the EXIF orientation is applied.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// Limits checked from the image header before the pixels are decoded.
+const (
+	MaxDimension = 8000
+	MaxPixels    = 40_000_000
+)
+
+var (
+	ErrUnsupported = errors.New("image must be JPEG, PNG or GIF")
+	ErrInvalid     = errors.New("image could not be decoded")
+	ErrDimensions  = fmt.Errorf("image must be at most %dx%d pixels", MaxDimension, MaxDimension)
+)
+
+// Size is one rendition. Square renditions are center-cropped; the others
+// keep the aspect ratio. Images are never scaled up.
+type Size struct {
+	Name   string
+	Max    int
+	Square bool
+}
+
+type Variant struct {
+	Name        string
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+var formats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// Sniff returns the content type detected from data's leading bytes, or
+// ErrUnsupported. Whatever the client declared is ignored.
+func Sniff(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := formats[contentType]; !ok {
+		return "", ErrUnsupported
+	}
+	return contentType, nil
+}
+
+// Process decodes data and renders each size. JPEG sources stay JPEG; PNG
+// and GIF sources become PNG so transparency survives. Only the first frame
+// of an animated GIF is kept.
+func Process(data []byte, sizes []Size) ([]Variant, error) {
+	contentType, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != formats[contentType] {
+		return nil, ErrInvalid
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrInvalid
+	}
+	if config.Width > MaxDimension || config.Height > MaxDimension || config.Width*config.Height > MaxPixels {
+		return nil, ErrDimensions
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	src := toRGBA(decoded)
+	if format == "jpeg" {
+		src = orient(src, jpegOrientation(data))
+	}
+
+	variants := make([]Variant, 0, len(sizes))
+	for _, size := range sizes {
+		img := src
+		if size.Square {
+			img = cropSquare(img)
+		}
+		img = fit(img, size.Max)
+
+		var buf bytes.Buffer
+		variant := Variant{Name: size.Name, Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+		if format == "jpeg" {
+			variant.ContentType, variant.Ext = "image/jpeg", "jpg"
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+		} else {
+			variant.ContentType, variant.Ext = "image/png", "png"
+			err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+		}
+		if err != nil {
+			return nil, err
+		}
+		variant.Data = buf.Bytes()
+
+		variants = append(variants, variant)
+	}
+
+	return variants, nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+func cropSquare(img *image.RGBA) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w == h {
+		return img
+	}
+
+	side := min(w, h)
+	x0, y0 := (w-side)/2, (h-side)/2
+	return img.SubImage(image.Rect(x0, y0, x0+side, y0+side)).(*image.RGBA)
+}
+
+// fit scales img down so neither side exceeds limit.
+func fit(img *image.RGBA, limit int) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w <= limit && h <= limit {
+		return toRGBA(img)
+	}
+
+	dw, dh := limit, h*limit/w
+	if h > w {
+		dw, dh = w*limit/h, limit
+	}
+	return resize(img, max(dw, 1), max(dh, 1))
+}
+
+// resize downscales with a box filter: every destination pixel is the mean
+// of the source pixels it covers.
+func resize(src *image.RGBA, dw, dh int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[src.PixOffset(b.Min.X+x0, b.Min.Y+sy):]
+				for i := 0; i < (x1-x0)*4; i += 4 {
+					r += uint64(row[i])
+					g += uint64(row[i+1])
+					bl += uint64(row[i+2])
+					a += uint64(row[i+3])
+					n++
+				}
+			}
+
+			o := dst.PixOffset(x, y)
+			dst.Pix[o] = uint8((r + n/2) / n)
+			dst.Pix[o+1] = uint8((g + n/2) / n)
+			dst.Pix[o+2] = uint8((bl + n/2) / n)
+			dst.Pix[o+3] = uint8((a + n/2) / n)
+		}
+	}
+
+	return dst
+}
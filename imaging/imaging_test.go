@@ -0,0 +1,389 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red   = color.RGBA{255, 0, 0, 255}
+	blue  = color.RGBA{0, 0, 255, 255}
+	green = color.RGBA{0, 255, 0, 255}
+	white = color.RGBA{255, 255, 255, 255}
+)
+
+// quadrants is a w x h image with a different color in each quarter.
+func quadrants(w, h int, tl, tr, bl, br color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := tl
+			switch {
+			case x >= w/2 && y < h/2:
+				c = tr
+			case x < w/2 && y >= h/2:
+				c = bl
+			case x >= w/2 && y >= h/2:
+				c = br
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withSegments inserts raw JPEG segments right after the SOI marker.
+func withSegments(data []byte, segments ...[]byte) []byte {
+	out := append([]byte{}, data[:2]...)
+	for _, s := range segments {
+		out = append(out, s...)
+	}
+	return append(out, data[2:]...)
+}
+
+func segment(marker byte, payload []byte) []byte {
+	s := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(s[2:], uint16(len(payload)+2))
+	return append(s, payload...)
+}
+
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// exifSegment is an APP1 segment whose IFD0 holds an orientation tag and a
+// camera model string.
+func exifSegment(order byteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8, 64)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+
+	model := []byte("SecretCam\x00")
+	tiff = order.AppendUint16(tiff, 2)
+	// Model (ASCII), stored after the IFD.
+	tiff = order.AppendUint16(tiff, 0x0110)
+	tiff = order.AppendUint16(tiff, 2)
+	tiff = order.AppendUint32(tiff, uint32(len(model)))
+	tiff = order.AppendUint32(tiff, 8+2+2*12+4)
+	// Orientation (SHORT).
+	tiff = order.AppendUint16(tiff, 0x0112)
+	tiff = order.AppendUint16(tiff, 3)
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0)
+	tiff = order.AppendUint32(tiff, 0)
+	tiff = append(tiff, model...)
+
+	return segment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+// pngHeader is just a PNG signature and IHDR, enough for DecodeConfig.
+func pngHeader(w, h uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr, w)
+	binary.BigEndian.PutUint32(ihdr[4:], h)
+	ihdr[8], ihdr[9] = 8, 6 // 8-bit RGBA
+
+	return pngChunk([]byte("\x89PNG\r\n\x1a\n"), "IHDR", ihdr)
+}
+
+func pngChunk(dst []byte, kind string, data []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(data)))
+	start := len(dst)
+	dst = append(dst, kind...)
+	dst = append(dst, data...)
+	return binary.BigEndian.AppendUint32(dst, crc32.ChecksumIEEE(dst[start:]))
+}
+
+func near(a, b color.RGBA) bool {
+	d := func(x, y uint8) int {
+		if x > y {
+			return int(x - y)
+		}
+		return int(y - x)
+	}
+	return d(a.R, b.R) < 48 && d(a.G, b.G) < 48 && d(a.B, b.B) < 48
+}
+
+func decode(t *testing.T, v Variant) image.Image {
+	t.Helper()
+	img, _, err := image.Decode(bytes.NewReader(v.Data))
+	if err != nil {
+		t.Fatalf("%s: %v", v.Name, err)
+	}
+	return img
+}
+
+func rgbaAt(img image.Image, x, y int) color.RGBA {
+	return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+}
+
+func TestProcessAppliesEXIFOrientation(t *testing.T) {
+	// The source is 64x32: red, blue over green, white. Each case lists the
+	// quadrant colors of the upright result.
+	tests := []struct {
+		orientation uint16
+		width       int
+		want        [4]color.RGBA // top-left, top-right, bottom-left, bottom-right
+	}{
+		{1, 64, [4]color.RGBA{red, blue, green, white}},
+		{2, 64, [4]color.RGBA{blue, red, white, green}},
+		{3, 64, [4]color.RGBA{white, green, blue, red}},
+		{4, 64, [4]color.RGBA{green, white, red, blue}},
+		{5, 32, [4]color.RGBA{red, green, blue, white}},
+		{6, 32, [4]color.RGBA{green, red, white, blue}},
+		{7, 32, [4]color.RGBA{white, blue, green, red}},
+		{8, 32, [4]color.RGBA{blue, white, red, green}},
+	}
+
+	src := encodeJPEG(t, quadrants(64, 32, red, blue, green, white))
+	for _, order := range []byteOrder{binary.BigEndian, binary.LittleEndian} {
+		for _, tt := range tests {
+			data := withSegments(src, exifSegment(order, tt.orientation))
+			if got := jpegOrientation(data); got != int(tt.orientation) {
+				t.Fatalf("%v orientation %d: parsed %d", order, tt.orientation, got)
+			}
+
+			variants, err := Process(data, []Size{{Name: "image", Max: 1024}})
+			if err != nil {
+				t.Fatalf("%v orientation %d: %v", order, tt.orientation, err)
+			}
+			img := decode(t, variants[0])
+			w, h := img.Bounds().Dx(), img.Bounds().Dy()
+			if w != tt.width || h != 96-tt.width {
+				t.Fatalf("%v orientation %d: %dx%d", order, tt.orientation, w, h)
+			}
+
+			points := [4][2]int{{w / 4, h / 4}, {3 * w / 4, h / 4}, {w / 4, 3 * h / 4}, {3 * w / 4, 3 * h / 4}}
+			for i, p := range points {
+				if got := rgbaAt(img, p[0], p[1]); !near(got, tt.want[i]) {
+					t.Errorf("%v orientation %d: quadrant %d is %v, want %v", order, tt.orientation, i, got, tt.want[i])
+				}
+			}
+		}
+	}
+}
+
+func TestJPEGOrientationMalformed(t *testing.T) {
+	src := encodeJPEG(t, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	valid := exifSegment(binary.BigEndian, 6)
+
+	tests := map[string][]byte{
+		"not a jpeg":        []byte("\x89PNG"),
+		"no exif":           src,
+		"truncated segment": append([]byte{0xFF, 0xD8}, valid[:10]...),
+		"bad byte order":    withSegments(src, segment(0xE1, []byte("Exif\x00\x00XX\x00\x2a\x00\x00\x00\x08"))),
+		"ifd out of range":  withSegments(src, segment(0xE1, []byte("Exif\x00\x00MM\x00\x2a\xff\xff\xff\xff"))),
+		"orientation 9":     withSegments(src, exifSegment(binary.BigEndian, 9)),
+	}
+
+	for name, data := range tests {
+		if got := jpegOrientation(data); got != 1 {
+			t.Errorf("%s: orientation %d, want 1", name, got)
+		}
+	}
+}
+
+func TestProcessSizes(t *testing.T) {
+	sizes := []Size{
+		{Name: "image", Max: 1024},
+		{Name: "256", Max: 256, Square: true},
+		{Name: "64", Max: 64, Square: true},
+	}
+
+	tests := []struct {
+		name          string
+		width, height int
+		want          [][2]int
+	}{
+		{"landscape", 2000, 1000, [][2]int{{1024, 512}, {256, 256}, {64, 64}}},
+		{"portrait", 600, 1500, [][2]int{{409, 1024}, {256, 256}, {64, 64}}},
+		{"small images are not scaled up", 100, 50, [][2]int{{100, 50}, {50, 50}, {50, 50}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodePNG(t, image.NewRGBA(image.Rect(0, 0, tt.width, tt.height)))
+			variants, err := Process(data, sizes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(variants) != len(sizes) {
+				t.Fatalf("got %d variants", len(variants))
+			}
+			for i, v := range variants {
+				img := decode(t, v)
+				got := [2]int{img.Bounds().Dx(), img.Bounds().Dy()}
+				if v.Name != sizes[i].Name || got != tt.want[i] || v.Width != got[0] || v.Height != got[1] {
+					t.Errorf("%s: %v (reported %dx%d), want %v", v.Name, got, v.Width, v.Height, tt.want[i])
+				}
+				if v.ContentType != "image/png" || v.Ext != "png" {
+					t.Errorf("%s: %s .%s, want image/png", v.Name, v.ContentType, v.Ext)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessSquareIsCenterCrop(t *testing.T) {
+	// Blue side bands around a green center third.
+	img := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 300; x++ {
+			if x >= 100 && x < 200 {
+				img.SetRGBA(x, y, green)
+			} else {
+				img.SetRGBA(x, y, blue)
+			}
+		}
+	}
+
+	variants, err := Process(encodePNG(t, img), []Size{{Name: "64", Max: 64, Square: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumb := decode(t, variants[0])
+	for _, p := range [][2]int{{0, 0}, {63, 0}, {0, 63}, {63, 63}, {32, 32}} {
+		if got := rgbaAt(thumb, p[0], p[1]); got != green {
+			t.Errorf("pixel %v = %v, want green", p, got)
+		}
+	}
+}
+
+func TestResizeAveragesBoxes(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			if x%2 == 0 {
+				img.SetRGBA(x, y, color.RGBA{0, 0, 0, 255})
+			} else {
+				img.SetRGBA(x, y, color.RGBA{200, 100, 50, 255})
+			}
+		}
+	}
+
+	out := resize(img, 2, 1)
+	want := color.RGBA{100, 50, 25, 255}
+	for x := 0; x < 2; x++ {
+		if got := out.RGBAAt(x, 0); got != want {
+			t.Errorf("pixel %d = %v, want %v", x, got, want)
+		}
+	}
+}
+
+func TestProcessStripsMetadata(t *testing.T) {
+	t.Run("jpeg", func(t *testing.T) {
+		data := withSegments(encodeJPEG(t, quadrants(64, 32, red, blue, green, white)),
+			exifSegment(binary.BigEndian, 1),
+			segment(0xFE, []byte("SecretComment")),
+		)
+
+		variants, err := Process(data, []Size{{Name: "image", Max: 1024}, {Name: "64", Max: 64, Square: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range variants {
+			if v.ContentType != "image/jpeg" || v.Ext != "jpg" {
+				t.Errorf("%s: %s .%s, want image/jpeg", v.Name, v.ContentType, v.Ext)
+			}
+			for _, secret := range []string{"Exif", "SecretCam", "SecretComment"} {
+				if bytes.Contains(v.Data, []byte(secret)) {
+					t.Errorf("%s still contains %q", v.Name, secret)
+				}
+			}
+		}
+	})
+
+	t.Run("png", func(t *testing.T) {
+		data := encodePNG(t, quadrants(64, 32, red, blue, green, white))
+		// Insert a tEXt chunk after IHDR (8 byte signature + 25 byte chunk).
+		text := pngChunk(nil, "tEXt", []byte("Comment\x00SecretComment"))
+		data = append(append(append([]byte{}, data[:33]...), text...), data[33:]...)
+
+		variants, err := Process(data, []Size{{Name: "image", Max: 1024}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(variants[0].Data, []byte("SecretComment")) {
+			t.Error("tEXt chunk survived")
+		}
+	})
+}
+
+func TestProcessGIFBecomesPNG(t *testing.T) {
+	palette := color.Palette{red, blue}
+	frame := image.NewPaletted(image.Rect(0, 0, 20, 10), palette)
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, frame, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	variants, err := Process(buf.Bytes(), []Size{{Name: "image", Max: 1024}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if variants[0].ContentType != "image/png" || variants[0].Width != 20 || variants[0].Height != 10 {
+		t.Errorf("got %s %dx%d", variants[0].ContentType, variants[0].Width, variants[0].Height)
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	sizes := []Size{{Name: "image", Max: 1024}}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrUnsupported},
+		{"html", []byte("<html><body>hi</body></html>"), ErrUnsupported},
+		{"bmp", append([]byte("BM"), make([]byte, 64)...), ErrUnsupported},
+		{"webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), ErrUnsupported},
+		{"truncated png", pngHeader(10, 10)[:20], ErrInvalid},
+		{"png without pixels", pngHeader(10, 10), ErrInvalid},
+		{"zero width", pngHeader(0, 10), ErrInvalid},
+		{"too wide", pngHeader(MaxDimension+1, 10), ErrDimensions},
+		{"too tall", pngHeader(10, MaxDimension+1), ErrDimensions},
+		{"too many pixels", pngHeader(7000, 7000), ErrDimensions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Process(tt.data, sizes); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
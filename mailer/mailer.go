@@ -0,0 +1,148 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	logger "github.com/sirupsen/logrus"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(session string, msg Message) error
+}
+
+// NewMailerFromEnv selects the implementation named by MAILER: "smtp",
+// "file" (writes .eml files to MAIL_DIR) or "log". Outside ZONE=PROD an
+// unset MAILER means "log"; in production it must be chosen explicitly,
+// since the log mailer writes live reset and verification links to the logs.
+func NewMailerFromEnv() Mailer {
+	mailer := os.Getenv("MAILER")
+	production := os.Getenv("ZONE") == "PROD"
+
+	fields := logger.Fields{
+		"func":   "NewMailerFromEnv",
+		"file":   "mailer/mailer.go",
+		"tag":    "mailer",
+		"mailer": mailer,
+	}
+
+	switch mailer {
+	case "smtp":
+		return NewSMTPMailer(os.Getenv("SMTP_HOST"), os.Getenv("SMTP_PORT"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("MAIL_FROM"))
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "_mail"
+		}
+		return NewFileMailer(dir, os.Getenv("MAIL_FROM"))
+	case "log":
+		if production {
+			logger.WithFields(fields).Warn("log mailer in production: mail bodies, including reset links, are logged")
+		}
+		return NewLogMailer()
+	case "":
+		if production {
+			logger.WithFields(fields).Fatal("MAILER is not set")
+		}
+		return NewLogMailer()
+	default:
+		logger.WithFields(fields).Fatal("unknown MAILER")
+		return nil
+	}
+}
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &smtpMailer{addr: host + ":" + port, auth: auth, from: from}
+}
+
+func (s *smtpMailer) Send(session string, msg Message) error {
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, render(s.from, msg)); err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":    session,
+			"error":   err.Error(),
+			"func":    "Send",
+			"file":    "mailer/mailer.go",
+			"tag":     "mailer",
+			"subject": msg.Subject,
+		}).Error("send mail error")
+
+		return err
+	}
+
+	return nil
+}
+
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) Mailer {
+	return &fileMailer{dir: dir, from: from}
+}
+
+func (f *fileMailer) Send(session string, msg Message) error {
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), uuid.NewString())
+	return os.WriteFile(filepath.Join(f.dir, name), render(f.from, msg), 0o600)
+}
+
+type logMailer struct{}
+
+// NewLogMailer prints messages to the log instead of sending them. It is only
+// meant for development since bodies may contain secrets such as reset links.
+func NewLogMailer() Mailer {
+	return &logMailer{}
+}
+
+func (l *logMailer) Send(session string, msg Message) error {
+	logger.WithFields(logger.Fields{
+		"uuid":    session,
+		"func":    "Send",
+		"file":    "mailer/mailer.go",
+		"tag":     "mailer",
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+	}).Info("MAIL")
+
+	return nil
+}
+
+func render(from string, msg Message) []byte {
+	// Header values must not be able to smuggle in extra headers.
+	clean := strings.NewReplacer("\r", "", "\n", "")
+	headers := []string{
+		"From: " + clean.Replace(from),
+		"To: " + clean.Replace(msg.To),
+		"Subject: " + clean.Replace(msg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + msg.Body)
+}
@@ -13,10 +13,14 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/sing3demons/users/handler"
+	"github.com/sing3demons/users/mailer"
 	"github.com/sing3demons/users/middleware"
+	"github.com/sing3demons/users/model"
 	"github.com/sing3demons/users/repository"
 	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/security"
 	"github.com/sing3demons/users/service"
+	"github.com/sing3demons/users/storage"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -31,9 +35,19 @@ func init() {
 }
 
 const (
-	dbName         = "users"
-	collectionName = "users"
-	serviceName    = "users-service"
+	dbName                      = "users"
+	collectionName              = "users"
+	refreshTokenCollectionName  = "refresh_tokens"
+	revokedTokenCollectionName  = "revoked_tokens"
+	oauthClientCollectionName   = "oauth_clients"
+	oauthCodeCollectionName     = "oauth_codes"
+	webAuthnCollectionName      = "webauthn_challenges"
+	passwordResetCollectionName = "password_resets"
+	loginAttemptCollectionName  = "login_attempts"
+	apiKeyCollectionName        = "api_keys"
+	roleCollectionName          = "roles"
+	sessionCollectionName       = "sessions"
+	serviceName                 = "users-service"
 )
 
 func main() {
@@ -45,21 +59,128 @@ func main() {
 	log.SetLevel(logLevel)
 	log.SetFormatter(&log.JSONFormatter{TimestampFormat: time.RFC3339, PrettyPrint: true})
 
-	db := NewDatabase(dbName, collectionName)
-	repo := repository.NewUserRepository(db)
-	userService := service.NewUserService(repo)
+	// Without signing keys no token can be issued or verified.
+	if _, err := security.GetKeySet(); err != nil {
+		log.WithFields(log.Fields{
+			"func":  "main",
+			"file":  "main.go",
+			"error": err.Error(),
+		}).Fatal("load jwt signing keys")
+	}
+
+	db := NewDatabase(dbName)
+	repo := repository.NewUserRepository(db.Collection(collectionName))
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db.Collection(refreshTokenCollectionName))
+	var revocationRepo repository.IRevocationRepository
+	if os.Getenv("REVOCATION_STORE") == "memory" {
+		revocationRepo = repository.NewInMemoryRevocationRepository()
+	} else {
+		revocationRepo = repository.NewRevocationRepository(db.Collection(revokedTokenCollectionName))
+	}
+	mail := mailer.NewMailerFromEnv()
+	sessionRepo := repository.NewSessionRepository(db.Collection(sessionCollectionName))
+	tokenService := service.NewTokenService(repo, refreshTokenRepo, revocationRepo, sessionRepo)
+	sessionService := service.NewSessionService(sessionRepo, refreshTokenRepo)
+	sessionHandler := handler.NewSessionHandler(sessionService)
+	verificationService := service.NewVerificationService(repo, mail)
+	verificationHandler := handler.NewVerificationHandler(verificationService)
+	loginAttemptRepo := repository.NewLoginAttemptRepository(db.Collection(loginAttemptCollectionName))
+	lockoutService := service.NewLockoutService(loginAttemptRepo, service.LockoutPolicyFromEnv())
+	lockoutHandler := handler.NewLockoutHandler(lockoutService)
+	userService := service.NewUserService(repo, tokenService, verificationService, lockoutService)
 	userHandler := handler.NewUserHandler(userService)
+	profileService := service.NewProfileService(repo)
+	profileHandler := handler.NewProfileHandler(profileService)
+	blobStore := storage.NewBlobStoreFromEnv()
+	profileImageService := service.NewProfileImageService(repo, blobStore)
+	profileImageHandler := handler.NewProfileImageHandler(profileImageService)
+	tokenHandler := handler.NewTokenHandler(tokenService)
+
+	oauthClientRepo := repository.NewOAuthClientRepository(db.Collection(oauthClientCollectionName))
+	registerOAuthClients(oauthClientRepo)
+	oauthCodeRepo := repository.NewAuthorizationCodeRepository(db.Collection(oauthCodeCollectionName))
+	mfaService := service.NewMFAService(repo, tokenService, revocationRepo)
+	mfaHandler := handler.NewMFAHandler(mfaService)
+	webAuthnChallengeRepo := repository.NewWebAuthnChallengeRepository(db.Collection(webAuthnCollectionName))
+	webAuthnService := service.NewWebAuthnService(repo, webAuthnChallengeRepo, tokenService)
+	webAuthnHandler := handler.NewWebAuthnHandler(webAuthnService)
+	oauthService := service.NewOAuthService(userService, mfaService, tokenService, oauthClientRepo, oauthCodeRepo)
+	oauthHandler := handler.NewOAuthHandler(oauthService)
+	passwordResetRepo := repository.NewPasswordResetRepository(db.Collection(passwordResetCollectionName))
+	passwordService := service.NewPasswordService(repo, passwordResetRepo, tokenService, mail, lockoutService)
+	passwordHandler := handler.NewPasswordHandler(passwordService)
+	apiKeyRepo := repository.NewAPIKeyRepository(db.Collection(apiKeyCollectionName))
+	apiKeyService := service.NewAPIKeyService(repo, apiKeyRepo)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
+	roleRepo := repository.NewRoleRepository(db.Collection(roleCollectionName))
+	roleService := service.NewRoleService(repo, roleRepo)
+	roleHandler := handler.NewRoleHandler(roleService)
+	bootstrapAdmin(repo)
+	policyEngine := loadPolicyEngine()
+	policyHandler := handler.NewPolicyHandler(policyEngine, userService)
+	wellKnownHandler := handler.NewWellKnownHandler()
 
 	r := router.NewMicroservice()
 	// r.USE(middleware.LoggingMiddleware())
 	r.GET("/healthz", healthz)
+	r.GET("/.well-known/jwks.json", wellKnownHandler.JWKS)
+	r.GET("/.well-known/openid-configuration", wellKnownHandler.OpenIDConfiguration)
 	r.POST("/auth/register", userHandler.Register)
 	r.POST("/auth/login", userHandler.Login)
+	r.POST("/auth/refresh", tokenHandler.Refresh)
+	r.GET("/auth/verify-email", verificationHandler.Verify)
+	r.POST("/auth/verify-email", verificationHandler.Verify)
+	r.POST("/auth/verify-email/resend", verificationHandler.Resend)
+	r.POST("/auth/password/forgot", passwordHandler.Forgot)
+	r.POST("/auth/password/reset", passwordHandler.Reset)
+	r.POST("/auth/mfa/verify", mfaHandler.Verify)
+	r.POST("/auth/webauthn/login/begin", webAuthnHandler.BeginLogin)
+	r.POST("/auth/webauthn/login/finish", webAuthnHandler.FinishLogin)
+	r.GET("/oauth/authorize", oauthHandler.Authorize)
+	r.POST("/oauth/authorize", oauthHandler.AuthorizeLogin)
+	r.POST("/oauth/token", oauthHandler.Token)
+	if servable, ok := blobStore.(storage.Servable); ok {
+		r.STATIC(servable.ServeFrom())
+	}
 
 	// Protected routes
 	{
-		r.USE(middleware.Authorization())
-		r.GET("/profile", userHandler.GetProfile)
+		r.USE(middleware.Authorization(
+			middleware.WithRevocationStore(revocationRepo),
+			middleware.WithPasswordChangeCheck(repo),
+			middleware.WithAPIKeys(apiKeyService),
+			middleware.WithSessions(sessionService),
+		))
+		r.GET("/profile", middleware.RequireScopes(security.ScopeProfile), userHandler.GetProfile)
+		r.PATCH("/profile", middleware.RequireScopes(security.ScopeProfileWrite), userHandler.UpdateProfile)
+		r.GET("/profile/profiles", middleware.RequireScopes(security.ScopeProfile), profileHandler.List)
+		r.PUT("/profile/profiles/:lang", middleware.RequireScopes(security.ScopeProfileWrite), profileHandler.Save)
+		r.DELETE("/profile/profiles/:lang", middleware.RequireScopes(security.ScopeProfileWrite), profileHandler.Delete)
+		r.PUT("/profile/default-language", middleware.RequireScopes(security.ScopeProfileWrite), profileHandler.SetDefault)
+		r.POST("/profile/image", middleware.RequireScopes(security.ScopeProfileWrite), profileImageHandler.Upload)
+		r.GET("/users/:id", middleware.RequireScopes(security.ScopeProfile), middleware.RequirePolicy(policyEngine, model.PermissionUsersRead, middleware.UserResource(userService, "id")), userHandler.GetUser)
+		r.GET("/userinfo", middleware.RequireScopes(security.ScopeOpenID), userHandler.UserInfo)
+		r.PUT("/profile/password", middleware.RequireScopes(security.ScopeProfileWrite), passwordHandler.Change)
+		r.POST("/auth/logout", tokenHandler.Logout)
+		r.GET("/sessions", middleware.RequireScopes(security.ScopeProfile), sessionHandler.List)
+		r.DELETE("/sessions/:id", middleware.RequireScopes(security.ScopeProfileWrite), sessionHandler.Revoke)
+		r.POST("/profile/mfa/totp", middleware.RequireScopes(security.ScopeProfileWrite), mfaHandler.EnrollTOTP)
+		r.POST("/profile/mfa/totp/confirm", middleware.RequireScopes(security.ScopeProfileWrite), mfaHandler.ConfirmTOTP)
+		r.DELETE("/profile/mfa/totp", middleware.RequireScopes(security.ScopeProfileWrite), mfaHandler.DisableTOTP)
+		r.POST("/profile/webauthn/register/begin", middleware.RequireScopes(security.ScopeProfileWrite), webAuthnHandler.BeginRegistration)
+		r.POST("/profile/webauthn/register/finish", middleware.RequireScopes(security.ScopeProfileWrite), webAuthnHandler.FinishRegistration)
+		r.DELETE("/profile/webauthn/credentials/:id", middleware.RequireScopes(security.ScopeProfileWrite), webAuthnHandler.RemoveCredential)
+		r.POST("/profile/api-keys", middleware.RequireScopes(security.ScopeAPIKeys), apiKeyHandler.Create)
+		r.GET("/profile/api-keys", middleware.RequireScopes(security.ScopeAPIKeys), apiKeyHandler.List)
+		r.DELETE("/profile/api-keys/:id", middleware.RequireScopes(security.ScopeAPIKeys), apiKeyHandler.Revoke)
+		r.POST("/admin/lockouts/unlock", middleware.RequirePermission(roleService, model.PermissionLockoutsManage), lockoutHandler.Unlock)
+		r.GET("/admin/roles", middleware.RequirePermission(roleService, model.PermissionRolesManage), roleHandler.List)
+		r.PUT("/admin/roles/:name", middleware.RequirePermission(roleService, model.PermissionRolesManage), roleHandler.Save)
+		r.DELETE("/admin/roles/:name", middleware.RequirePermission(roleService, model.PermissionRolesManage), roleHandler.Delete)
+		r.GET("/admin/users", middleware.RequirePermission(roleService, model.PermissionUsersRead), userHandler.List)
+		r.GET("/admin/users/search", middleware.RequirePermission(roleService, model.PermissionUsersRead), userHandler.Search)
+		r.PUT("/admin/users/:id/role", middleware.RequirePermission(roleService, model.PermissionRolesManage), roleHandler.Assign)
+		r.POST("/admin/policies/explain", middleware.RequirePermission(roleService, model.PermissionPoliciesRead), policyHandler.Explain)
 	}
 
 	// Run server
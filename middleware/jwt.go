@@ -1,20 +1,94 @@
 package middleware
 
 import (
-	"fmt"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/sing3demons/users/constant"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/repository"
 	"github.com/sing3demons/users/router"
 	"github.com/sing3demons/users/security"
 )
 
-func Authorization() router.ServiceHandleFunc {
+// Values of the "authMethod" context key.
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+)
+
+type authOptions struct {
+	revocations repository.IRevocationRepository
+	users       repository.IUserRepository
+	apiKeys     APIKeyAuthenticator
+	sessions    SessionValidator
+}
+
+// APIKeyAuthenticator resolves a presented personal API key to its record.
+type APIKeyAuthenticator interface {
+	Authenticate(session string, key string) (*model.APIKey, error)
+}
+
+// SessionValidator checks that the session a token belongs to is still live.
+type SessionValidator interface {
+	Validate(session string, sid string) error
+}
+
+type AuthOption func(*authOptions)
+
+// WithRevocationStore rejects tokens whose jti has been revoked, e.g. on logout.
+func WithRevocationStore(store repository.IRevocationRepository) AuthOption {
+	return func(o *authOptions) {
+		o.revocations = store
+	}
+}
+
+// WithPasswordChangeCheck rejects user tokens issued before the user's last
+// password change. It costs one lookup per request.
+func WithPasswordChangeCheck(users repository.IUserRepository) AuthOption {
+	return func(o *authOptions) {
+		o.users = users
+	}
+}
+
+// WithAPIKeys also accepts personal API keys, sent either as a Bearer token
+// or in the X-API-Key header.
+func WithAPIKeys(keys APIKeyAuthenticator) AuthOption {
+	return func(o *authOptions) {
+		o.apiKeys = keys
+	}
+}
+
+// WithSessions rejects tokens whose session has been revoked, e.g. from
+// another device. Tokens without a sid claim are not checked.
+func WithSessions(sessions SessionValidator) AuthOption {
+	return func(o *authOptions) {
+		o.sessions = sessions
+	}
+}
+
+func Authorization(opts ...AuthOption) router.ServiceHandleFunc {
+	options := authOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	return func(c router.IContext) {
 		s := c.GetAuthorization()
-		fmt.Println("GetAuthorization++++++++++++++++++>", s)
+
+		if options.apiKeys != nil {
+			key := c.GetHeader(constant.XAPIKey)
+			if bearer := strings.TrimPrefix(s, constant.BEARER); security.IsAPIKey(bearer) {
+				key = bearer
+			}
+			if key != "" {
+				authorizeAPIKey(c, options.apiKeys, key)
+				return
+			}
+		}
+
 		if s == "" {
 			// c.JSON(401, gin.H{"message": "unauthorized"})
 			c.AbortWithStatusJSON(401, gin.H{"message": "unauthorized"})
@@ -40,11 +114,86 @@ func Authorization() router.ServiceHandleFunc {
 			return
 		}
 
-		c.Set("userId", sub)
+		if use, _ := claims["token_use"].(string); use != "" {
+			c.AbortWithStatusJSON(401, gin.H{"message": "unauthorized"})
+			return
+		}
+
+		if options.revocations != nil {
+			jti, _ := claims["jti"].(string)
+			if jti == "" {
+				c.AbortWithStatusJSON(401, gin.H{"message": "unauthorized"})
+				return
+			}
+
+			revoked, err := options.revocations.IsRevoked(c.GetSessionId(), jti)
+			if err != nil || revoked {
+				c.AbortWithStatusJSON(401, gin.H{"message": "unauthorized"})
+				return
+			}
+		}
+
+		if sid, _ := claims["sid"].(string); sid != "" && options.sessions != nil {
+			if err := options.sessions.Validate(c.GetSessionId(), sid); err != nil {
+				c.AbortWithStatusJSON(401, gin.H{"message": "unauthorized"})
+				return
+			}
+		}
+
+		subType, _ := claims["sub_type"].(string)
+
+		if options.users != nil && subType != security.SubjectTypeClient {
+			issuedAt, err := claims.GetIssuedAt()
+			if err != nil || issuedAt == nil {
+				c.AbortWithStatusJSON(401, gin.H{"message": "unauthorized"})
+				return
+			}
+
+			// iat has second precision; tokens issued in the same second as
+			// the change, such as those returned by it, stay valid.
+			changedAt, err := options.users.PasswordChangedAt(c.GetSessionId(), sub)
+			if err != nil || (changedAt != nil && issuedAt.Unix() < changedAt.Unix()) {
+				c.AbortWithStatusJSON(401, gin.H{"message": "unauthorized"})
+				return
+			}
+		}
+
+		// Client credential tokens act for the client, never for a user, so
+		// user-scoped handlers that read userId reject them.
+		if subType == security.SubjectTypeClient {
+			c.Set("clientId", sub)
+		} else {
+			c.Set("userId", sub)
+		}
+		c.Set("subjectType", subType)
+		c.Set("authMethod", AuthMethodJWT)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
 
+// authorizeAPIKey sets the same context values as a user JWT would, with
+// claims synthesised from the key so scope checks work unchanged.
+func authorizeAPIKey(c router.IContext, keys APIKeyAuthenticator, key string) {
+	record, err := keys.Authenticate(c.GetSessionId(), key)
+	if err != nil {
+		c.AbortWithStatusJSON(401, gin.H{"message": "unauthorized"})
+		return
+	}
+
+	c.Set("userId", record.UserID)
+	c.Set("subjectType", security.SubjectTypeUser)
+	c.Set("authMethod", AuthMethodAPIKey)
+	c.Set("apiKeyId", record.ID.Hex())
+	c.Set("claims", jwt.MapClaims{
+		"sub":      record.UserID,
+		"sub_type": security.SubjectTypeUser,
+		"scope":    strings.Join(record.Scopes, " "),
+		"tenant":   record.Tenant,
+	})
+	c.Next()
+}
+
 func Authorization2() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		s := c.Request.Header.Get("Authorization")
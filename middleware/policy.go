@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/policy"
+	"github.com/sing3demons/users/router"
+	logger "github.com/sirupsen/logrus"
+)
+
+// ResourceLoader returns the resource.* attributes for the request, or
+// policy.ErrResourceNotFound.
+type ResourceLoader func(c router.IContext) (map[string]any, error)
+
+// UserLoader finds the users that UserResource exposes to policies.
+type UserLoader interface {
+	GetProfile(session string, userId string) (*model.User, error)
+}
+
+// UserResource loads the user whose id is in the path parameter param.
+func UserResource(users UserLoader, param string) ResourceLoader {
+	return func(c router.IContext) (map[string]any, error) {
+		user, err := users.GetProfile(c.GetSessionId(), c.Param(param))
+		if err != nil {
+			return nil, policy.ErrResourceNotFound
+		}
+		return policy.UserAttributes(*user), nil
+	}
+}
+
+// RequirePolicy evaluates action against the engine's policies. resource may
+// be nil for actions that are not about a particular resource. In dry-run
+// mode a deny is only logged.
+func RequirePolicy(engine policy.IEngine, action string, resource ResourceLoader) router.ServiceHandleFunc {
+	return func(c router.IContext) {
+		session := c.GetSessionId()
+
+		input := PolicyInput(c, engine, action)
+		if resource != nil {
+			attributes, err := resource(c)
+			if errors.Is(err, policy.ErrResourceNotFound) {
+				c.AbortWithStatusJSON(404, gin.H{"message": "not found"})
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(500, gin.H{"message": "internal server error"})
+				return
+			}
+			input.Resource = attributes
+		}
+
+		decision := engine.Evaluate(input)
+
+		fields := logger.Fields{
+			"uuid":     session,
+			"func":     "RequirePolicy",
+			"file":     "middleware/policy.go",
+			"tag":      "policy",
+			"action":   action,
+			"allowed":  decision.Allowed,
+			"policyId": decision.PolicyID,
+			"reason":   decision.Reason,
+		}
+
+		if decision.Allowed {
+			logger.WithFields(fields).Debug("policy allowed")
+			c.Next()
+			return
+		}
+
+		if decision.DryRun {
+			logger.WithFields(fields).WithField("trace", decision.Trace).Warn("policy would deny (dry run)")
+			c.Next()
+			return
+		}
+
+		logger.WithFields(fields).WithField("trace", decision.Trace).Info("policy denied")
+
+		body := gin.H{
+			"message": "forbidden",
+			"error":   "policy_denied",
+		}
+		if engine.Explain() {
+			body["decision"] = decision.Redacted()
+		}
+		c.AbortWithStatusJSON(403, body)
+	}
+}
+
+// PolicyInput builds the subject and request attributes for the current
+// request; the subject is the token's claims.
+func PolicyInput(c router.IContext, engine policy.IEngine, action string) policy.Input {
+	subject := map[string]any{}
+	if value, ok := c.Get("claims"); ok {
+		if claims, ok := value.(jwt.MapClaims); ok {
+			for k, v := range claims {
+				subject[k] = v
+			}
+		}
+	}
+	if method, ok := c.Get("authMethod"); ok {
+		subject["auth_method"] = method
+	}
+
+	ip, _ := c.GetHeaders()["client_ip"].(string)
+
+	return policy.Input{
+		Action:   action,
+		Subject:  subject,
+		Resource: map[string]any{},
+		Request:  engine.RequestAttributes(c.Method(), c.FullPath(), ip, time.Now()),
+	}
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/router"
+)
+
+// PermissionResolver expands role names into permissions.
+type PermissionResolver interface {
+	Permissions(session string, roles []string) ([]string, error)
+}
+
+// RequireRole lets the request through if the token carries any of roles.
+func RequireRole(roles ...string) router.ServiceHandleFunc {
+	return func(c router.IContext) {
+		granted := claimRoles(c)
+		for _, role := range roles {
+			for _, g := range granted {
+				if g == role {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		c.AbortWithStatusJSON(403, gin.H{
+			"message": "forbidden",
+			"error":   "insufficient_role",
+		})
+	}
+}
+
+// RequirePermission lets the request through if the token's roles grant
+// every one of permissions. A "resource:*" or "*" permission covers all
+// actions on that resource or everything. Only first-party user tokens carry
+// roles; OAuth client tokens and API keys never pass.
+func RequirePermission(resolver PermissionResolver, permissions ...string) router.ServiceHandleFunc {
+	return func(c router.IContext) {
+		granted, err := resolver.Permissions(c.GetSessionId(), claimRoles(c))
+		if err != nil {
+			c.AbortWithStatusJSON(500, gin.H{"message": "internal server error"})
+			return
+		}
+
+		for _, permission := range permissions {
+			if !permits(granted, permission) {
+				c.AbortWithStatusJSON(403, gin.H{
+					"message":    "forbidden",
+					"error":      "insufficient_permission",
+					"permission": permission,
+				})
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func permits(granted []string, permission string) bool {
+	resource, _, _ := strings.Cut(permission, ":")
+	for _, g := range granted {
+		if g == model.PermissionAll || g == permission || g == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// claimRoles reads the roles claim set by Authorization. Client tokens have
+// none.
+func claimRoles(c router.IContext) []string {
+	value, ok := c.Get("claims")
+	if !ok {
+		return nil
+	}
+	claims, ok := value.(jwt.MapClaims)
+	if !ok {
+		return nil
+	}
+
+	var roles []string
+	switch v := claims["roles"].(type) {
+	case []any:
+		for _, r := range v {
+			if s, ok := r.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+	case []string:
+		roles = v
+	}
+	return roles
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sing3demons/users/router"
+	"github.com/sing3demons/users/security"
+)
+
+// RequireScopes lets the request through only if the token authenticated by
+// Authorization was granted every one of scopes. Otherwise it answers 403
+// insufficient_scope, as RFC 6750 describes.
+func RequireScopes(scopes ...string) router.ServiceHandleFunc {
+	return func(c router.IContext) {
+		var granted []string
+		if value, ok := c.Get("claims"); ok {
+			if claims, ok := value.(jwt.MapClaims); ok {
+				granted = security.ClaimScopes(claims)
+			}
+		}
+
+		if missing := security.MissingScopes(granted, scopes...); len(missing) > 0 {
+			required := security.JoinScopes(scopes)
+			c.SetHeader("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, required))
+			c.AbortWithStatusJSON(403, gin.H{
+				"message": "insufficient scope",
+				"error":   "insufficient_scope",
+				"scope":   required,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
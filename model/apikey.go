@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKey is a long-lived personal credential. Only a hash of the secret is
+// stored; Prefix is the non-secret part used to find the record.
+type APIKey struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID     string             `json:"-" bson:"userId"`
+	Name       string             `json:"name" bson:"name"`
+	Prefix     string             `json:"prefix" bson:"prefix"`
+	KeyHash    string             `json:"-" bson:"keyHash"`
+	Scopes     []string           `json:"scopes,omitempty" bson:"scopes,omitempty"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt  *time.Time         `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	LastUsedAt *time.Time         `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	RevokedAt  *time.Time         `json:"-" bson:"revoked_at,omitempty"`
+
+	// Tenant is the owner's current value, filled in on authentication.
+	// Keys never carry the owner's role, so they cannot reach /admin.
+	Tenant string `json:"-" bson:"-"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+	// Scope is space separated, as in OAuth. Empty means the default scopes.
+	Scope         string `json:"scope"`
+	ExpiresInDays int    `json:"expires_in_days"`
+	// Granted is the scope of the caller's token, which a key cannot exceed.
+	Granted []string `json:"-"`
+}
+
+// CreatedAPIKey is returned once, on creation; Key is never shown again.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// LoginAttempt counts recent failed logins for one key, either an account
+// ("account:<email>") or a client address ("ip:<addr>").
+type LoginAttempt struct {
+	ID            string     `json:"id" bson:"_id"`
+	Failures      int        `json:"failures" bson:"failures"`
+	LastFailureAt time.Time  `json:"lastFailureAt" bson:"last_failure_at"`
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty" bson:"locked_until,omitempty"`
+	ExpiresAt     time.Time  `json:"-" bson:"expires_at"`
+}
+
+type UnlockRequest struct {
+	Email    string `json:"email"`
+	ClientIP string `json:"client_ip"`
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+type MFA struct {
+	Enabled           bool       `json:"enabled" bson:"enabled"`
+	EnabledAt         *time.Time `json:"enabledAt,omitempty" bson:"enabledAt,omitempty"`
+	TOTPSecret        string     `json:"-" bson:"totpSecret,omitempty"`
+	PendingTOTPSecret string     `json:"-" bson:"pendingTotpSecret,omitempty"`
+	LastUsedStep      int64      `json:"-" bson:"lastUsedStep,omitempty"`
+	RecoveryCodes     []string   `json:"-" bson:"recoveryCodes,omitempty"`
+	FailedAttempts    int        `json:"-" bson:"failedAttempts,omitempty"`
+	LockedUntil       *time.Time `json:"-" bson:"lockedUntil,omitempty"`
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type MFACode struct {
+	Code string `json:"code"`
+}
+
+// MFAVerifyRequest accepts either a TOTP code or a recovery code.
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	Device       Device `json:"-"`
+}
@@ -18,6 +18,13 @@ type CommonModel struct {
 	Status    string             `json:"status,omitempty" bson:"status,omitempty"`
 }
 
+// User.Status values. Users created before verification existed have no
+// status and are treated as active.
+const (
+	UserStatusPending = "pending"
+	UserStatusActive  = "active"
+)
+
 type User struct {
 	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
 	Href      string             `json:"href,omitempty" bson:"href,omitempty"`
@@ -32,10 +39,27 @@ type User struct {
 	Password string `json:"password,omitempty" bson:"password,omitempty"`
 
 	Role         string    `json:"role,omitempty" bson:"role,omitempty"`
+	Tenant       string    `json:"tenant,omitempty" bson:"tenant,omitempty"`
 	ProfileImage string    `json:"profileImage,omitempty" bson:"profileImage,omitempty"`
 	Gender       string    `json:"gender,omitempty" bson:"gender,omitempty"`
 	Birthday     string    `json:"birthday,omitempty" bson:"birthday,omitempty"`
 	Profiles     []Profile `json:"profiles,omitempty" bson:"profiles,omitempty"`
+	// DefaultLanguage names the profile used when none matches the
+	// request's Accept-Language.
+	DefaultLanguage string `json:"defaultLanguage,omitempty" bson:"defaultLanguage,omitempty"`
+	MFA             *MFA   `json:"mfa,omitempty" bson:"mfa,omitempty"`
+
+	// ProfileImageThumbnails are square renditions of an uploaded
+	// ProfileImage, keyed by their size in pixels. ProfileImageKeys are the
+	// blob store keys of that upload, deleted when it is replaced.
+	ProfileImageThumbnails map[string]string `json:"profileImageThumbnails,omitempty" bson:"profileImageThumbnails,omitempty"`
+	ProfileImageKeys       []string          `json:"-" bson:"profileImageKeys,omitempty"`
+
+	PasswordChangedAt  *time.Time `json:"passwordChangedAt,omitempty" bson:"passwordChangedAt,omitempty"`
+	EmailVerifiedAt    *time.Time `json:"emailVerifiedAt,omitempty" bson:"emailVerifiedAt,omitempty"`
+	VerificationSentAt *time.Time `json:"-" bson:"verificationSentAt,omitempty"`
+
+	WebAuthnCredentials []WebAuthnCredential `json:"webauthnCredentials,omitempty" bson:"webauthnCredentials,omitempty"`
 }
 
 type Profile struct {
@@ -50,9 +74,15 @@ type Profile struct {
 
 type IUser struct{}
 
+// Login accepts an Identifier that is either an email or a username. Email
+// is still honoured for clients that predate Identifier.
 type Login struct {
-	Email    string
-	Password string
+	Identifier string
+	Email      string
+	Password   string
+	Scope      string
+	ClientIP   string `json:"-"`
+	Device     Device `json:"-"`
 }
 
 type Register struct {
@@ -62,6 +92,9 @@ type Register struct {
 	LastName string `json:"lastName,omitempty" bson:"lastName,omitempty"`
 	NickName string `json:"nickname,omitempty" bson:"nickname,omitempty"`
 	Password string `json:"password" bson:"password"`
+	// LanguageCode is the language of the names above, and the account's
+	// default language.
+	LanguageCode string `json:"languageCode,omitempty" bson:"languageCode,omitempty"`
 }
 
 func MaskEmail(email string) string {
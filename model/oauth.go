@@ -0,0 +1,89 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OAuthClient struct {
+	ID           primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	ClientID     string             `json:"client_id" bson:"clientId"`
+	Name         string             `json:"name,omitempty" bson:"name,omitempty"`
+	RedirectURIs []string           `json:"redirect_uris,omitempty" bson:"redirectUris,omitempty"`
+	Scopes       []string           `json:"scopes,omitempty" bson:"scopes,omitempty"`
+	GrantTypes   []string           `json:"grant_types,omitempty" bson:"grantTypes,omitempty"`
+	SecretHash   string             `json:"-" bson:"secretHash,omitempty"`
+	CreatedAt    time.Time          `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	UpdatedAt    time.Time          `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+
+	// Secret is only read from configuration and is hashed before storage.
+	Secret string `json:"client_secret,omitempty" bson:"-"`
+}
+
+// Confidential clients authenticate with a secret at the token endpoint.
+func (c OAuthClient) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+func (c OAuthClient) AllowsGrant(grantType string) bool {
+	if len(c.GrantTypes) == 0 {
+		return grantType == "authorization_code" || grantType == "refresh_token"
+	}
+	for _, g := range c.GrantTypes {
+		if g == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+type AuthorizationCode struct {
+	ID            primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	CodeHash      string             `json:"-" bson:"codeHash"`
+	ClientID      string             `json:"client_id" bson:"clientId"`
+	UserID        string             `json:"userId" bson:"userId"`
+	RedirectURI   string             `json:"redirect_uri" bson:"redirectUri"`
+	Scopes        []string           `json:"scopes,omitempty" bson:"scopes,omitempty"`
+	Nonce         string             `json:"nonce,omitempty" bson:"nonce,omitempty"`
+	CodeChallenge string             `json:"-" bson:"codeChallenge"`
+	AuthTime      time.Time          `json:"auth_time" bson:"auth_time"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt     time.Time          `json:"expires_at" bson:"expires_at"`
+	UsedAt        *time.Time         `json:"used_at,omitempty" bson:"used_at,omitempty"`
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type" form:"response_type"`
+	ClientID            string `json:"client_id" form:"client_id"`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri"`
+	Scope               string `json:"scope" form:"scope"`
+	State               string `json:"state" form:"state"`
+	Nonce               string `json:"nonce" form:"nonce"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method"`
+}
+
+// AuthorizeLogin is posted by the hosted login page: the original
+// authorization request plus the user's credentials.
+type AuthorizeLogin struct {
+	AuthorizeRequest
+	Identifier   string `json:"identifier" form:"identifier"`
+	Email        string `json:"email" form:"email"`
+	Password     string `json:"password" form:"password"`
+	Code         string `json:"code" form:"code"`
+	RecoveryCode string `json:"recovery_code" form:"recovery_code"`
+	ClientIP     string `json:"-" form:"-"`
+}
+
+type TokenRequest struct {
+	GrantType    string `json:"grant_type" form:"grant_type"`
+	Code         string `json:"code" form:"code"`
+	RedirectURI  string `json:"redirect_uri" form:"redirect_uri"`
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+	CodeVerifier string `json:"code_verifier" form:"code_verifier"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+	Scope        string `json:"scope" form:"scope"`
+	Device       Device `json:"-" form:"-"`
+}
@@ -0,0 +1,36 @@
+package model
+
+// Genders accepted on a profile.
+var Genders = []string{"male", "female", "other", "prefer_not_to_say"}
+
+// ProfilePatch is a validated PATCH /profile. A nil field is left as is and
+// a field pointing at "" is removed, which is how a JSON null in the merge
+// patch arrives.
+type ProfilePatch struct {
+	Username     *string
+	Gender       *string
+	Birthday     *string
+	ProfileImage *string
+}
+
+func (p ProfilePatch) Empty() bool {
+	return p.Username == nil && p.Gender == nil && p.Birthday == nil && p.ProfileImage == nil
+}
+
+// ProfileRequest is the body of PUT /profile/profiles/:lang.
+type ProfileRequest struct {
+	Prefix    string `json:"prefix"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	NickName  string `json:"nickname"`
+}
+
+type DefaultLanguageRequest struct {
+	LanguageCode string `json:"languageCode"`
+}
+
+// ProfileImage is the result of an upload to POST /profile/image.
+type ProfileImage struct {
+	URL        string            `json:"profileImage"`
+	Thumbnails map[string]string `json:"profileImageThumbnails"`
+}
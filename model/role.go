@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+// Built-in role names. A user with no Role is treated as RoleUser.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Permissions checked by RequirePermission. PermissionAll grants everything.
+const (
+	PermissionAll            = "*"
+	PermissionUsersRead      = "users:read"
+	PermissionUsersWrite     = "users:write"
+	PermissionRolesManage    = "roles:manage"
+	PermissionLockoutsManage = "lockouts:manage"
+	PermissionPoliciesRead   = "policies:read"
+)
+
+type Role struct {
+	Name        string    `json:"name" bson:"_id"`
+	Description string    `json:"description,omitempty" bson:"description,omitempty"`
+	Permissions []string  `json:"permissions" bson:"permissions"`
+	BuiltIn     bool      `json:"built_in" bson:"-"`
+	CreatedAt   time.Time `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// RoleName is the user's role, defaulting to RoleUser for accounts created
+// before roles were assigned.
+func (u User) RoleName() string {
+	if u.Role == "" {
+		return RoleUser
+	}
+	return u.Role
+}
+
+// ExplainPolicyRequest asks how the policy engine would decide Action.
+// Subject defaults to the caller's claims, Resource to the user UserID and
+// Request to the current request; Request keys override individually.
+type ExplainPolicyRequest struct {
+	Action   string         `json:"action"`
+	UserID   string         `json:"user_id,omitempty"`
+	Subject  map[string]any `json:"subject,omitempty"`
+	Resource map[string]any `json:"resource,omitempty"`
+	Request  map[string]any `json:"request,omitempty"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// Device describes where a session was started, taken from the login
+// request's headers.
+type Device struct {
+	UserAgent string `json:"user_agent,omitempty" bson:"userAgent,omitempty"`
+	IPAddress string `json:"ip_address,omitempty" bson:"ipAddress,omitempty"`
+	Platform  string `json:"platform,omitempty" bson:"platform,omitempty"`
+	Mobile    bool   `json:"mobile,omitempty" bson:"mobile,omitempty"`
+}
+
+// Session is one login on one device. Its ID is the "sid" claim of every
+// access token issued for it and the family id of its refresh tokens, so
+// revoking it ends both.
+type Session struct {
+	ID         string     `json:"id" bson:"_id"`
+	UserID     string     `json:"-" bson:"userId"`
+	ClientID   string     `json:"client_id,omitempty" bson:"clientId,omitempty"`
+	Device     Device     `json:"device" bson:"device"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at" bson:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at" bson:"expires_at"`
+	RevokedAt  *time.Time `json:"-" bson:"revoked_at,omitempty"`
+
+	// Current marks the session the listing request was made with.
+	Current bool `json:"current" bson:"-"`
+}
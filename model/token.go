@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// Grant describes what a token is issued for: the scopes the user consented
+// to, for OIDC clients the audience and replay nonce, and the device a new
+// session is started on.
+type Grant struct {
+	Scopes   []string
+	ClientID string
+	Nonce    string
+	AuthTime time.Time
+	Device   Device
+}
+
+type RefreshToken struct {
+	ID         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	TokenHash  string             `json:"-" bson:"tokenHash"`
+	UserID     string             `json:"userId,omitempty" bson:"userId"`
+	FamilyID   string             `json:"familyId,omitempty" bson:"familyId"`
+	ClientID   string             `json:"clientId,omitempty" bson:"clientId,omitempty"`
+	Scopes     []string           `json:"scopes,omitempty" bson:"scopes,omitempty"`
+	AuthTime   time.Time          `json:"auth_time,omitempty" bson:"auth_time,omitempty"`
+	ReplacedBy string             `json:"replacedBy,omitempty" bson:"replacedBy,omitempty"`
+	CreatedAt  time.Time          `json:"created_at,omitempty" bson:"created_at"`
+	ExpiresAt  time.Time          `json:"expires_at,omitempty" bson:"expires_at"`
+	RotatedAt  *time.Time         `json:"rotated_at,omitempty" bson:"rotated_at,omitempty"`
+	RevokedAt  *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserListQuery is GET /admin/users as received, before validation.
+type UserListQuery struct {
+	Status       string
+	Role         string
+	CreatedFrom  string
+	CreatedTo    string
+	EmailDomain  string
+	Sort         string
+	Cursor       string
+	Limit        int
+	IncludeTotal bool
+}
+
+// UserFilter narrows a user listing. Zero values do not filter.
+type UserFilter struct {
+	Status      string
+	Role        string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	EmailDomain string
+}
+
+type UserSort struct {
+	Field string
+	Desc  bool
+}
+
+// UserCursor is the position after the last user of a page. Value is nil
+// when that user has no value for the sort field.
+type UserCursor struct {
+	Value any
+	ID    primitive.ObjectID
+}
+
+type UserPage struct {
+	Users      []User `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+// UserSearch is a free-text lookup for support staff.
+type UserSearch struct {
+	Text  string
+	Limit int
+}
+
+// UserSearchResult is a matched user and its relevance; higher is better.
+type UserSearchResult struct {
+	User  `bson:",inline"`
+	Score float64 `json:"score" bson:"score"`
+}
@@ -0,0 +1,99 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WebAuthnCredential struct {
+	ID              string     `json:"id" bson:"id"`
+	Name            string     `json:"name,omitempty" bson:"name,omitempty"`
+	PublicKey       []byte     `json:"-" bson:"publicKey"`
+	Algorithm       int64      `json:"alg" bson:"alg"`
+	SignCount       int64      `json:"-" bson:"signCount"`
+	AAGUID          string     `json:"aaguid,omitempty" bson:"aaguid,omitempty"`
+	AttestationType string     `json:"attestationType,omitempty" bson:"attestationType,omitempty"`
+	Transports      []string   `json:"transports,omitempty" bson:"transports,omitempty"`
+	CreatedAt       time.Time  `json:"created_at" bson:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+}
+
+type WebAuthnChallenge struct {
+	ID            primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	ChallengeHash string             `json:"-" bson:"challengeHash"`
+	Ceremony      string             `json:"ceremony" bson:"ceremony"`
+	UserID        string             `json:"userId,omitempty" bson:"userId,omitempty"`
+	ExpiresAt     time.Time          `json:"expires_at" bson:"expires_at"`
+}
+
+type WebAuthnRelyingParty struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+type WebAuthnUserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type WebAuthnCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type WebAuthnCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type WebAuthnAuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// WebAuthnCreationOptions mirrors PublicKeyCredentialCreationOptionsJSON;
+// binary values are base64url encoded.
+type WebAuthnCreationOptions struct {
+	Challenge              string                         `json:"challenge"`
+	RP                     WebAuthnRelyingParty           `json:"rp"`
+	User                   WebAuthnUserEntity             `json:"user"`
+	PubKeyCredParams       []WebAuthnCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                          `json:"timeout"`
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection WebAuthnAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                         `json:"attestation"`
+}
+
+// WebAuthnRequestOptions mirrors PublicKeyCredentialRequestOptionsJSON.
+type WebAuthnRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	RPID             string                         `json:"rpId"`
+	Timeout          int64                          `json:"timeout"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+// WebAuthnCredentialResponse is a PublicKeyCredential serialized with
+// toJSON(): binary members are base64url strings.
+type WebAuthnCredentialResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Name     string `json:"name,omitempty"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject,omitempty"`
+		AuthenticatorData string   `json:"authenticatorData,omitempty"`
+		Signature         string   `json:"signature,omitempty"`
+		UserHandle        string   `json:"userHandle,omitempty"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+	Device Device `json:"-"`
+}
+
+type WebAuthnLoginRequest struct {
+	Email string `json:"email"`
+}
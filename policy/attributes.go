@@ -0,0 +1,29 @@
+package policy
+
+import (
+	"strings"
+
+	"github.com/sing3demons/users/model"
+)
+
+// UserAttributes exposes a user as resource.* attributes. Credentials and
+// MFA secrets are deliberately left out.
+func UserAttributes(user model.User) map[string]any {
+	_, domain, _ := strings.Cut(user.Email, "@")
+
+	return map[string]any{
+		"type":           "user",
+		"id":             user.ID.Hex(),
+		"email":          user.Email,
+		"email_domain":   strings.ToLower(domain),
+		"email_verified": user.EmailVerifiedAt != nil,
+		"username":       user.Username,
+		"role":           user.RoleName(),
+		"status":         user.Status,
+		"tenant":         user.Tenant,
+		"gender":         user.Gender,
+		"birthday":       user.Birthday,
+		"mfa_enabled":    user.MFA != nil && user.MFA.Enabled,
+		"created_at":     user.CreatedAt.Unix(),
+	}
+}
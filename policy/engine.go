@@ -0,0 +1,417 @@
+package policy
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Input is everything a decision may look at. Attribute paths in conditions
+// start with "subject.", "resource." or "request.".
+type Input struct {
+	Action   string         `json:"action"`
+	Subject  map[string]any `json:"subject"`
+	Resource map[string]any `json:"resource"`
+	Request  map[string]any `json:"request"`
+}
+
+type Decision struct {
+	Allowed  bool          `json:"allowed"`
+	DryRun   bool          `json:"dry_run,omitempty"`
+	PolicyID string        `json:"policy_id,omitempty"`
+	Reason   string        `json:"reason"`
+	Trace    []PolicyTrace `json:"trace,omitempty"`
+}
+
+// PolicyTrace explains how one policy was evaluated.
+type PolicyTrace struct {
+	ID            string           `json:"id"`
+	Effect        string           `json:"effect"`
+	ActionMatched bool             `json:"action_matched"`
+	Matched       bool             `json:"matched"`
+	Conditions    []ConditionTrace `json:"conditions,omitempty"`
+}
+
+type ConditionTrace struct {
+	Attr     string `json:"attr"`
+	Op       string `json:"op"`
+	Ref      string `json:"ref,omitempty"`
+	Actual   any    `json:"actual"`
+	Expected any    `json:"expected"`
+	Result   bool   `json:"result"`
+	Redacted bool   `json:"redacted,omitempty"`
+}
+
+// Redacted is the decision as it may be shown to the caller: conditions on
+// resource.* attributes keep their result but lose their values, so a denied
+// caller cannot read the resource through the trace.
+func (d Decision) Redacted() Decision {
+	trace := make([]PolicyTrace, len(d.Trace))
+	for i, p := range d.Trace {
+		conditions := make([]ConditionTrace, len(p.Conditions))
+		for j, c := range p.Conditions {
+			if isResource(c.Attr) || isResource(c.Ref) {
+				c.Actual, c.Expected, c.Redacted = nil, nil, true
+			}
+			conditions[j] = c
+		}
+		p.Conditions = conditions
+		trace[i] = p
+	}
+	d.Trace = trace
+	return d
+}
+
+func isResource(path string) bool {
+	return path == "resource" || strings.HasPrefix(path, "resource.")
+}
+
+type IEngine interface {
+	Evaluate(input Input) Decision
+	// DryRun reports whether decisions should only be logged.
+	DryRun() bool
+	// Explain reports whether denials may include their trace.
+	Explain() bool
+	// RequestAttributes builds the request.* attributes in the policy's
+	// time zone.
+	RequestAttributes(method, path, clientIP string, now time.Time) map[string]any
+}
+
+type engine struct {
+	doc      Document
+	location *time.Location
+}
+
+func NewEngine(doc Document) (IEngine, error) {
+	if err := doc.validate(); err != nil {
+		return nil, err
+	}
+
+	location := time.UTC
+	if doc.Timezone != "" {
+		loc, err := time.LoadLocation(doc.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("policy: %w", err)
+		}
+		location = loc
+	}
+
+	return &engine{doc: doc, location: location}, nil
+}
+
+func (e *engine) DryRun() bool {
+	return e.doc.Mode == ModeDryRun
+}
+
+func (e *engine) Explain() bool {
+	return e.doc.Explain
+}
+
+func (e *engine) RequestAttributes(method, path, clientIP string, now time.Time) map[string]any {
+	local := now.In(e.location)
+	return map[string]any{
+		"method":    method,
+		"path":      path,
+		"client_ip": clientIP,
+		"time": map[string]any{
+			"hour":    local.Hour(),
+			"minute":  local.Minute(),
+			"weekday": strings.ToLower(local.Weekday().String()[:3]),
+			"date":    local.Format("2006-01-02"),
+			"unix":    local.Unix(),
+		},
+	}
+}
+
+// Evaluate applies deny-overrides: any matching deny wins, then any matching
+// allow, and otherwise the request is denied. Every policy is evaluated so
+// the trace is complete.
+func (e *engine) Evaluate(input Input) Decision {
+	decision := Decision{DryRun: e.DryRun(), Reason: "no policy allows " + input.Action}
+	var allowedBy, deniedBy string
+
+	for _, p := range e.doc.Policies {
+		trace := PolicyTrace{ID: p.ID, Effect: p.Effect, ActionMatched: matchAction(p.Actions, input.Action)}
+		if trace.ActionMatched {
+			trace.Matched = e.eval(p.When, input, &trace.Conditions)
+		}
+		decision.Trace = append(decision.Trace, trace)
+
+		if !trace.Matched {
+			continue
+		}
+		if p.Effect == EffectDeny && deniedBy == "" {
+			deniedBy = p.ID
+		}
+		if p.Effect == EffectAllow && allowedBy == "" {
+			allowedBy = p.ID
+		}
+	}
+
+	switch {
+	case deniedBy != "":
+		decision.PolicyID = deniedBy
+		decision.Reason = "denied by " + deniedBy
+	case allowedBy != "":
+		decision.Allowed = true
+		decision.PolicyID = allowedBy
+		decision.Reason = "allowed by " + allowedBy
+	}
+
+	return decision
+}
+
+func (e *engine) eval(c Condition, input Input, trace *[]ConditionTrace) bool {
+	for _, sub := range c.All {
+		if !e.eval(sub, input, trace) {
+			return false
+		}
+	}
+
+	if len(c.Any) > 0 {
+		matched := false
+		for _, sub := range c.Any {
+			if e.eval(sub, input, trace) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if c.Not != nil && e.eval(*c.Not, input, trace) {
+		return false
+	}
+
+	if c.Attr == "" {
+		return true
+	}
+
+	actual := resolve(input, c.Attr)
+	expected := c.Value
+	if c.Ref != "" {
+		expected = resolve(input, c.Ref)
+	}
+
+	result := operators[c.Op](actual, expected)
+	*trace = append(*trace, ConditionTrace{
+		Attr:     c.Attr,
+		Op:       c.Op,
+		Ref:      c.Ref,
+		Actual:   actual,
+		Expected: expected,
+		Result:   result,
+	})
+	return result
+}
+
+func matchAction(patterns []string, action string) bool {
+	for _, p := range patterns {
+		if p == "*" || p == action {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(p, "*"); ok && strings.HasPrefix(action, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve looks up a dotted path such as "resource.profile.tenant".
+func resolve(input Input, path string) any {
+	root, rest, _ := strings.Cut(path, ".")
+
+	var current any
+	switch root {
+	case "subject":
+		current = input.Subject
+	case "resource":
+		current = input.Resource
+	case "request":
+		current = input.Request
+	case "action":
+		return input.Action
+	default:
+		return nil
+	}
+
+	if rest == "" {
+		return current
+	}
+	for _, key := range strings.Split(rest, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
+
+// operators compare an attribute with the expected value. eq needs the
+// attribute to be present, while ne and not_in hold when it is missing: that
+// is what a deny policy wants, and an allow policy should pair them with
+// exists.
+var operators = map[string]func(actual, expected any) bool{
+	"eq":     func(a, e any) bool { return a != nil && equal(a, e) },
+	"ne":     func(a, e any) bool { return !equal(a, e) },
+	"in":     func(a, e any) bool { return overlaps(listOf(a), listOf(e)) },
+	"not_in": func(a, e any) bool { return !overlaps(listOf(a), listOf(e)) },
+	"contains": func(a, e any) bool {
+		if s, ok := a.(string); ok {
+			es, ok := e.(string)
+			return ok && strings.Contains(s, es)
+		}
+		return overlaps(listOf(a), []any{e})
+	},
+	"prefix": func(a, e any) bool {
+		s, ok1 := a.(string)
+		p, ok2 := e.(string)
+		return ok1 && ok2 && strings.HasPrefix(s, p)
+	},
+	"suffix": func(a, e any) bool {
+		s, ok1 := a.(string)
+		p, ok2 := e.(string)
+		return ok1 && ok2 && strings.HasSuffix(s, p)
+	},
+	"exists": func(a, e any) bool {
+		want, ok := e.(bool)
+		if !ok {
+			want = true
+		}
+		return (a != nil) == want
+	},
+	"gt":  compare(func(c int) bool { return c > 0 }),
+	"gte": compare(func(c int) bool { return c >= 0 }),
+	"lt":  compare(func(c int) bool { return c < 0 }),
+	"lte": compare(func(c int) bool { return c <= 0 }),
+	// between is half-open: [9, 17] on request.time.hour is 09:00-16:59.
+	"between": func(a, e any) bool {
+		bounds := listOf(e)
+		if len(bounds) != 2 {
+			return false
+		}
+		lo, ok1 := cmp(a, bounds[0])
+		hi, ok2 := cmp(a, bounds[1])
+		return ok1 && ok2 && lo >= 0 && hi < 0
+	},
+}
+
+func compare(test func(int) bool) func(a, e any) bool {
+	return func(a, e any) bool {
+		c, ok := cmp(a, e)
+		return ok && test(c)
+	}
+}
+
+// cmp orders numbers numerically and strings lexically.
+func cmp(a, b any) (int, bool) {
+	if x, y, ok := numbers(a, b); ok {
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	if isNumber(a) || isNumber(b) {
+		return 0, false
+	}
+
+	x, ok1 := a.(string)
+	y, ok2 := b.(string)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	return strings.Compare(x, y), true
+}
+
+func equal(a, b any) bool {
+	if isNumber(a) || isNumber(b) {
+		x, y, ok := numbers(a, b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// numbers converts a and b for a numeric comparison. A string is only read
+// as a number when the other side is one, so ids and tenants such as "007"
+// and "7" still compare as the strings they are.
+func numbers(a, b any) (float64, float64, bool) {
+	x, okA := number(a)
+	y, okB := number(b)
+	switch {
+	case okA && okB:
+		return x, y, true
+	case okA:
+		y, okB = numericString(b)
+		return x, y, okB
+	case okB:
+		x, okA = numericString(a)
+		return x, y, okA
+	}
+	return 0, 0, false
+}
+
+func isNumber(v any) bool {
+	_, ok := number(v)
+	return ok
+}
+
+// number accepts the numeric types YAML, JSON and Go callers produce.
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func numericString(v any) (float64, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+func listOf(v any) []any {
+	switch l := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		return l
+	case []string:
+		out := make([]any, len(l))
+		for i, s := range l {
+			out[i] = s
+		}
+		return out
+	}
+	return []any{v}
+}
+
+func overlaps(a, b []any) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if equal(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,347 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		op       string
+		actual   any
+		expected any
+		want     bool
+	}{
+		{"eq", "a", "a", true},
+		{"eq", "a", "b", false},
+		{"eq", 7, 7.0, true},
+		{"eq", int64(7), "7", true},
+		{"eq", 1000.0, "1e3", true},
+		{"eq", "007", "7", false},
+		{"eq", "1e3", "1000", false},
+		{"eq", "7", 7, true},
+		{"eq", "seven", 7, false},
+		{"eq", true, true, true},
+		{"eq", nil, nil, false},
+		{"eq", nil, "a", false},
+
+		{"ne", "a", "b", true},
+		{"ne", "a", "a", false},
+		{"ne", "007", "7", true},
+		{"ne", nil, "a", true},
+
+		{"in", "b", []any{"a", "b"}, true},
+		{"in", "c", []any{"a", "b"}, false},
+		{"in", []any{"x", "b"}, []any{"a", "b"}, true},
+		{"in", "07", []any{"7"}, false},
+		{"in", 7, []any{"7"}, true},
+		{"in", nil, []any{"a"}, false},
+
+		{"not_in", "c", []any{"a", "b"}, true},
+		{"not_in", "a", []any{"a", "b"}, false},
+		{"not_in", nil, []any{"a"}, true},
+
+		{"contains", "support@example.com", "@example", true},
+		{"contains", "support@example.com", "@other", false},
+		{"contains", []any{"user", "admin"}, "admin", true},
+		{"contains", []string{"user"}, "admin", false},
+		{"contains", "abc", 1, false},
+		{"contains", nil, "admin", false},
+
+		{"prefix", "/admin/users", "/admin", true},
+		{"prefix", "/users", "/admin", false},
+		{"prefix", 1, "1", false},
+		{"suffix", "a@example.com", "@example.com", true},
+		{"suffix", "a@example.org", "@example.com", false},
+		{"suffix", nil, "x", false},
+
+		{"exists", "a", nil, true},
+		{"exists", nil, nil, false},
+		{"exists", "a", true, true},
+		{"exists", nil, false, true},
+		{"exists", "a", false, false},
+
+		{"gt", 2, 1, true},
+		{"gt", 1, 1, false},
+		{"gte", 1, 1, true},
+		{"lt", 1, 2, true},
+		{"lt", 2, 1, false},
+		{"lte", 2, 2, true},
+		{"gt", "b", "a", true},
+		{"gt", "10", "9", false},
+		{"gt", 10, "9", true},
+		{"gt", "x", 9, false},
+		{"gt", nil, 1, false},
+		{"gt", true, false, false},
+
+		{"between", 9, []any{9, 17}, true},
+		{"between", 16, []any{9, 17}, true},
+		{"between", 17, []any{9, 17}, false},
+		{"between", 8, []any{9, 17}, false},
+		{"between", "2024-06-15", []any{"2024-06-01", "2024-07-01"}, true},
+		{"between", "2024-07-01", []any{"2024-06-01", "2024-07-01"}, false},
+		{"between", 10, []any{9}, false},
+		{"between", 10, 9, false},
+		{"between", nil, []any{9, 17}, false},
+	}
+
+	for _, tt := range tests {
+		if got := operators[tt.op](tt.actual, tt.expected); got != tt.want {
+			t.Errorf("%s(%#v, %#v) = %v, want %v", tt.op, tt.actual, tt.expected, got, tt.want)
+		}
+	}
+}
+
+func TestConditions(t *testing.T) {
+	input := Input{
+		Action:   "users:read",
+		Subject:  map[string]any{"sub": "u1", "tenant": "acme", "roles": []any{"support"}},
+		Resource: map[string]any{"id": "u2", "tenant": "acme", "profile": map[string]any{"tenant": "other"}},
+		Request:  map[string]any{"time": map[string]any{"hour": 10}},
+	}
+
+	yes := Condition{Attr: "subject.sub", Op: "eq", Value: "u1"}
+	no := Condition{Attr: "subject.sub", Op: "eq", Value: "u2"}
+
+	tests := []struct {
+		name string
+		when Condition
+		want bool
+	}{
+		{"empty", Condition{}, true},
+		{"leaf true", yes, true},
+		{"leaf false", no, false},
+		{"all true", Condition{All: []Condition{yes, yes}}, true},
+		{"all one false", Condition{All: []Condition{yes, no}}, false},
+		{"all empty", Condition{All: []Condition{}}, true},
+		{"any one true", Condition{Any: []Condition{no, yes}}, true},
+		{"any all false", Condition{Any: []Condition{no, no}}, false},
+		{"not true", Condition{Not: &yes}, false},
+		{"not false", Condition{Not: &no}, true},
+		{"all and any", Condition{All: []Condition{yes}, Any: []Condition{no}}, false},
+		{"nested", Condition{Any: []Condition{no, {All: []Condition{yes, {Not: &no}}}}}, true},
+		{"ref equal", Condition{Attr: "subject.tenant", Op: "eq", Ref: "resource.tenant"}, true},
+		{"ref nested", Condition{Attr: "subject.tenant", Op: "eq", Ref: "resource.profile.tenant"}, false},
+		{"ref missing", Condition{Attr: "subject.tenant", Op: "eq", Ref: "resource.missing"}, false},
+		{"missing path", Condition{Attr: "resource.id.deeper", Op: "exists"}, false},
+		{"unknown root", Condition{Attr: "session.id", Op: "exists"}, false},
+		{"action", Condition{Attr: "action", Op: "prefix", Value: "users:"}, true},
+		{"list attribute", Condition{Attr: "subject.roles", Op: "contains", Value: "support"}, true},
+		{"request time", Condition{Attr: "request.time.hour", Op: "between", Value: []any{9, 17}}, true},
+	}
+
+	e := &engine{location: time.UTC}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var trace []ConditionTrace
+			if got := e.eval(tt.when, input, &trace); got != tt.want {
+				t.Errorf("eval = %v, want %v (trace %+v)", got, tt.want, trace)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	isAdmin := Condition{Attr: "subject.roles", Op: "contains", Value: "admin"}
+	isSelf := Condition{Attr: "subject.sub", Op: "eq", Ref: "resource.id"}
+	suspended := Condition{Attr: "resource.status", Op: "eq", Value: "suspended"}
+
+	doc := Document{Policies: []Policy{
+		{ID: "admins", Effect: EffectAllow, Actions: []string{"*"}, When: isAdmin},
+		{ID: "self", Effect: EffectAllow, Actions: []string{"users:*"}, When: isSelf},
+		{ID: "no-suspended-writes", Effect: EffectDeny, Actions: []string{"users:write"}, When: suspended},
+		{ID: "no-deletes", Effect: EffectDeny, Actions: []string{"users:delete"}},
+	}}
+	e, err := NewEngine(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := map[string]any{"sub": "a", "roles": []any{"admin"}}
+	user := map[string]any{"sub": "u1", "roles": []any{"user"}}
+	active := map[string]any{"id": "u1", "status": "active"}
+	inactive := map[string]any{"id": "u1", "status": "suspended"}
+
+	tests := []struct {
+		name     string
+		input    Input
+		allowed  bool
+		policyID string
+	}{
+		{"admin", Input{Action: "roles:assign", Subject: admin}, true, "admins"},
+		{"self read", Input{Action: "users:read", Subject: user, Resource: active}, true, "self"},
+		{"other read", Input{Action: "users:read", Subject: user, Resource: map[string]any{"id": "u2"}}, false, ""},
+		{"no allow matches", Input{Action: "roles:assign", Subject: user}, false, ""},
+		{"deny overrides self", Input{Action: "users:write", Subject: user, Resource: inactive}, false, "no-suspended-writes"},
+		{"deny overrides admin", Input{Action: "users:write", Subject: admin, Resource: inactive}, false, "no-suspended-writes"},
+		{"unconditional deny", Input{Action: "users:delete", Subject: admin, Resource: active}, false, "no-deletes"},
+		{"deny on other action", Input{Action: "users:read", Subject: user, Resource: inactive}, true, "self"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := e.Evaluate(tt.input)
+			if d.Allowed != tt.allowed || d.PolicyID != tt.policyID {
+				t.Errorf("got allowed=%v policy=%q (%s), want allowed=%v policy=%q", d.Allowed, d.PolicyID, d.Reason, tt.allowed, tt.policyID)
+			}
+			if len(d.Trace) != len(doc.Policies) {
+				t.Errorf("trace has %d policies, want %d", len(d.Trace), len(doc.Policies))
+			}
+		})
+	}
+}
+
+func TestMatchAction(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		action   string
+		want     bool
+	}{
+		{[]string{"*"}, "users:read", true},
+		{[]string{"users:read"}, "users:read", true},
+		{[]string{"users:read"}, "users:write", false},
+		{[]string{"users:*"}, "users:write", true},
+		{[]string{"users:*"}, "roles:assign", false},
+		{[]string{"roles:assign", "users:*"}, "users:read", true},
+		{nil, "users:read", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchAction(tt.patterns, tt.action); got != tt.want {
+			t.Errorf("matchAction(%v, %q) = %v, want %v", tt.patterns, tt.action, got, tt.want)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	doc := Document{Policies: []Policy{{
+		ID:      "same-tenant",
+		Effect:  EffectAllow,
+		Actions: []string{"users:read"},
+		When: Condition{All: []Condition{
+			{Attr: "subject.roles", Op: "contains", Value: "support"},
+			{Attr: "subject.tenant", Op: "eq", Ref: "resource.tenant"},
+			{Attr: "resource.email", Op: "suffix", Value: "@example.com"},
+		}},
+	}}}
+	e, err := NewEngine(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := e.Evaluate(Input{
+		Action:   "users:read",
+		Subject:  map[string]any{"roles": []any{"support"}, "tenant": "acme"},
+		Resource: map[string]any{"tenant": "globex", "email": "victim@example.com"},
+	})
+	if d.Allowed {
+		t.Fatal("allowed across tenants")
+	}
+
+	redacted := d.Redacted()
+	conditions := redacted.Trace[0].Conditions
+	if len(conditions) != 2 {
+		t.Fatalf("got %d conditions, want 2", len(conditions))
+	}
+	if c := conditions[0]; c.Redacted || c.Actual == nil {
+		t.Errorf("subject condition redacted: %+v", c)
+	}
+	if c := conditions[1]; !c.Redacted || c.Actual != nil || c.Expected != nil || c.Result {
+		t.Errorf("resource ref condition not redacted: %+v", c)
+	}
+
+	if d.Trace[0].Conditions[1].Expected != "globex" {
+		t.Error("Redacted modified the original decision")
+	}
+}
+
+func TestNewEngineValidates(t *testing.T) {
+	allow := func(when Condition) Policy {
+		return Policy{ID: "p", Effect: EffectAllow, Actions: []string{"*"}, When: when}
+	}
+
+	tests := []struct {
+		name string
+		doc  Document
+	}{
+		{"unknown mode", Document{Mode: "audit"}},
+		{"unknown time zone", Document{Timezone: "Mars/Olympus"}},
+		{"missing id", Document{Policies: []Policy{{Effect: EffectAllow, Actions: []string{"*"}}}}},
+		{"duplicate id", Document{Policies: []Policy{allow(Condition{}), allow(Condition{})}}},
+		{"bad effect", Document{Policies: []Policy{{ID: "p", Effect: "maybe", Actions: []string{"*"}}}}},
+		{"no actions", Document{Policies: []Policy{{ID: "p", Effect: EffectAllow}}}},
+		{"unknown op", Document{Policies: []Policy{allow(Condition{Attr: "subject.sub", Op: "like"})}}},
+		{"op without attr", Document{Policies: []Policy{allow(Condition{Op: "eq", Value: 1})}}},
+		{"nested unknown op", Document{Policies: []Policy{allow(Condition{Not: &Condition{Attr: "a", Op: "~"}})}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewEngine(tt.doc); err == nil {
+				t.Error("NewEngine accepted an invalid document")
+			}
+		})
+	}
+
+	if _, err := NewEngine(Default()); err != nil {
+		t.Errorf("default document rejected: %v", err)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "policy.yaml")
+	jsonPath := filepath.Join(dir, "policy.json")
+
+	yamlDoc := `
+timezone: Asia/Bangkok
+policies:
+  - id: office-hours
+    effect: allow
+    actions: [users:read]
+    when: {attr: request.time.hour, op: between, value: [9, 17]}
+`
+	jsonDoc := `{"timezone": "Asia/Bangkok", "policies": [{"id": "office-hours", "effect": "allow", "actions": ["users:read"],
+		"when": {"attr": "request.time.hour", "op": "between", "value": [9, 17]}}]}`
+
+	if err := os.WriteFile(yamlPath, []byte(yamlDoc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(jsonPath, []byte(jsonDoc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{yamlPath, jsonPath} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			doc, err := LoadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, err := NewEngine(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 02:30 UTC is 09:30 in Bangkok, 10:00 UTC is 17:00.
+			for _, tc := range []struct {
+				at   time.Time
+				want bool
+			}{
+				{time.Date(2024, 6, 3, 2, 30, 0, 0, time.UTC), true},
+				{time.Date(2024, 6, 3, 1, 59, 0, 0, time.UTC), false},
+				{time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC), false},
+			} {
+				input := Input{Action: "users:read", Request: e.RequestAttributes("GET", "/users/:id", "", tc.at)}
+				if got := e.Evaluate(input).Allowed; got != tc.want {
+					t.Errorf("at %s: allowed = %v, want %v", tc.at, got, tc.want)
+				}
+			}
+		})
+	}
+
+	if _, err := LoadFile(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("LoadFile accepted a missing file")
+	}
+}
@@ -0,0 +1,178 @@
+// Package policy is a small attribute-based access control engine. Policies
+// are read from YAML or JSON and decide whether a subject (the token's
+// claims) may perform an action on a resource (such as a model.User) given
+// the request context (time, client IP, ...).
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Engine modes. In dry-run mode decisions are logged but never enforced.
+const (
+	ModeEnforce = "enforce"
+	ModeDryRun  = "dry_run"
+)
+
+var ErrResourceNotFound = errors.New("resource not found")
+
+// Document is the content of a policy file:
+//
+//	mode: enforce          # or dry_run
+//	timezone: Asia/Bangkok # for request.time.* attributes, default UTC
+//	explain: false         # include the decision trace, resource values
+//	                       # redacted, in 403 bodies
+//	policies:
+//	  - id: support-read-profiles
+//	    effect: allow
+//	    actions: [users:read]
+//	    when:
+//	      all:
+//	        - {attr: subject.roles, op: contains, value: support}
+//	        - {attr: subject.tenant, op: eq, ref: resource.tenant}
+//	        - {attr: request.time.hour, op: between, value: [9, 17]}
+//
+// A request is allowed when at least one allow policy matches and no deny
+// policy does. Nothing matching means deny.
+type Document struct {
+	Mode     string   `json:"mode" yaml:"mode"`
+	Timezone string   `json:"timezone" yaml:"timezone"`
+	Explain  bool     `json:"explain" yaml:"explain"`
+	Policies []Policy `json:"policies" yaml:"policies"`
+}
+
+type Policy struct {
+	ID          string    `json:"id" yaml:"id"`
+	Description string    `json:"description,omitempty" yaml:"description"`
+	Effect      string    `json:"effect" yaml:"effect"`
+	Actions     []string  `json:"actions" yaml:"actions"`
+	When        Condition `json:"when" yaml:"when"`
+}
+
+// Condition is either a combinator (All, Any, Not) or a leaf comparing the
+// attribute Attr with Value, or with another attribute named by Ref. An
+// empty condition always holds.
+type Condition struct {
+	All []Condition `json:"all,omitempty" yaml:"all"`
+	Any []Condition `json:"any,omitempty" yaml:"any"`
+	Not *Condition  `json:"not,omitempty" yaml:"not"`
+
+	Attr  string `json:"attr,omitempty" yaml:"attr"`
+	Op    string `json:"op,omitempty" yaml:"op"`
+	Value any    `json:"value,omitempty" yaml:"value"`
+	Ref   string `json:"ref,omitempty" yaml:"ref"`
+}
+
+// LoadFile reads a policy document, as JSON if the file ends in .json and
+// as YAML otherwise.
+func LoadFile(path string) (Document, error) {
+	var doc Document
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return doc, err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(b, &doc)
+	} else {
+		err = yaml.Unmarshal(b, &doc)
+	}
+	if err != nil {
+		return doc, fmt.Errorf("policy: parse %s: %w", path, err)
+	}
+
+	return doc, nil
+}
+
+// Default is used when no policy file is configured: admins may do
+// anything and users may act on their own account.
+func Default() Document {
+	return Document{
+		Mode: ModeEnforce,
+		Policies: []Policy{
+			{
+				ID:      "admins",
+				Effect:  EffectAllow,
+				Actions: []string{"*"},
+				When:    Condition{Attr: "subject.roles", Op: "contains", Value: "admin"},
+			},
+			{
+				ID:      "self",
+				Effect:  EffectAllow,
+				Actions: []string{"users:*"},
+				When:    Condition{Attr: "subject.sub", Op: "eq", Ref: "resource.id"},
+			},
+		},
+	}
+}
+
+func (d Document) validate() error {
+	if d.Mode != "" && d.Mode != ModeEnforce && d.Mode != ModeDryRun {
+		return fmt.Errorf("policy: unknown mode %q", d.Mode)
+	}
+
+	seen := map[string]bool{}
+	for i, p := range d.Policies {
+		if p.ID == "" {
+			return fmt.Errorf("policy: policy #%d has no id", i+1)
+		}
+		if seen[p.ID] {
+			return fmt.Errorf("policy: duplicate id %q", p.ID)
+		}
+		seen[p.ID] = true
+
+		if p.Effect != EffectAllow && p.Effect != EffectDeny {
+			return fmt.Errorf("policy %s: effect must be allow or deny", p.ID)
+		}
+		if len(p.Actions) == 0 {
+			return fmt.Errorf("policy %s: no actions", p.ID)
+		}
+		if err := p.When.validate(); err != nil {
+			return fmt.Errorf("policy %s: %w", p.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (c Condition) validate() error {
+	for _, sub := range c.All {
+		if err := sub.validate(); err != nil {
+			return err
+		}
+	}
+	for _, sub := range c.Any {
+		if err := sub.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Not != nil {
+		if err := c.Not.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Attr == "" {
+		if c.Op != "" || c.Ref != "" || c.Value != nil {
+			return errors.New("condition has op or value but no attr")
+		}
+		return nil
+	}
+	if _, ok := operators[c.Op]; !ok {
+		return fmt.Errorf("unknown op %q", c.Op)
+	}
+	return nil
+}
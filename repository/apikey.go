@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type IAPIKeyRepository interface {
+	Create(session string, key model.APIKey) (*model.APIKey, error)
+	FindByPrefix(session string, prefix string) (*model.APIKey, error)
+	ListByUser(session string, userId string) ([]model.APIKey, error)
+	Revoke(session string, userId string, id string) (bool, error)
+	Touch(session string, id string, at time.Time, every time.Duration) error
+}
+
+type apiKeyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAPIKeyRepository(collection *mongo.Collection) IAPIKeyRepository {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "prefix", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"func":  "NewAPIKeyRepository",
+			"file":  "repository/apikey.go",
+			"tag":   "repository",
+		}).Error("create index error")
+	}
+
+	return &apiKeyRepository{collection}
+}
+
+func (a *apiKeyRepository) Create(session string, key model.APIKey) (*model.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := a.collection.InsertOne(ctx, &key)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "Create",
+			"file":  "repository/apikey.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return nil, err
+	}
+
+	key.ID, _ = result.InsertedID.(primitive.ObjectID)
+	return &key, nil
+}
+
+// FindByPrefix returns the key whether or not it is revoked or expired; the
+// caller decides.
+func (a *apiKeyRepository) FindByPrefix(session string, prefix string) (*model.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	key := model.APIKey{}
+	if err := a.collection.FindOne(ctx, bson.M{"prefix": prefix}).Decode(&key); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// ListByUser returns the user's keys that have not been revoked, newest first.
+func (a *apiKeyRepository) ListByUser(session string, userId string) ([]model.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := a.collection.Find(ctx, bson.M{
+		"userId":     userId,
+		"revoked_at": nil,
+	}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []model.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (a *apiKeyRepository) Revoke(session string, userId string, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, nil
+	}
+
+	result, err := a.collection.UpdateOne(ctx, bson.M{
+		"_id":        objectId,
+		"userId":     userId,
+		"revoked_at": nil,
+	}, bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// Touch records a use at most once per every, to keep hot keys from writing
+// on every request.
+func (a *apiKeyRepository) Touch(session string, id string, at time.Time, every time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.collection.UpdateOne(ctx, bson.M{
+		"_id": objectId,
+		"$or": bson.A{
+			bson.M{"last_used_at": nil},
+			bson.M{"last_used_at": bson.M{"$lt": at.Add(-every)}},
+		},
+	}, bson.M{
+		"$set": bson.M{"last_used_at": at},
+	})
+	return err
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type IAuthorizationCodeRepository interface {
+	Create(session string, code model.AuthorizationCode) (any, error)
+	Consume(session string, hash string) (*model.AuthorizationCode, error)
+}
+
+type authorizationCodeRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAuthorizationCodeRepository(collection *mongo.Collection) IAuthorizationCodeRepository {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "codeHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"func":  "NewAuthorizationCodeRepository",
+			"file":  "repository/authorization_code.go",
+			"tag":   "repository",
+		}).Error("create index error")
+	}
+
+	return &authorizationCodeRepository{collection}
+}
+
+func (a *authorizationCodeRepository) Create(session string, code model.AuthorizationCode) (any, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := a.collection.InsertOne(ctx, &code)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "Create",
+			"file":  "repository/authorization_code.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return nil, err
+	}
+
+	return result.InsertedID, nil
+}
+
+// Consume atomically marks an unused code as used and returns it. A code that
+// was already consumed yields mongo.ErrNoDocuments.
+func (a *authorizationCodeRepository) Consume(session string, hash string) (*model.AuthorizationCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	code := model.AuthorizationCode{}
+	err := a.collection.FindOneAndUpdate(ctx, bson.M{
+		"codeHash": hash,
+		"used_at":  nil,
+	}, bson.M{
+		"$set": bson.M{"used_at": time.Now()},
+	}).Decode(&code)
+	if err != nil {
+		return nil, err
+	}
+
+	return &code, nil
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ILoginAttemptRepository keeps failed-login counters. A counter lives for
+// window after its last failure, or until its lockout ends if that is later.
+type ILoginAttemptRepository interface {
+	Get(session string, key string) (*model.LoginAttempt, error)
+	RecordFailure(session string, key string, window time.Duration, threshold int, lockout time.Duration) (*model.LoginAttempt, error)
+	Reset(session string, key string) error
+}
+
+type loginAttemptRepository struct {
+	collection *mongo.Collection
+}
+
+func NewLoginAttemptRepository(collection *mongo.Collection) ILoginAttemptRepository {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"func":  "NewLoginAttemptRepository",
+			"file":  "repository/login_attempt.go",
+			"tag":   "repository",
+		}).Error("create index error")
+	}
+
+	return &loginAttemptRepository{collection}
+}
+
+// Get returns nil when the key has no live counter. The TTL monitor only runs
+// once a minute, so expired documents are filtered out here as well.
+func (l *loginAttemptRepository) Get(session string, key string) (*model.LoginAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var attempt model.LoginAttempt
+	err := l.collection.FindOne(ctx, bson.M{
+		"_id":        key,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&attempt)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+func (l *loginAttemptRepository) RecordFailure(session string, key string, window time.Duration, threshold int, lockout time.Duration) (*model.LoginAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	// Start a fresh count if the previous one has lapsed but not been reaped.
+	if _, err := l.collection.DeleteOne(ctx, bson.M{"_id": key, "expires_at": bson.M{"$lte": now}}); err != nil {
+		return nil, err
+	}
+
+	var attempt model.LoginAttempt
+	err := l.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"last_failure_at": now},
+		"$max": bson.M{"expires_at": now.Add(window)},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&attempt)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "RecordFailure",
+			"file":  "repository/login_attempt.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return nil, err
+	}
+
+	if threshold > 0 && attempt.Failures >= threshold && (attempt.LockedUntil == nil || attempt.LockedUntil.Before(now)) {
+		lockedUntil := now.Add(lockout)
+		if _, err := l.collection.UpdateOne(ctx, bson.M{"_id": key}, bson.M{
+			"$set": bson.M{"locked_until": lockedUntil},
+			"$max": bson.M{"expires_at": lockedUntil},
+		}); err != nil {
+			return nil, err
+		}
+		attempt.LockedUntil = &lockedUntil
+	}
+
+	return &attempt, nil
+}
+
+func (l *loginAttemptRepository) Reset(session string, key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := l.collection.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "Reset",
+			"file":  "repository/login_attempt.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type IOAuthClientRepository interface {
+	FindByClientID(session string, clientId string) (*model.OAuthClient, error)
+	Upsert(session string, client model.OAuthClient) error
+}
+
+type oauthClientRepository struct {
+	collection *mongo.Collection
+}
+
+func NewOAuthClientRepository(collection *mongo.Collection) IOAuthClientRepository {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "clientId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"func":  "NewOAuthClientRepository",
+			"file":  "repository/oauth_client.go",
+			"tag":   "repository",
+		}).Error("create index error")
+	}
+
+	return &oauthClientRepository{collection}
+}
+
+func (o *oauthClientRepository) FindByClientID(session string, clientId string) (*model.OAuthClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := model.OAuthClient{}
+	if err := o.collection.FindOne(ctx, bson.M{"clientId": clientId}).Decode(&client); err != nil {
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+func (o *oauthClientRepository) Upsert(session string, client model.OAuthClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	// The configuration is the whole truth about a client: a field it no
+	// longer sets is removed, so e.g. dropping a secret makes the client
+	// public rather than leaving the old secret valid.
+	set := bson.M{"clientId": client.ClientID, "updated_at": now}
+	unset := bson.M{}
+	for field, value := range map[string]any{
+		"name":         client.Name,
+		"redirectUris": client.RedirectURIs,
+		"scopes":       client.Scopes,
+		"grantTypes":   client.GrantTypes,
+		"secretHash":   client.SecretHash,
+	} {
+		// Every value is a string or a slice.
+		if reflect.ValueOf(value).Len() == 0 {
+			unset[field] = ""
+		} else {
+			set[field] = value
+		}
+	}
+
+	update := bson.M{
+		"$set":         set,
+		"$setOnInsert": bson.M{"created_at": now},
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	_, err := o.collection.UpdateOne(ctx, bson.M{"clientId": client.ClientID}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":     session,
+			"error":    err.Error(),
+			"func":     "Upsert",
+			"file":     "repository/oauth_client.go",
+			"tag":      "repository",
+			"clientId": client.ClientID,
+		}).Error("error")
+
+		return err
+	}
+
+	return nil
+}
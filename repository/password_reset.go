@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type IPasswordResetRepository interface {
+	Create(session string, reset model.PasswordReset) error
+	Find(session string, hash string) (*model.PasswordReset, error)
+	Consume(session string, hash string) (*model.PasswordReset, error)
+	DeleteByUser(session string, userId string) error
+}
+
+type passwordResetRepository struct {
+	collection *mongo.Collection
+}
+
+func NewPasswordResetRepository(collection *mongo.Collection) IPasswordResetRepository {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"func":  "NewPasswordResetRepository",
+			"file":  "repository/password_reset.go",
+			"tag":   "repository",
+		}).Error("create index error")
+	}
+
+	return &passwordResetRepository{collection}
+}
+
+func (p *passwordResetRepository) Create(session string, reset model.PasswordReset) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := p.collection.InsertOne(ctx, &reset); err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "Create",
+			"file":  "repository/password_reset.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return err
+	}
+
+	return nil
+}
+
+// Find returns an unused, unexpired token without consuming it.
+func (p *passwordResetRepository) Find(session string, hash string) (*model.PasswordReset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reset := model.PasswordReset{}
+	if err := p.collection.FindOne(ctx, bson.M{
+		"tokenHash":  hash,
+		"used_at":    nil,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&reset); err != nil {
+		return nil, err
+	}
+
+	return &reset, nil
+}
+
+// Consume marks an unused, unexpired token as used and returns it.
+func (p *passwordResetRepository) Consume(session string, hash string) (*model.PasswordReset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reset := model.PasswordReset{}
+	if err := p.collection.FindOneAndUpdate(ctx, bson.M{
+		"tokenHash":  hash,
+		"used_at":    nil,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}, bson.M{
+		"$set": bson.M{"used_at": time.Now()},
+	}).Decode(&reset); err != nil {
+		return nil, err
+	}
+
+	return &reset, nil
+}
+
+func (p *passwordResetRepository) DeleteByUser(session string, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := p.collection.DeleteMany(ctx, bson.M{"userId": userId})
+	return err
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type IRefreshTokenRepository interface {
+	Create(session string, token model.RefreshToken) (any, error)
+	FindByHash(session string, hash string) (*model.RefreshToken, error)
+	MarkRotated(session string, id primitive.ObjectID, replacedBy string) (bool, error)
+	RevokeFamily(session string, familyId string) (int64, error)
+	RevokeByUser(session string, userId string) (int64, error)
+}
+
+type refreshTokenRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRefreshTokenRepository(collection *mongo.Collection) IRefreshTokenRepository {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "familyId", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"func":  "NewRefreshTokenRepository",
+			"file":  "repository/refresh_token.go",
+			"tag":   "repository",
+		}).Error("create index error")
+	}
+
+	return &refreshTokenRepository{collection}
+}
+
+func (r *refreshTokenRepository) Create(session string, token model.RefreshToken) (any, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := r.collection.InsertOne(ctx, &token)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "Create",
+			"file":  "repository/refresh_token.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return nil, err
+	}
+
+	return result.InsertedID, nil
+}
+
+func (r *refreshTokenRepository) FindByHash(session string, hash string) (*model.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	token := model.RefreshToken{}
+	if err := r.collection.FindOne(ctx, bson.M{"tokenHash": hash}).Decode(&token); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkRotated flags the token as used. It reports false when the token had
+// already been rotated or revoked, which callers must treat as reuse.
+func (r *refreshTokenRepository) MarkRotated(session string, id primitive.ObjectID, replacedBy string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"_id":        id,
+		"rotated_at": nil,
+		"revoked_at": nil,
+	}, bson.M{
+		"$set": bson.M{
+			"rotated_at": time.Now(),
+			"replacedBy": replacedBy,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *refreshTokenRepository) RevokeFamily(session string, familyId string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := r.collection.UpdateMany(ctx, bson.M{
+		"familyId":   familyId,
+		"revoked_at": nil,
+	}, bson.M{
+		"$set": bson.M{
+			"revoked_at": time.Now(),
+		},
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":     session,
+			"error":    err.Error(),
+			"func":     "RevokeFamily",
+			"file":     "repository/refresh_token.go",
+			"tag":      "repository",
+			"familyId": familyId,
+		}).Error("error")
+
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func (r *refreshTokenRepository) RevokeByUser(session string, userId string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := r.collection.UpdateMany(ctx, bson.M{
+		"userId":     userId,
+		"revoked_at": nil,
+	}, bson.M{
+		"$set": bson.M{
+			"revoked_at": time.Now(),
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
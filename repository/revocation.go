@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IRevocationRepository records access token ids (jti) that must be rejected
+// before their natural expiry.
+type IRevocationRepository interface {
+	Revoke(session string, jti string, expiresAt time.Time) error
+	IsRevoked(session string, jti string) (bool, error)
+	// RevokeOnce revokes jti and reports whether this call did so, false
+	// meaning it had been revoked already. It is atomic, so of several
+	// concurrent calls for the same jti exactly one gets true.
+	RevokeOnce(session string, jti string, expiresAt time.Time) (bool, error)
+}
+
+type revocationRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRevocationRepository(collection *mongo.Collection) IRevocationRepository {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"func":  "NewRevocationRepository",
+			"file":  "repository/revocation.go",
+			"tag":   "repository",
+		}).Error("create index error")
+	}
+
+	return &revocationRepository{collection}
+}
+
+func (r *revocationRepository) Revoke(session string, jti string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": jti}, bson.M{
+		"$set": bson.M{
+			"expires_at": expiresAt,
+			"revoked_at": time.Now(),
+		},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "Revoke",
+			"file":  "repository/revocation.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *revocationRepository) RevokeOnce(session string, jti string, expiresAt time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, bson.M{
+		"_id":        jti,
+		"expires_at": expiresAt,
+		"revoked_at": time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "RevokeOnce",
+			"file":  "repository/revocation.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *revocationRepository) IsRevoked(session string, jti string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := r.collection.CountDocuments(ctx, bson.M{"_id": jti}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+type inMemoryRevocationRepository struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+// NewInMemoryRevocationRepository keeps revocations in process memory. It is
+// meant for development and single-instance deployments.
+func NewInMemoryRevocationRepository() IRevocationRepository {
+	return &inMemoryRevocationRepository{revoked: map[string]time.Time{}}
+}
+
+func (r *inMemoryRevocationRepository) Revoke(session string, jti string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range r.revoked {
+		if now.After(exp) {
+			delete(r.revoked, id)
+		}
+	}
+
+	r.revoked[jti] = expiresAt
+	return nil
+}
+
+func (r *inMemoryRevocationRepository) RevokeOnce(session string, jti string, expiresAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if exp, ok := r.revoked[jti]; ok && time.Now().Before(exp) {
+		return false, nil
+	}
+
+	r.revoked[jti] = expiresAt
+	return true, nil
+}
+
+func (r *inMemoryRevocationRepository) IsRevoked(session string, jti string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	exp, ok := r.revoked[jti]
+	if !ok {
+		return false, nil
+	}
+
+	return time.Now().Before(exp), nil
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IRoleRepository stores custom roles; built-in roles live in code.
+type IRoleRepository interface {
+	FindByName(session string, name string) (*model.Role, error)
+	FindAll(session string) ([]model.Role, error)
+	Upsert(session string, role model.Role) error
+	Delete(session string, name string) (bool, error)
+}
+
+type roleRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRoleRepository(collection *mongo.Collection) IRoleRepository {
+	return &roleRepository{collection}
+}
+
+func (r *roleRepository) FindByName(session string, name string) (*model.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role := model.Role{}
+	if err := r.collection.FindOne(ctx, bson.M{"_id": name}).Decode(&role); err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func (r *roleRepository) FindAll(session string) ([]model.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []model.Role{}
+	if err := cursor.All(ctx, &roles); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (r *roleRepository) Upsert(session string, role model.Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": role.Name}, bson.M{
+		"$set": bson.M{
+			"description": role.Description,
+			"permissions": role.Permissions,
+			"updated_at":  now,
+		},
+		"$setOnInsert": bson.M{"created_at": now},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "Upsert",
+			"file":  "repository/role.go",
+			"tag":   "repository",
+			"role":  role.Name,
+		}).Error("error")
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *roleRepository) Delete(session string, name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": name})
+	if err != nil {
+		return false, err
+	}
+
+	return result.DeletedCount == 1, nil
+}
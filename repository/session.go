@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ISessionRepository interface {
+	Create(session string, s model.Session) error
+	FindByID(session string, id string) (*model.Session, error)
+	ListActive(session string, userId string) ([]model.Session, error)
+	Extend(session string, id string, at time.Time, expiresAt time.Time) (bool, error)
+	Touch(session string, id string, at time.Time, every time.Duration) error
+	Revoke(session string, userId string, id string) (bool, error)
+	RevokeByUser(session string, userId string) (int64, error)
+}
+
+type sessionRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSessionRepository(collection *mongo.Collection) ISessionRepository {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "last_seen_at", Value: -1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"func":  "NewSessionRepository",
+			"file":  "repository/session.go",
+			"tag":   "repository",
+		}).Error("create index error")
+	}
+
+	return &sessionRepository{collection}
+}
+
+func (r *sessionRepository) Create(session string, s model.Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := r.collection.InsertOne(ctx, &s); err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "Create",
+			"file":  "repository/session.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return err
+	}
+
+	return nil
+}
+
+// FindByID returns the session whether or not it is revoked or expired; the
+// caller decides.
+func (r *sessionRepository) FindByID(session string, id string) (*model.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s := model.Session{}
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// ListActive returns the user's live sessions, most recently seen first.
+func (r *sessionRepository) ListActive(session string, userId string) ([]model.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"userId":     userId,
+		"revoked_at": nil,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}, options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []model.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Extend pushes back the expiry of a live session when its refresh token is
+// rotated. It reports false when there is no such session.
+func (r *sessionRepository) Extend(session string, id string, at time.Time, expiresAt time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"_id":        id,
+		"revoked_at": nil,
+	}, bson.M{
+		"$set": bson.M{"last_seen_at": at, "expires_at": expiresAt},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// Touch records activity at most once per every, to keep busy sessions from
+// writing on every request.
+func (r *sessionRepository) Touch(session string, id string, at time.Time, every time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{
+		"_id":          id,
+		"last_seen_at": bson.M{"$lt": at.Add(-every)},
+	}, bson.M{
+		"$set": bson.M{"last_seen_at": at},
+	})
+	return err
+}
+
+func (r *sessionRepository) Revoke(session string, userId string, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"_id":        id,
+		"userId":     userId,
+		"revoked_at": nil,
+	}, bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *sessionRepository) RevokeByUser(session string, userId string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := r.collection.UpdateMany(ctx, bson.M{
+		"userId":     userId,
+		"revoked_at": nil,
+	}, bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
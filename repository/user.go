@@ -2,10 +2,12 @@ package repository
 
 import (
 	"context"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/sing3demons/users/model"
-	"github.com/sing3demons/users/utils"
 	logger "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -15,22 +17,107 @@ import (
 
 type IUserRepository interface {
 	FindById(session string, id string) (*model.User, error)
-	FindAll(session string) ([]model.User, error)
+	FindByIdentifier(session string, identifier string) (*model.User, error)
+	CheckUsernameExist(session string, username string) bool
+	FindPage(session string, filter model.UserFilter, order model.UserSort, after *model.UserCursor, limit int64) ([]model.User, error)
+	Count(session string, filter model.UserFilter) (int64, error)
+	Search(session string, search model.UserSearch) ([]model.UserSearchResult, error)
 	CreateUser(session string, user model.User) (any, error)
-	UpdateUser(session string, user model.User) (any, error)
+	UpdateUser(session string, id string, patch model.ProfilePatch) (*model.User, error)
+	SetProfileImage(session string, id string, image model.ProfileImage, keys []string) ([]string, error)
+	SaveProfile(session string, id string, profile model.Profile) (bool, error)
+	RemoveProfile(session string, id string, languageCode string) (bool, error)
+	SetDefaultLanguage(session string, id string, languageCode string) (bool, error)
 	DeleteUser(session string, id string) (any, error)
 	ConvertStringToObjectID(objectID string) primitive.ObjectID
 	ConvertObjectIDToString(objectID primitive.ObjectID) string
 	CheckUserExist(session string, email string) bool
 	FindOneByEmail(session string, email string) (*model.User, error)
 	FindOne(session string, filter primitive.M, opts ...*options.FindOneOptions) (*model.User, error)
+	UpdatePassword(session string, id string, hash string) error
+	RehashPassword(session string, id string, oldHash string, newHash string) (bool, error)
+	PasswordChangedAt(session string, id string) (*time.Time, error)
+	SetRole(session string, id string, role string) (bool, error)
+	CountByRole(session string, role string) (int64, error)
+	DemoteAdmin(session string, id string, role string) (bool, error)
+	ActivateEmail(session string, id string, email string) (bool, error)
+	MarkVerificationSent(session string, id string, cooldown time.Duration) (bool, error)
+	SetPendingTOTP(session string, id string, secret string) error
+	EnableTOTP(session string, id string, secret string, recoveryCodes []string) error
+	DisableMFA(session string, id string) error
+	ConsumeTOTPStep(session string, id string, step int64) (bool, error)
+	ConsumeRecoveryCode(session string, id string, hash string) (bool, error)
+	RecordMFAFailure(session string, id string, maxAttempts int, lockout time.Duration) error
+	AddWebAuthnCredential(session string, id string, credential model.WebAuthnCredential) (bool, error)
+	RemoveWebAuthnCredential(session string, id string, credentialId string) (bool, error)
+	FindByWebAuthnCredential(session string, credentialId string) (*model.User, error)
+	UpdateWebAuthnSignCount(session string, id string, credentialId string, previous, next int64) (bool, error)
 }
 
 type userRepository struct {
 	collection *mongo.Collection
 }
 
+// caseInsensitive makes email and username lookups ignore case. Queries only
+// use the matching indexes when they pass the same collation.
+var caseInsensitive = &options.Collation{Locale: "en", Strength: 2}
+
 func NewUserRepository(collection *mongo.Collection) IUserRepository {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetCollation(caseInsensitive),
+		},
+		{
+			Keys: bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetCollation(caseInsensitive).
+				SetPartialFilterExpression(bson.M{"username": bson.M{"$type": "string"}}),
+		},
+		{Keys: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{
+			// Passkey logins look users up by credential id, and a credential
+			// belongs to one account only.
+			Keys: bson.D{{Key: "webauthnCredentials.id", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"webauthnCredentials.id": bson.M{"$exists": true}}),
+		},
+		{
+			Keys: bson.D{
+				{Key: "username", Value: "text"},
+				{Key: "email", Value: "text"},
+				{Key: "profiles.firstName", Value: "text"},
+				{Key: "profiles.lastName", Value: "text"},
+				{Key: "profiles.nickname", Value: "text"},
+			},
+			// No stemming or stop words: these are names, not prose.
+			Options: options.Index().
+				SetName("user_search").
+				SetDefaultLanguage("none").
+				SetLanguageOverride("textLanguage").
+				SetWeights(bson.D{
+					{Key: "username", Value: 10},
+					{Key: "email", Value: 5},
+					{Key: "profiles.nickname", Value: 5},
+					{Key: "profiles.firstName", Value: 3},
+					{Key: "profiles.lastName", Value: 3},
+				}),
+		},
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"func":  "NewUserRepository",
+			"file":  "repository/user.go",
+			"tag":   "repository",
+		}).Error("create index error")
+	}
+
 	return &userRepository{collection}
 }
 
@@ -50,44 +137,236 @@ func (u *userRepository) FindById(session string, id string) (*model.User, error
 	return user, nil
 }
 
-func (u *userRepository) FindAll(session string) ([]model.User, error) {
+// userSecrets are never returned by listings.
+var userSecrets = bson.M{
+	"password":              0,
+	"mfa.totpSecret":        0,
+	"mfa.pendingTotpSecret": 0,
+	"mfa.recoveryCodes":     0,
+}
+
+// FindPage returns up to limit users matching filter in sort order, starting
+// after the cursor position. Ties are broken by _id, so pages never overlap.
+func (u *userRepository) FindPage(session string, filter model.UserFilter, order model.UserSort, after *model.UserCursor, limit int64) ([]model.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var users []model.User
+	query := userFilter(filter)
+	if after != nil {
+		query = bson.M{"$and": bson.A{query, afterCursor(order, after)}}
+	}
+
+	direction := 1
+	if order.Desc {
+		direction = -1
+	}
+
+	cursor, err := u.collection.Find(ctx, query, options.Find().
+		SetSort(bson.D{{Key: order.Field, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(limit).
+		SetProjection(userSecrets))
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "FindPage",
+			"file":  "repository/user.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return nil, err
+	}
+
+	users := []model.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (u *userRepository) Count(session string, filter model.UserFilter) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return u.collection.CountDocuments(ctx, userFilter(filter))
+}
+
+// Scores given to username and email matches, ranking them above word
+// matches from the text index.
+const (
+	searchExactScore  = 100
+	searchPrefixScore = 20
+)
+
+// Search combines the text index, which matches whole words in usernames,
+// emails and profile names, with prefix matching on username and email,
+// and returns the best limit matches by score.
+func (u *userRepository) Search(session string, search model.UserSearch) ([]model.UserSearchResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	limit := int64(search.Limit)
+
+	projection := bson.M{"score": bson.M{"$meta": "textScore"}}
+	for field, v := range userSecrets {
+		projection[field] = v
+	}
 
 	cursor, err := u.collection.Find(ctx, bson.M{
+		"$text":      bson.M{"$search": search.Text},
 		"deleteDate": nil,
-	})
+	}, options.Find().
+		SetProjection(projection).
+		SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetLimit(limit))
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "Search",
+			"file":  "repository/user.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return nil, err
+	}
+
+	var words []model.UserSearchResult
+	if err := cursor.All(ctx, &words); err != nil {
+		return nil, err
+	}
+
+	prefix := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(search.Text), Options: "i"}
+	cursor, err = u.collection.Find(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"username": prefix},
+			bson.M{"email": prefix},
+		},
+		"deleteDate": nil,
+	}, options.Find().SetProjection(userSecrets).SetLimit(limit))
 	if err != nil {
 		return nil, err
 	}
 
-	for cursor.Next(ctx) {
-		var user model.User
-		if err := cursor.Decode(&user); err != nil {
-			return nil, err
+	var prefixed []model.UserSearchResult
+	if err := cursor.All(ctx, &prefixed); err != nil {
+		return nil, err
+	}
+
+	seen := map[primitive.ObjectID]bool{}
+	results := make([]model.UserSearchResult, 0, len(words)+len(prefixed))
+	for _, r := range append(words, prefixed...) {
+		if seen[r.ID] {
+			continue
 		}
-		users = append(users, user)
+		seen[r.ID] = true
+
+		r.Score += prefixScore(r.User, search.Text)
+		results = append(results, r)
 	}
 
-	return users, nil
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > search.Limit {
+		results = results[:search.Limit]
+	}
+
+	return results, nil
+}
+
+func prefixScore(user model.User, text string) float64 {
+	switch {
+	case strings.EqualFold(user.Username, text), strings.EqualFold(user.Email, text):
+		return searchExactScore
+	case hasPrefixFold(user.Username, text), hasPrefixFold(user.Email, text):
+		return searchPrefixScore
+	}
+	return 0
 }
 
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func userFilter(filter model.UserFilter) bson.M {
+	query := bson.M{"deleteDate": nil}
+
+	// Accounts that predate statuses and roles are active users.
+	switch filter.Status {
+	case "":
+	case model.UserStatusActive:
+		query["status"] = bson.M{"$in": bson.A{model.UserStatusActive, nil}}
+	default:
+		query["status"] = filter.Status
+	}
+	switch filter.Role {
+	case "":
+	case model.RoleUser:
+		query["role"] = bson.M{"$in": bson.A{model.RoleUser, nil}}
+	default:
+		query["role"] = filter.Role
+	}
+
+	created := bson.M{}
+	if filter.CreatedFrom != nil {
+		created["$gte"] = *filter.CreatedFrom
+	}
+	if filter.CreatedTo != nil {
+		created["$lt"] = *filter.CreatedTo
+	}
+	if len(created) > 0 {
+		query["created_at"] = created
+	}
+
+	if filter.EmailDomain != "" {
+		query["email"] = primitive.Regex{Pattern: "@" + regexp.QuoteMeta(filter.EmailDomain) + "$", Options: "i"}
+	}
+
+	return query
+}
+
+// afterCursor matches the users that sort after the cursor. Users without
+// the sort field sort before every value ascending and after every value
+// descending, and comparisons against null never match, hence the extra
+// branches.
+func afterCursor(order model.UserSort, after *model.UserCursor) bson.M {
+	idOp := "$gt"
+	valueOp := "$gt"
+	if order.Desc {
+		idOp, valueOp = "$lt", "$lt"
+	}
+
+	sameValue := bson.M{order.Field: after.Value, "_id": bson.M{idOp: after.ID}}
+
+	if after.Value == nil {
+		if order.Desc {
+			return sameValue
+		}
+		return bson.M{"$or": bson.A{sameValue, bson.M{order.Field: bson.M{"$ne": nil}}}}
+	}
+
+	branches := bson.A{bson.M{order.Field: bson.M{valueOp: after.Value}}, sameValue}
+	if order.Desc {
+		branches = append(branches, bson.M{order.Field: nil})
+	}
+	return bson.M{"$or": branches}
+}
+
+// FindOneByEmail ignores case, like logins do.
 func (u *userRepository) FindOneByEmail(session string, email string) (*model.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var user *model.User
+	var user model.User
 
 	if err := u.collection.FindOne(ctx, bson.M{
 		"email":      email,
 		"deleteDate": nil,
-	}).Decode(user); err != nil {
+	}, options.FindOne().SetCollation(caseInsensitive)).Decode(&user); err != nil {
 		return nil, err
 	}
 
-	return user, nil
+	return &user, nil
 }
 
 func (u *userRepository) CheckUserExist(session string, email string) bool {
@@ -99,13 +378,50 @@ func (u *userRepository) CheckUserExist(session string, email string) bool {
 	if err := u.collection.FindOne(ctx, bson.M{
 		"email":      email,
 		"deleteDate": nil,
-	}).Decode(&user); err != nil {
+	}, options.FindOne().SetCollation(caseInsensitive)).Decode(&user); err != nil {
 		return false
 	}
 
 	return true
 }
 
+// CheckUsernameExist includes deleted users, whose names stay reserved.
+func (u *userRepository) CheckUsernameExist(session string, username string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := u.collection.CountDocuments(ctx, bson.M{
+		"username": username,
+	}, options.Count().SetCollation(caseInsensitive).SetLimit(1))
+	if err != nil {
+		return false
+	}
+
+	return count > 0
+}
+
+// FindByIdentifier finds a user by email or, when identifier has no "@", by
+// username. Both ignore case.
+func (u *userRepository) FindByIdentifier(session string, identifier string) (*model.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	field := "username"
+	if strings.Contains(identifier, "@") {
+		field = "email"
+	}
+
+	var user model.User
+	if err := u.collection.FindOne(ctx, bson.M{
+		field:        identifier,
+		"deleteDate": nil,
+	}, options.FindOne().SetCollation(caseInsensitive)).Decode(&user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
 func (u *userRepository) CreateUser(session string, user model.User) (any, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -138,21 +454,212 @@ func (u *userRepository) CreateUser(session string, user model.User) (any, error
 	return result.InsertedID, nil
 }
 
-func (u *userRepository) UpdateUser(session string, user model.User) (any, error) {
+// UpdateUser applies patch, touching only the fields it names, and returns
+// the updated user without secrets.
+func (u *userRepository) UpdateUser(session string, id string, patch model.ProfilePatch) (*model.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	result, err := u.collection.UpdateOne(ctx, bson.M{
-		"_id":        user.ID,
+	set := bson.M{"updated_at": time.Now()}
+	unset := bson.M{}
+	for field, value := range map[string]*string{
+		"username":     patch.Username,
+		"gender":       patch.Gender,
+		"birthday":     patch.Birthday,
+		"profileImage": patch.ProfileImage,
+	} {
+		switch {
+		case value == nil:
+		case *value == "":
+			unset[field] = ""
+		default:
+			set[field] = *value
+		}
+	}
+
+	// Thumbnails belong to an uploaded image, so any other value drops them.
+	// Its blobs stay listed in profileImageKeys until the next upload.
+	if patch.ProfileImage != nil {
+		unset["profileImageThumbnails"] = ""
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	user := model.User{}
+	err := u.collection.FindOneAndUpdate(ctx, bson.M{
+		"_id":        u.ConvertStringToObjectID(id),
+		"deleteDate": nil,
+	}, update, options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(userSecrets)).Decode(&user)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "UpdateUser",
+			"file":  "repository/user.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// SetProfileImage stores an uploaded image and the keys of its blobs, and
+// returns the keys it replaced. It fails with mongo.ErrNoDocuments when the
+// user does not exist.
+func (u *userRepository) SetProfileImage(session string, id string, image model.ProfileImage, keys []string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	previous := model.User{}
+	err := u.collection.FindOneAndUpdate(ctx, bson.M{
+		"_id":        u.ConvertStringToObjectID(id),
 		"deleteDate": nil,
 	}, bson.M{
-		"$set": user,
-	})
+		"$set": bson.M{
+			"profileImage":           image.URL,
+			"profileImageThumbnails": image.Thumbnails,
+			"profileImageKeys":       keys,
+			"updated_at":             time.Now(),
+		},
+	}, options.FindOneAndUpdate().
+		SetReturnDocument(options.Before).
+		SetProjection(bson.M{"profileImageKeys": 1})).Decode(&previous)
 	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "SetProfileImage",
+			"file":  "repository/user.go",
+			"tag":   "repository",
+		}).Error("error")
+
 		return nil, err
 	}
 
-	return result.UpsertedID, nil
+	return previous.ProfileImageKeys, nil
+}
+
+// SaveProfile replaces the user's profile in profile.LanguageCode, or adds
+// it if there is none. It reports false when the user does not exist.
+func (u *userRepository) SaveProfile(session string, id string, profile model.Profile) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectId := u.ConvertStringToObjectID(id)
+	now := time.Now()
+
+	result, err := u.collection.UpdateOne(ctx, bson.M{
+		"_id":                   objectId,
+		"deleteDate":            nil,
+		"profiles.languageCode": profile.LanguageCode,
+	}, bson.M{
+		"$set": bson.M{"profiles.$": profile, "updated_at": now},
+	})
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount == 1 {
+		return true, nil
+	}
+
+	// The $ne guard keeps two concurrent adds from creating duplicates.
+	result, err = u.collection.UpdateOne(ctx, bson.M{
+		"_id":                   objectId,
+		"deleteDate":            nil,
+		"profiles.languageCode": bson.M{"$ne": profile.LanguageCode},
+	}, bson.M{
+		"$push": bson.M{"profiles": profile},
+		"$set":  bson.M{"updated_at": now},
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "SaveProfile",
+			"file":  "repository/user.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// RemoveProfile never removes the default language's profile while others
+// remain; removing the last one also clears the default. Both rules are part
+// of the update's filter, so a concurrent SetDefaultLanguage cannot slip in
+// between a check and the removal.
+func (u *userRepository) RemoveProfile(session string, id string, languageCode string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := func(extra bson.M) bson.M {
+		f := bson.M{
+			"_id":                   u.ConvertStringToObjectID(id),
+			"deleteDate":            nil,
+			"profiles.languageCode": languageCode,
+		}
+		for k, v := range extra {
+			f[k] = v
+		}
+		return f
+	}
+	pull := bson.M{"profiles": bson.M{"languageCode": languageCode}}
+	now := time.Now()
+
+	result, err := u.collection.UpdateOne(ctx, filter(bson.M{"defaultLanguage": bson.M{"$ne": languageCode}}), bson.M{
+		"$pull": pull,
+		"$set":  bson.M{"updated_at": now},
+	})
+	if err != nil {
+		return false, err
+	}
+	if result.ModifiedCount == 1 {
+		return true, nil
+	}
+
+	result, err = u.collection.UpdateOne(ctx, filter(bson.M{"defaultLanguage": languageCode, "profiles": bson.M{"$size": 1}}), bson.M{
+		"$pull":  pull,
+		"$unset": bson.M{"defaultLanguage": ""},
+		"$set":   bson.M{"updated_at": now},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// SetDefaultLanguage only succeeds when the user has a profile in
+// languageCode; an empty languageCode clears the default.
+func (u *userRepository) SetDefaultLanguage(session string, id string, languageCode string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":        u.ConvertStringToObjectID(id),
+		"deleteDate": nil,
+	}
+	update := bson.M{"$unset": bson.M{"defaultLanguage": ""}, "$set": bson.M{"updated_at": time.Now()}}
+	if languageCode != "" {
+		filter["profiles.languageCode"] = languageCode
+		update = bson.M{"$set": bson.M{"defaultLanguage": languageCode, "updated_at": time.Now()}}
+	}
+
+	result, err := u.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
 }
 
 func (u *userRepository) DeleteUser(session string, id string) (any, error) {
@@ -211,9 +718,415 @@ func (u *userRepository) FindOne(session string, filter primitive.M, opts ...*op
 		"func":   "FindOne",
 		"file":   "user.go",
 		"tag":    "repository",
-		"result": utils.MaskSensitiveData(user),
+		"userId": user.ID.Hex(),
 		"filter": filter,
 	}).Debug("insert success")
 
 	return &user, nil
 }
+
+func (u *userRepository) UpdatePassword(session string, id string, hash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := u.collection.UpdateOne(ctx, bson.M{
+		"_id":        u.ConvertStringToObjectID(id),
+		"deleteDate": nil,
+	}, bson.M{
+		"$set": bson.M{
+			"password":          hash,
+			"passwordChangedAt": time.Now(),
+			"updated_at":        time.Now(),
+		},
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "UpdatePassword",
+			"file":  "repository/user.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return err
+	}
+
+	return nil
+}
+
+func (u *userRepository) SetRole(session string, id string, role string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := u.collection.UpdateOne(ctx, bson.M{
+		"_id":        u.ConvertStringToObjectID(id),
+		"deleteDate": nil,
+	}, bson.M{
+		"$set": bson.M{
+			"role":       role,
+			"updated_at": time.Now(),
+		},
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "SetRole",
+			"file":  "repository/user.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// DemoteAdmin gives the admin id another role unless that would leave no
+// admin, in which case it reports false and the user stays admin. Without
+// transactions the check follows the change: a demotion that finds no admin
+// left is undone, so of two admins demoting each other at least one stays.
+func (u *userRepository) DemoteAdmin(session string, id string, role string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fields := logger.Fields{
+		"uuid": session,
+		"func": "DemoteAdmin",
+		"file": "repository/user.go",
+		"tag":  "repository",
+	}
+
+	setRole := func(from, to string) (bool, error) {
+		result, err := u.collection.UpdateOne(ctx, bson.M{
+			"_id":        u.ConvertStringToObjectID(id),
+			"role":       from,
+			"deleteDate": nil,
+		}, bson.M{
+			"$set": bson.M{
+				"role":       to,
+				"updated_at": time.Now(),
+			},
+		})
+		if err != nil {
+			logger.WithFields(fields).WithError(err).Error("error")
+			return false, err
+		}
+		return result.MatchedCount == 1, nil
+	}
+
+	demoted, err := setRole(model.RoleAdmin, role)
+	if err != nil || !demoted {
+		return demoted, err
+	}
+
+	admins, err := u.collection.CountDocuments(ctx, bson.M{
+		"role":       model.RoleAdmin,
+		"deleteDate": nil,
+	})
+	if err == nil && admins > 0 {
+		return true, nil
+	}
+
+	if _, undoErr := setRole(role, model.RoleAdmin); undoErr != nil {
+		return false, undoErr
+	}
+	return false, err
+}
+
+func (u *userRepository) CountByRole(session string, role string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return u.collection.CountDocuments(ctx, bson.M{
+		"role":       role,
+		"deleteDate": nil,
+	})
+}
+
+// PasswordChangedAt returns when the user last set a password, or nil if
+// they never changed the one they registered with.
+func (u *userRepository) PasswordChangedAt(session string, id string) (*time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user model.User
+	err := u.collection.FindOne(ctx, bson.M{
+		"_id":        u.ConvertStringToObjectID(id),
+		"deleteDate": nil,
+	}, options.FindOne().SetProjection(bson.M{"passwordChangedAt": 1})).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.PasswordChangedAt, nil
+}
+
+// RehashPassword swaps an outdated hash of the same password for a new one.
+// It is a no-op if the password changed in the meantime.
+func (u *userRepository) RehashPassword(session string, id string, oldHash string, newHash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := u.collection.UpdateOne(ctx, bson.M{
+		"_id":      u.ConvertStringToObjectID(id),
+		"password": oldHash,
+	}, bson.M{
+		"$set": bson.M{"password": newHash},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// ActivateEmail flips a pending user to active, provided the address has not
+// changed since the verification link was issued.
+func (u *userRepository) ActivateEmail(session string, id string, email string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := u.collection.UpdateOne(ctx, bson.M{
+		"_id":        u.ConvertStringToObjectID(id),
+		"email":      email,
+		"status":     model.UserStatusPending,
+		"deleteDate": nil,
+	}, bson.M{
+		"$set": bson.M{
+			"status":          model.UserStatusActive,
+			"emailVerifiedAt": time.Now(),
+			"updated_at":      time.Now(),
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// MarkVerificationSent records a verification email unless one was sent
+// within cooldown, in which case it reports false.
+func (u *userRepository) MarkVerificationSent(session string, id string, cooldown time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	result, err := u.collection.UpdateOne(ctx, bson.M{
+		"_id": u.ConvertStringToObjectID(id),
+		"$or": bson.A{
+			bson.M{"verificationSentAt": bson.M{"$lt": now.Add(-cooldown)}},
+			bson.M{"verificationSentAt": bson.M{"$exists": false}},
+		},
+	}, bson.M{
+		"$set": bson.M{"verificationSentAt": now},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (u *userRepository) SetPendingTOTP(session string, id string, secret string) error {
+	return u.updateMFA(session, "SetPendingTOTP", bson.M{
+		"_id":        u.ConvertStringToObjectID(id),
+		"deleteDate": nil,
+	}, bson.M{
+		"$set": bson.M{"mfa.pendingTotpSecret": secret},
+	})
+}
+
+func (u *userRepository) EnableTOTP(session string, id string, secret string, recoveryCodes []string) error {
+	return u.updateMFA(session, "EnableTOTP", bson.M{
+		"_id":        u.ConvertStringToObjectID(id),
+		"deleteDate": nil,
+	}, bson.M{
+		"$set": bson.M{
+			"mfa.enabled":       true,
+			"mfa.enabledAt":     time.Now(),
+			"mfa.totpSecret":    secret,
+			"mfa.recoveryCodes": recoveryCodes,
+		},
+		"$unset": bson.M{"mfa.pendingTotpSecret": ""},
+	})
+}
+
+func (u *userRepository) DisableMFA(session string, id string) error {
+	return u.updateMFA(session, "DisableMFA", bson.M{
+		"_id":        u.ConvertStringToObjectID(id),
+		"deleteDate": nil,
+	}, bson.M{
+		"$unset": bson.M{"mfa": ""},
+	})
+}
+
+// ConsumeTOTPStep records step as used. It reports false when the same or a
+// later step was already accepted, i.e. the code is being replayed.
+func (u *userRepository) ConsumeTOTPStep(session string, id string, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := u.collection.UpdateOne(ctx, bson.M{
+		"_id": u.ConvertStringToObjectID(id),
+		"$or": bson.A{
+			bson.M{"mfa.lastUsedStep": bson.M{"$lt": step}},
+			bson.M{"mfa.lastUsedStep": bson.M{"$exists": false}},
+		},
+	}, bson.M{
+		"$set":   bson.M{"mfa.lastUsedStep": step},
+		"$unset": bson.M{"mfa.failedAttempts": "", "mfa.lockedUntil": ""},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (u *userRepository) ConsumeRecoveryCode(session string, id string, hash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := u.collection.UpdateOne(ctx, bson.M{
+		"_id":               u.ConvertStringToObjectID(id),
+		"mfa.recoveryCodes": hash,
+	}, bson.M{
+		"$pull":  bson.M{"mfa.recoveryCodes": hash},
+		"$unset": bson.M{"mfa.failedAttempts": "", "mfa.lockedUntil": ""},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// RecordMFAFailure counts a wrong second factor and locks verification for
+// lockout once maxAttempts is reached.
+func (u *userRepository) RecordMFAFailure(session string, id string, maxAttempts int, lockout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := model.User{}
+	err := u.collection.FindOneAndUpdate(ctx, bson.M{
+		"_id": u.ConvertStringToObjectID(id),
+	}, bson.M{
+		"$inc": bson.M{"mfa.failedAttempts": 1},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+	if err != nil {
+		return err
+	}
+
+	if user.MFA == nil || user.MFA.FailedAttempts < maxAttempts {
+		return nil
+	}
+
+	return u.updateMFA(session, "RecordMFAFailure", bson.M{
+		"_id": user.ID,
+	}, bson.M{
+		"$set":   bson.M{"mfa.lockedUntil": time.Now().Add(lockout)},
+		"$unset": bson.M{"mfa.failedAttempts": ""},
+	})
+}
+
+func (u *userRepository) updateMFA(session string, fn string, filter primitive.M, update primitive.M) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := u.collection.UpdateOne(ctx, filter, update); err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  fn,
+			"file":  "repository/user.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return err
+	}
+
+	return nil
+}
+
+// AddWebAuthnCredential reports false when the credential id is already
+// registered, to this user or, through the unique index, to anyone else.
+func (u *userRepository) AddWebAuthnCredential(session string, id string, credential model.WebAuthnCredential) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A unique multikey index does not stop one document repeating a value,
+	// so the filter covers this user's own credentials.
+	result, err := u.collection.UpdateOne(ctx, bson.M{
+		"_id":                    u.ConvertStringToObjectID(id),
+		"deleteDate":             nil,
+		"webauthnCredentials.id": bson.M{"$ne": credential.ID},
+	}, bson.M{
+		"$push": bson.M{"webauthnCredentials": credential},
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "AddWebAuthnCredential",
+			"file":  "repository/user.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+func (u *userRepository) RemoveWebAuthnCredential(session string, id string, credentialId string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := u.collection.UpdateOne(ctx, bson.M{
+		"_id":                    u.ConvertStringToObjectID(id),
+		"webauthnCredentials.id": credentialId,
+	}, bson.M{
+		"$pull": bson.M{"webauthnCredentials": bson.M{"id": credentialId}},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (u *userRepository) FindByWebAuthnCredential(session string, credentialId string) (*model.User, error) {
+	return u.FindOne(session, bson.M{
+		"webauthnCredentials.id": credentialId,
+		"deleteDate":             nil,
+	})
+}
+
+// UpdateWebAuthnSignCount moves the counter from previous to next. It reports
+// false when a concurrent assertion already changed it.
+func (u *userRepository) UpdateWebAuthnSignCount(session string, id string, credentialId string, previous, next int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := u.collection.UpdateOne(ctx, bson.M{
+		"_id": u.ConvertStringToObjectID(id),
+		"webauthnCredentials": bson.M{
+			"$elemMatch": bson.M{"id": credentialId, "signCount": previous},
+		},
+	}, bson.M{
+		"$set": bson.M{
+			"webauthnCredentials.$.signCount":    next,
+			"webauthnCredentials.$.last_used_at": time.Now(),
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type IWebAuthnChallengeRepository interface {
+	Create(session string, challenge model.WebAuthnChallenge) error
+	Consume(session string, hash string, ceremony string) (*model.WebAuthnChallenge, error)
+}
+
+type webAuthnChallengeRepository struct {
+	collection *mongo.Collection
+}
+
+func NewWebAuthnChallengeRepository(collection *mongo.Collection) IWebAuthnChallengeRepository {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "challengeHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"func":  "NewWebAuthnChallengeRepository",
+			"file":  "repository/webauthn_challenge.go",
+			"tag":   "repository",
+		}).Error("create index error")
+	}
+
+	return &webAuthnChallengeRepository{collection}
+}
+
+func (w *webAuthnChallengeRepository) Create(session string, challenge model.WebAuthnChallenge) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := w.collection.InsertOne(ctx, &challenge); err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "Create",
+			"file":  "repository/webauthn_challenge.go",
+			"tag":   "repository",
+		}).Error("error")
+
+		return err
+	}
+
+	return nil
+}
+
+// Consume deletes and returns the challenge so it can only be answered once.
+func (w *webAuthnChallengeRepository) Consume(session string, hash string, ceremony string) (*model.WebAuthnChallenge, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	challenge := model.WebAuthnChallenge{}
+	if err := w.collection.FindOneAndDelete(ctx, bson.M{
+		"challengeHash": hash,
+		"ceremony":      ceremony,
+	}).Decode(&challenge); err != nil {
+		return nil, err
+	}
+
+	return &challenge, nil
+}
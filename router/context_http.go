@@ -1,6 +1,10 @@
 package router
 
 import (
+	"errors"
+	"io"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"github.com/sing3demons/users/constant"
 )
@@ -8,11 +12,18 @@ import (
 type IContext interface {
 	QueryString(name string) string
 	Param(key string) string
+	Method() string
+	FullPath() string
 
 	JSON(code int, obj any)
+	Redirect(code int, location string)
 	Body(obj any) error
 	ReadBodyJSON(obj any) error
+	FormFile(name string, maxBytes int64) ([]byte, error)
 
+	GetHeader(key string) string
+	GetHeaders() map[string]any
+	SetHeader(key, value string)
 	SetAuthorization(value string)
 	Set(key string, value any)
 	Get(key string) (value any, exists bool)
@@ -30,6 +41,14 @@ func (c *HTTPContext) GetHeader(key string) string {
 	return c.Context.GetHeader(key)
 }
 
+func (c *HTTPContext) GetHeaders() map[string]any {
+	return GetHeaders(c.Context)
+}
+
+func (c *HTTPContext) SetHeader(key, value string) {
+	c.Context.Header(key, value)
+}
+
 func (c *HTTPContext) Set(key string, value any) {
 	c.Context.Set(key, value)
 }
@@ -51,8 +70,12 @@ func (c *HTTPContext) JSON(code int, obj any) {
 	c.Context.JSON(code, obj)
 }
 
+func (c *HTTPContext) Redirect(code int, location string) {
+	c.Context.Redirect(code, location)
+}
+
 func (ctx *HTTPContext) Body(obj any) error {
-	err := ctx.Context.ShouldBind(&obj)
+	err := ctx.Context.ShouldBind(obj)
 	if err != nil {
 		return err
 	}
@@ -67,6 +90,46 @@ func (ctx *HTTPContext) ReadBodyJSON(obj any) error {
 	return nil
 }
 
+// ErrBodyTooLarge is returned by FormFile when the upload exceeds its limit.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// multipartOverhead is allowed on top of a file's limit for the boundaries,
+// part headers and any other small fields in the form.
+const multipartOverhead = 64 << 10
+
+// FormFile reads the named file of a multipart/form-data body, failing with
+// ErrBodyTooLarge once the file passes maxBytes. The body is read through a
+// MaxBytesReader, so at most maxBytes plus the multipart overhead is read;
+// LoggingMiddleware leaves multipart bodies alone for this to hold.
+func (ctx *HTTPContext) FormFile(name string, maxBytes int64) ([]byte, error) {
+	ctx.Context.Request.Body = http.MaxBytesReader(ctx.Context.Writer, ctx.Context.Request.Body, maxBytes+multipartOverhead)
+
+	header, err := ctx.Context.FormFile(name)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, ErrBodyTooLarge
+		}
+		return nil, err
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, ErrBodyTooLarge
+	}
+
+	return data, nil
+}
+
 func (ctx *HTTPContext) SetAuthorization(value string) {
 	ctx.Context.Request.Header.Set("Authorization", "Bearer "+value)
 }
@@ -82,6 +145,15 @@ func (c *HTTPContext) Param(key string) string {
 	return c.Context.Param(key)
 }
 
+func (c *HTTPContext) Method() string {
+	return c.Context.Request.Method
+}
+
+// FullPath is the matched route pattern, e.g. "/users/:id".
+func (c *HTTPContext) FullPath() string {
+	return c.Context.FullPath()
+}
+
 func (c *HTTPContext) Next() {
 	c.Context.Next()
 }
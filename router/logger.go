@@ -19,8 +19,13 @@ func LoggingMiddleware() gin.HandlerFunc {
 		// Starting time request
 		startTime := time.Now()
 		// Processing request
-		body, _ := io.ReadAll(ctx.Request.Body)
-		ctx.Request.Body = io.NopCloser(strings.NewReader(string(body)))
+		// Uploads are left unread: buffering them here would bypass the
+		// limit FormFile puts on the body, and they are not logged anyway
+		var body []byte
+		if ctx.ContentType() != gin.MIMEMultipartPOSTForm {
+			body, _ = io.ReadAll(ctx.Request.Body)
+			ctx.Request.Body = io.NopCloser(strings.NewReader(string(body)))
+		}
 		reqId := ctx.Writer.Header().Get(constant.XSessionId)
 		if reqId == "" {
 			reqId = uuid.NewString()
@@ -36,8 +41,8 @@ func LoggingMiddleware() gin.HandlerFunc {
 		endTime := time.Now()
 		// Request method
 		reqMethod := ctx.Request.Method
-		// Request route
-		path := ctx.Request.RequestURI
+		// Request route, without the query: that is logged masked below
+		path := ctx.Request.URL.Path
 		// status code
 		statusCode := ctx.Writer.Status()
 		// Request host
@@ -67,12 +72,12 @@ func LoggingMiddleware() gin.HandlerFunc {
 			"status":        statusCode,
 			"latency":       latencyTime,
 			"error":         ctx.Errors.ByType(gin.ErrorTypePrivate).String(),
-			"request":       ctx.Request.PostForm.Encode(),
+			"request":       utils.MaskValues(ctx.Request.PostForm),
 			"body_size":     bodySize,
 			"host":          host,
 			"protocol":      ctx.Request.Proto,
 			"path":          path,
-			"query":         ctx.Request.URL.RawQuery,
+			"query":         utils.MaskQuery(ctx.Request.URL.RawQuery),
 			"response_size": ctx.Writer.Size(),
 			"timezone":      time.Now().Location().String(),
 			"ISOTime":       startTime,
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -25,11 +26,15 @@ type IMicroservice interface {
 
 	// HTTP Services
 	USE(handler ServiceHandleFunc)
-	GET(path string, h ServiceHandleFunc)
-	POST(path string, h ServiceHandleFunc)
-	PUT(path string, h ServiceHandleFunc)
-	PATCH(path string, h ServiceHandleFunc)
-	DELETE(path string, h ServiceHandleFunc)
+	// Route handlers run in order; any but the last must call c.Next()
+	// or abort, as route-specific middleware such as scope checks do.
+	GET(path string, h ...ServiceHandleFunc)
+	POST(path string, h ...ServiceHandleFunc)
+	PUT(path string, h ...ServiceHandleFunc)
+	PATCH(path string, h ...ServiceHandleFunc)
+	DELETE(path string, h ...ServiceHandleFunc)
+	// STATIC serves the files in dir under path.
+	STATIC(path string, dir string)
 }
 
 type Microservice struct {
@@ -40,46 +45,67 @@ type ServiceHandleFunc func(c IContext)
 
 func NewMicroservice() IMicroservice {
 	r := gin.New()
+	// X-Forwarded-For is only believed from the proxies in TRUSTED_PROXIES
+	// (comma-separated IPs or CIDRs); by default the client IP is the peer
+	// address, so callers cannot pick the IP that lockouts and sessions see.
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("TRUSTED_PROXIES: %v", err)
+	}
 	r.Use(gin.Recovery())
 	r.Use(LoggingMiddleware())
 
 	return &Microservice{r}
 }
 
+func trustedProxies() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
 func (ms *Microservice) USE(handler ServiceHandleFunc) {
 	ms.Engine.Use(func(ctx *gin.Context) {
 		handler(NewContext(ms, ctx))
 	})
 }
 
-func (ms *Microservice) GET(path string, handler ServiceHandleFunc) {
-	ms.Engine.GET(path, func(ctx *gin.Context) {
-		handler(NewContext(ms, ctx))
-	})
+func (ms *Microservice) GET(path string, h ...ServiceHandleFunc) {
+	ms.Engine.GET(path, ms.handlers(h)...)
 }
 
-func (ms *Microservice) POST(path string, handler ServiceHandleFunc) {
-	ms.Engine.POST(path, func(ctx *gin.Context) {
-		handler(NewContext(ms, ctx))
-	})
+func (ms *Microservice) POST(path string, h ...ServiceHandleFunc) {
+	ms.Engine.POST(path, ms.handlers(h)...)
 }
 
-func (ms *Microservice) PUT(path string, h ServiceHandleFunc) {
-	ms.Engine.PUT(path, func(ctx *gin.Context) {
-		h(NewContext(ms, ctx))
-	})
+func (ms *Microservice) PUT(path string, h ...ServiceHandleFunc) {
+	ms.Engine.PUT(path, ms.handlers(h)...)
 }
 
-func (ms *Microservice) PATCH(path string, h ServiceHandleFunc) {
-	ms.Engine.PATCH(path, func(ctx *gin.Context) {
-		h(NewContext(ms, ctx))
-	})
+func (ms *Microservice) PATCH(path string, h ...ServiceHandleFunc) {
+	ms.Engine.PATCH(path, ms.handlers(h)...)
 }
 
-func (ms *Microservice) DELETE(path string, handler ServiceHandleFunc) {
-	ms.Engine.DELETE(path, func(ctx *gin.Context) {
-		handler(NewContext(ms, ctx))
-	})
+func (ms *Microservice) DELETE(path string, h ...ServiceHandleFunc) {
+	ms.Engine.DELETE(path, ms.handlers(h)...)
+}
+
+func (ms *Microservice) STATIC(path string, dir string) {
+	ms.Engine.Static(path, dir)
+}
+
+func (ms *Microservice) handlers(h []ServiceHandleFunc) []gin.HandlerFunc {
+	handlers := make([]gin.HandlerFunc, len(h))
+	for i, handler := range h {
+		handler := handler
+		handlers[i] = func(ctx *gin.Context) {
+			handler(NewContext(ms, ctx))
+		}
+	}
+	return handlers
 }
 
 func (ms *Microservice) StartHTTP() {
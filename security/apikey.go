@@ -0,0 +1,46 @@
+package security
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix marks personal API keys so they can be told apart from JWTs
+// in an Authorization header, and spotted by secret scanners.
+const APIKeyPrefix = "uk_"
+
+// GenerateAPIKey returns a new key "uk_<lookup>_<secret>" and its lookup
+// part. Store the lookup and HashToken(key); never the key itself.
+func GenerateAPIKey() (key string, lookup string, err error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	lookup = hex.EncodeToString(b)
+
+	secret, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	return APIKeyPrefix + lookup + "_" + secret, lookup, nil
+}
+
+func IsAPIKey(s string) bool {
+	return strings.HasPrefix(s, APIKeyPrefix)
+}
+
+// ParseAPIKey returns the lookup part of key.
+func ParseAPIKey(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, APIKeyPrefix)
+	if !ok {
+		return "", false
+	}
+
+	lookup, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(lookup) != 12 || secret == "" {
+		return "", false
+	}
+	return lookup, true
+}
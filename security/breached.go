@@ -0,0 +1,160 @@
+package security
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachedPasswordChecker reports whether a password is in a known breach
+// corpus.
+type BreachedPasswordChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// breachedPasswordFile looks passwords up the k-anonymity way used by the
+// Pwned Passwords range API: by the first five hex digits of their SHA-1,
+// comparing the returned suffixes locally. path is either
+//
+//   - a directory of range files "<PREFIX>.txt" holding "SUFFIX:COUNT" lines, or
+//   - one file of "HASH:COUNT" lines sorted by hash, searched by bisection.
+//
+// Both layouts are what the haveibeenpwned downloader produces.
+type breachedPasswordFile struct {
+	path string
+}
+
+func NewBreachedPasswordFile(path string) BreachedPasswordChecker {
+	return &breachedPasswordFile{path: path}
+}
+
+func (b *breachedPasswordFile) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	suffixes, err := b.Range(prefix)
+	if err != nil {
+		return false, err
+	}
+
+	for _, s := range suffixes {
+		if s == suffix {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Range returns the hash suffixes of every breached password whose SHA-1
+// starts with prefix.
+func (b *breachedPasswordFile) Range(prefix string) ([]string, error) {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return b.rangeFromDir(prefix)
+	}
+	return b.rangeFromFile(prefix, info.Size())
+}
+
+func (b *breachedPasswordFile) rangeFromDir(prefix string) ([]string, error) {
+	f, err := os.Open(filepath.Join(b.path, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var suffixes []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if suffix := hashField(scanner.Text()); suffix != "" {
+			suffixes = append(suffixes, suffix)
+		}
+	}
+	return suffixes, scanner.Err()
+}
+
+func (b *breachedPasswordFile) rangeFromFile(prefix string, size int64) ([]string, error) {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Find the first line at or after which hashes are >= prefix. lo and hi
+	// are byte offsets; lineAfter maps an offset to the next line start.
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := lineAfter(f, size, mid)
+		if err != nil {
+			return nil, err
+		}
+		if start >= hi || hashField(line) >= prefix {
+			hi = mid
+		} else {
+			lo = start + 1
+		}
+	}
+
+	start, _, err := lineAfter(f, size, lo)
+	if err != nil {
+		return nil, err
+	}
+
+	var suffixes []string
+	scanner := bufio.NewScanner(io.NewSectionReader(f, start, size-start))
+	for scanner.Scan() {
+		hash := hashField(scanner.Text())
+		if !strings.HasPrefix(hash, prefix) {
+			break
+		}
+		suffixes = append(suffixes, hash[len(prefix):])
+	}
+	return suffixes, scanner.Err()
+}
+
+// lineAfter returns the first line starting at or after offset. At the end
+// of the file it returns size and an empty line.
+func lineAfter(f *os.File, size int64, offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		// Step back one byte so a line beginning exactly at offset is kept.
+		r := bufio.NewReader(io.NewSectionReader(f, offset-1, size-offset+1))
+		skipped, err := r.ReadString('\n')
+		if err == io.EOF {
+			return size, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		start = offset - 1 + int64(len(skipped))
+	}
+	if start >= size {
+		return size, "", nil
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(f, start, size-start))
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	return start, line, nil
+}
+
+// hashField extracts the upper-cased hash from a "HASH:COUNT" line.
+func hashField(line string) string {
+	hash, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+	return strings.ToUpper(hash)
+}
@@ -0,0 +1,225 @@
+package security
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// breachCorpus is a sorted list of hashes clustered on a few prefixes, with
+// hashes at the very start and end of the hash space.
+func breachCorpus(passwords ...string) []string {
+	hashes := []string{
+		"00000" + strings.Repeat("0", 35),
+		"00000" + strings.Repeat("1", 35),
+		"0000A" + strings.Repeat("2", 35),
+		"7FFFF" + strings.Repeat("3", 35),
+		"80000" + strings.Repeat("4", 35),
+		"80000" + strings.Repeat("5", 35),
+		"80000" + strings.Repeat("6", 35),
+		"FFFFF" + strings.Repeat("E", 35),
+		"FFFFF" + strings.Repeat("F", 35),
+	}
+	for _, p := range passwords {
+		hashes = append(hashes, sha1Hex(p))
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+func writeBreachFile(t *testing.T, hashes []string, eol string, trailing bool) string {
+	t.Helper()
+
+	var b strings.Builder
+	for i, h := range hashes {
+		fmt.Fprintf(&b, "%s:%d", h, i+1)
+		if trailing || i < len(hashes)-1 {
+			b.WriteString(eol)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writeBreachDir(t *testing.T, hashes []string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	ranges := map[string][]string{}
+	for _, h := range hashes {
+		ranges[h[:5]] = append(ranges[h[:5]], fmt.Sprintf("%s:%d\r\n", h[5:], 1))
+	}
+	for prefix, lines := range ranges {
+		if err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(strings.Join(lines, "")), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// expectedRange is the linear-scan answer Range must agree with.
+func expectedRange(hashes []string, prefix string) []string {
+	var suffixes []string
+	for _, h := range hashes {
+		if strings.HasPrefix(h, prefix) {
+			suffixes = append(suffixes, h[5:])
+		}
+	}
+	return suffixes
+}
+
+func TestBreachedPasswordRange(t *testing.T) {
+	hashes := breachCorpus("password", "123456", "correct horse battery staple")
+
+	layouts := map[string]string{
+		"dir":                  writeBreachDir(t, hashes),
+		"file lf":              writeBreachFile(t, hashes, "\n", true),
+		"file crlf":            writeBreachFile(t, hashes, "\r\n", true),
+		"file no final eol":    writeBreachFile(t, hashes, "\n", false),
+		"file crlf no final":   writeBreachFile(t, hashes, "\r\n", false),
+		"file single line":     writeBreachFile(t, hashes[:1], "\n", true),
+		"file single line eof": writeBreachFile(t, hashes[len(hashes)-1:], "\n", false),
+	}
+
+	prefixes := []string{
+		"00000", // first prefix in the file, two lines
+		"0000A", // right after the first cluster
+		"FFFFF", // last prefix in the file, two lines
+		"7FFFF", // just before a cluster
+		"80000", // three lines
+		"00001", // absent, between the first two clusters
+		"80001", // absent, right after a cluster
+		"12345", // absent
+		sha1Hex("password")[:5],
+		sha1Hex("123456")[:5],
+	}
+
+	for name, path := range layouts {
+		t.Run(name, func(t *testing.T) {
+			corpus := hashes
+			switch name {
+			case "file single line":
+				corpus = hashes[:1]
+			case "file single line eof":
+				corpus = hashes[len(hashes)-1:]
+			}
+
+			b := NewBreachedPasswordFile(path).(*breachedPasswordFile)
+			for _, prefix := range prefixes {
+				got, err := b.Range(prefix)
+				if err != nil {
+					t.Fatalf("Range(%s): %v", prefix, err)
+				}
+				if want := expectedRange(corpus, prefix); !reflect.DeepEqual(got, want) {
+					t.Errorf("Range(%s) = %v, want %v", prefix, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestBreachedPasswordBisection compares the bisection with a linear scan
+// over random corpora, including prefixes shared by many lines.
+func TestBreachedPasswordBisection(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomHash := func() string {
+		b := make([]byte, 20)
+		rng.Read(b)
+		return strings.ToUpper(hex.EncodeToString(b))
+	}
+
+	for round := 0; round < 20; round++ {
+		var hashes []string
+		for i := 0; i < rng.Intn(200)+1; i++ {
+			h := randomHash()
+			hashes = append(hashes, h)
+			// Clusters of lines sharing a prefix.
+			for j := 0; j < rng.Intn(4); j++ {
+				hashes = append(hashes, h[:5]+randomHash()[5:])
+			}
+		}
+		sort.Strings(hashes)
+
+		eol := "\n"
+		if round%2 == 1 {
+			eol = "\r\n"
+		}
+		b := NewBreachedPasswordFile(writeBreachFile(t, hashes, eol, round%3 != 0)).(*breachedPasswordFile)
+
+		prefixes := []string{"00000", "FFFFF"}
+		for _, h := range hashes {
+			prefixes = append(prefixes, h[:5])
+		}
+		for i := 0; i < 50; i++ {
+			prefixes = append(prefixes, randomHash()[:5])
+		}
+
+		for _, prefix := range prefixes {
+			got, err := b.Range(prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := expectedRange(hashes, prefix); !reflect.DeepEqual(got, want) {
+				t.Fatalf("round %d: Range(%s) = %v, want %v", round, prefix, got, want)
+			}
+		}
+	}
+}
+
+func TestIsBreached(t *testing.T) {
+	hashes := breachCorpus("password", "P@ssw0rd")
+
+	for name, path := range map[string]string{
+		"dir":  writeBreachDir(t, hashes),
+		"file": writeBreachFile(t, hashes, "\r\n", true),
+	} {
+		t.Run(name, func(t *testing.T) {
+			checker := NewBreachedPasswordFile(path)
+			for _, tt := range []struct {
+				password string
+				want     bool
+			}{
+				{"password", true},
+				{"P@ssw0rd", true},
+				{"Password", false},
+				{"a perfectly fine passphrase", false},
+			} {
+				got, err := checker.IsBreached(tt.password)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("IsBreached(%q) = %v, want %v", tt.password, got, tt.want)
+				}
+			}
+		})
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.txt")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := NewBreachedPasswordFile(empty).IsBreached("password"); err != nil || got {
+		t.Errorf("empty file: IsBreached = %v, %v", got, err)
+	}
+
+	if _, err := NewBreachedPasswordFile(filepath.Join(t.TempDir(), "missing")).IsBreached("password"); err == nil {
+		t.Error("missing corpus did not fail")
+	}
+}
@@ -0,0 +1,224 @@
+package security
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// cborMap keeps its keys in the order given, as CTAP2 canonical encoding
+// requires authenticators to.
+type cborMap []cborPair
+
+type cborPair struct {
+	key, value any
+}
+
+// encodeCBOR is the encoder side of decodeCBOR, for building test inputs.
+func encodeCBOR(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		case n <= 0xffffffff:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		default:
+			return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+		}
+	}
+
+	switch v := v.(type) {
+	case int:
+		return encodeCBOR(int64(v))
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []any:
+		out := head(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case cborMap:
+		out := head(5, uint64(len(v)))
+		for _, pair := range v {
+			out = append(out, encodeCBOR(pair.key)...)
+			out = append(out, encodeCBOR(pair.value)...)
+		}
+		return out
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	}
+	panic("encodeCBOR: unsupported type")
+}
+
+func hexBytes(s string) []byte {
+	var out []byte
+	for _, f := range strings.Fields(s) {
+		var b byte
+		for _, c := range f {
+			b = b<<4 | byte(strings.IndexRune("0123456789abcdef", c))
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  any
+	}{
+		{"small uint", "17", int64(23)},
+		{"uint8", "18 ff", int64(255)},
+		{"uint16", "19 01 00", int64(256)},
+		{"uint32", "1a 00 01 00 00", int64(65536)},
+		{"uint64", "1b 7f ff ff ff ff ff ff ff", int64(1<<63 - 1)},
+		{"negative", "26", int64(-7)},
+		{"negative uint16", "39 01 00", int64(-257)},
+		{"most negative", "3b 7f ff ff ff ff ff ff ff", int64(-1 << 63)},
+		{"bytes", "43 01 02 03", []byte{1, 2, 3}},
+		{"empty bytes", "40", []byte{}},
+		{"text", "63 66 6d 74", "fmt"},
+		{"array", "82 01 61 61", []any{int64(1), "a"}},
+		{"map", "a2 01 02 63 61 6c 67 26", map[any]any{int64(1): int64(2), "alg": int64(-7)}},
+		{"nested", "a1 61 6b 81 a0", map[any]any{"k": []any{map[any]any{}}}},
+		{"false", "f4", false},
+		{"true", "f5", true},
+		{"null", "f6", nil},
+		{"undefined", "f7", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := hexBytes(tt.input)
+			got, n, err := decodeCBOR(input)
+			if err != nil {
+				t.Fatalf("decodeCBOR: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+			if n != len(input) {
+				t.Errorf("consumed %d bytes, want %d", n, len(input))
+			}
+		})
+	}
+}
+
+func TestDecodeCBORStopsAfterFirstItem(t *testing.T) {
+	// Authenticator data is followed by extensions after the COSE key, so
+	// the decoder must report where the first item ends.
+	input := append(encodeCBOR(cborMap{{int64(1), int64(2)}}), 0xa1, 0x01)
+	_, n, err := decodeCBOR(input)
+	if err != nil || n != 3 {
+		t.Errorf("n = %d, err = %v; want 3, nil", n, err)
+	}
+}
+
+func TestDecodeCBORRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  error // nil accepts any error
+	}{
+		{"empty", nil, errCBORTruncated},
+		{"uint8 missing byte", hexBytes("18"), errCBORTruncated},
+		{"uint16 short", hexBytes("19 01"), errCBORTruncated},
+		{"uint32 short", hexBytes("1a 00 01"), errCBORTruncated},
+		{"uint64 short", hexBytes("1b 00 00 00 00"), errCBORTruncated},
+		{"bytes short", hexBytes("45 01 02"), errCBORTruncated},
+		{"text short", hexBytes("63 61"), errCBORTruncated},
+		{"array short", hexBytes("83 01 02"), errCBORTruncated},
+		{"map missing value", hexBytes("a1 01"), errCBORTruncated},
+		{"map missing pair", hexBytes("a2 01 02"), errCBORTruncated},
+
+		// Lengths far beyond the input must fail before allocating.
+		{"huge bytes", hexBytes("5b ff ff ff ff ff ff ff ff"), errCBORTruncated},
+		{"huge text", hexBytes("7b 7f ff ff ff ff ff ff ff 61"), errCBORTruncated},
+		{"huge array", hexBytes("9b 7f ff ff ff ff ff ff ff 01"), errCBORTruncated},
+		{"huge map", hexBytes("bb 00 00 00 01 00 00 00 00 01 02"), errCBORTruncated},
+		{"array longer than input", hexBytes("9a 00 01 00 00 01"), errCBORTruncated},
+
+		{"uint overflow", hexBytes("1b 80 00 00 00 00 00 00 00"), nil},
+		{"negative overflow", hexBytes("3b ff ff ff ff ff ff ff ff"), nil},
+		{"indefinite bytes", hexBytes("5f 41 01 ff"), nil},
+		{"indefinite array", hexBytes("9f 01 ff"), nil},
+		{"indefinite map", hexBytes("bf 01 02 ff"), nil},
+		{"reserved info", hexBytes("1c"), nil},
+		{"tag", hexBytes("c0 61 61"), nil},
+		{"half float", hexBytes("f9 3c 00"), nil},
+		{"simple value", hexBytes("f8 20"), nil},
+		{"break", hexBytes("ff"), nil},
+		{"bytes map key", hexBytes("a1 41 01 02"), nil},
+		{"array map key", hexBytes("a1 80 02"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _, err := decodeCBOR(tt.input)
+			if err == nil {
+				t.Fatalf("decoded %#v, want an error", v)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORDepthLimit(t *testing.T) {
+	nested := func(depth int, open byte) []byte {
+		var input []byte
+		for i := 0; i < depth; i++ {
+			input = append(input, open)
+			if open == 0xa1 {
+				input = append(input, 0x01)
+			}
+		}
+		return append(input, 0x00)
+	}
+
+	for _, open := range []byte{0x81, 0xa1} {
+		if _, _, err := decodeCBOR(nested(maxCBORDepth, open)); err != nil {
+			t.Errorf("%#x: depth %d: %v", open, maxCBORDepth, err)
+		}
+		for _, depth := range []int{maxCBORDepth + 1, 10000} {
+			_, _, err := decodeCBOR(nested(depth, open))
+			if err == nil || !strings.Contains(err.Error(), "too deep") {
+				t.Errorf("%#x: depth %d: err = %v, want nesting too deep", open, depth, err)
+			}
+		}
+	}
+}
+
+func TestEncodeCBORRoundTrip(t *testing.T) {
+	in := cborMap{{"fmt", "none"}, {"attStmt", cborMap{}}, {"authData", bytes.Repeat([]byte{7}, 300)}}
+	v, _, err := decodeCBOR(encodeCBOR(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := v.(map[any]any)
+	if m["fmt"] != "none" || len(m["authData"].([]byte)) != 300 {
+		t.Errorf("round trip = %#v", m)
+	}
+}
@@ -0,0 +1,209 @@
+package security
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type SigningKey struct {
+	KID        string
+	PrivateKey *rsa.PrivateKey
+	PublicKey  *rsa.PublicKey
+}
+
+// KeySet holds the active signing key plus retiring keys that are still
+// accepted for verification until tokens signed with them expire.
+type KeySet struct {
+	active string
+	keys   map[string]SigningKey
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+var (
+	keySetMu sync.Mutex
+	keySet   *KeySet
+)
+
+// GetKeySet lazily loads the process-wide key set. Only a successful load is
+// cached; after an error the next call tries again.
+//
+// When JWT_KEYS_DIR is set every "<kid>.pem" private key in it can sign and
+// every "<kid>.pub" public key is verify-only (retiring). JWT_ACTIVE_KID picks
+// the signing key, defaulting to the last private kid in lexical order.
+// Otherwise the single private key in PRIVATE_KEY (base64 PEM) or
+// cert/id_rsa is used; its public half is derived from it.
+func GetKeySet() (*KeySet, error) {
+	keySetMu.Lock()
+	defer keySetMu.Unlock()
+
+	if keySet != nil {
+		return keySet, nil
+	}
+
+	var (
+		set *KeySet
+		err error
+	)
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		set, err = loadKeySetFromDir(dir, os.Getenv("JWT_ACTIVE_KID"))
+	} else {
+		set, err = loadLegacyKeySet()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keySet = set
+	return keySet, nil
+}
+
+func (k *KeySet) Active() SigningKey {
+	return k.keys[k.active]
+}
+
+func (k *KeySet) Lookup(kid string) (SigningKey, bool) {
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func (k *KeySet) JWKS() JWKS {
+	kids := make([]string, 0, len(k.keys))
+	for kid := range k.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, kid := range kids {
+		jwks.Keys = append(jwks.Keys, publicJWK(kid, k.keys[kid].PublicKey))
+	}
+	return jwks
+}
+
+func loadKeySetFromDir(dir, activeKid string) (*KeySet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &KeySet{keys: map[string]SigningKey{}}
+	var signers []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		kid := strings.TrimSuffix(name, ext)
+		if ext != ".pem" && ext != ".pub" {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		switch ext {
+		case ".pem":
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(b)
+			if err != nil {
+				return nil, fmt.Errorf("keyset: %s: %w", name, err)
+			}
+			set.keys[kid] = SigningKey{KID: kid, PrivateKey: private, PublicKey: &private.PublicKey}
+			signers = append(signers, kid)
+		case ".pub":
+			if _, ok := set.keys[kid]; ok {
+				continue
+			}
+			public, err := jwt.ParseRSAPublicKeyFromPEM(b)
+			if err != nil {
+				return nil, fmt.Errorf("keyset: %s: %w", name, err)
+			}
+			set.keys[kid] = SigningKey{KID: kid, PublicKey: public}
+		}
+	}
+
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("keyset: no private key in %s", dir)
+	}
+
+	sort.Strings(signers)
+	set.active = signers[len(signers)-1]
+	if activeKid != "" {
+		key, ok := set.keys[activeKid]
+		if !ok || key.PrivateKey == nil {
+			return nil, fmt.Errorf("keyset: active kid %q has no private key", activeKid)
+		}
+		set.active = activeKid
+	}
+
+	return set, nil
+}
+
+func loadLegacyKeySet() (*KeySet, error) {
+	privateKey, err := getSecretPrivateKeyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	private, err := jwt.ParseRSAPrivateKeyFromPEM(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	kid := thumbprint(&private.PublicKey)
+	return &KeySet{
+		active: kid,
+		keys: map[string]SigningKey{
+			kid: {KID: kid, PrivateKey: private, PublicKey: &private.PublicKey},
+		},
+	}, nil
+}
+
+// thumbprint derives a stable kid from the key material (RFC 7638).
+func thumbprint(key *rsa.PublicKey) string {
+	jwk := publicJWK("", key)
+	b, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{jwk.E, jwk.Kty, jwk.N})
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func publicJWK(kid string, key *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: jwt.SigningMethodRS256.Alg(),
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
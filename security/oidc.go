@@ -0,0 +1,136 @@
+package security
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sing3demons/users/model"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+var DefaultScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// ParseScope splits a space separated scope string, dropping duplicates.
+func ParseScope(scope string) []string {
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, s := range strings.Fields(scope) {
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		scopes = append(scopes, s)
+	}
+	return scopes
+}
+
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// UserClaims returns the standard OIDC claims for user that the granted
+// scopes allow; sub is always present.
+func UserClaims(user model.User, scopes []string) map[string]any {
+	claims := map[string]any{
+		"sub": user.ID.Hex(),
+	}
+
+	if HasScope(scopes, ScopeProfile) {
+		if user.Username != "" {
+			claims["preferred_username"] = user.Username
+		}
+		if user.Gender != "" {
+			claims["gender"] = user.Gender
+		}
+		if user.Birthday != "" {
+			claims["birthdate"] = user.Birthday
+		}
+		if user.ProfileImage != "" {
+			claims["picture"] = user.ProfileImage
+		}
+		if !user.UpdatedAt.IsZero() {
+			claims["updated_at"] = user.UpdatedAt.Unix()
+		}
+
+		if len(user.Profiles) > 0 {
+			profile := user.Profiles[0]
+			name := strings.TrimSpace(profile.FirstName + " " + profile.LastName)
+			if name != "" {
+				claims["name"] = name
+			}
+			if profile.FirstName != "" {
+				claims["given_name"] = profile.FirstName
+			}
+			if profile.LastName != "" {
+				claims["family_name"] = profile.LastName
+			}
+			if profile.NickName != "" {
+				claims["nickname"] = profile.NickName
+			}
+			if profile.LanguageCode != "" {
+				claims["locale"] = profile.LanguageCode
+			}
+		}
+	}
+
+	if HasScope(scopes, ScopeEmail) && user.Email != "" {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.Status != model.UserStatusPending
+	}
+
+	return claims
+}
+
+// GenerateIDToken issues an OIDC id_token for clientId. An empty clientId
+// falls back to the configured AUDIENCE, then the issuer itself.
+func GenerateIDToken(user model.User, grant model.Grant) (string, error) {
+	keys, err := GetKeySet()
+	if err != nil {
+		return "", err
+	}
+
+	issuer := os.Getenv("ISSUER")
+	audience := jwt.ClaimStrings{}
+	switch {
+	case grant.ClientID != "":
+		audience = append(audience, grant.ClientID)
+	case os.Getenv("AUDIENCE") != "":
+		audience = append(audience, strings.Split(os.Getenv("AUDIENCE"), ",")...)
+	default:
+		audience = append(audience, issuer)
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": issuer,
+		"aud": audience,
+		"iat": jwt.NewNumericDate(now),
+		"exp": jwt.NewNumericDate(now.Add(AccessTokenExpiration)),
+		// Signed with the access token key, so it must say it is not one.
+		"token_use": TokenUseID,
+	}
+	for k, v := range UserClaims(user, grant.Scopes) {
+		claims[k] = v
+	}
+
+	if grant.Nonce != "" {
+		claims["nonce"] = grant.Nonce
+	}
+	if !grant.AuthTime.IsZero() {
+		claims["auth_time"] = grant.AuthTime.Unix()
+	}
+
+	return signWithActiveKey(keys, claims)
+}
@@ -0,0 +1,51 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sing3demons/users/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGenerateIDTokenIsNotAnAccessToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(filepath.Join(dir, "test.pem"), keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JWT_KEYS_DIR", dir)
+	t.Setenv("ISSUER", "https://issuer.example")
+
+	user := model.User{ID: primitive.NewObjectID(), Email: "alice@example.com"}
+	token, err := GenerateIDToken(user, model.Grant{ClientID: "app", Scopes: []string{ScopeOpenID, ScopeEmail}, Nonce: "n-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if use, _ := claims["token_use"].(string); use != TokenUseID {
+		t.Errorf("token_use = %q, want %q", use, TokenUseID)
+	}
+	if sub, _ := claims.GetSubject(); sub != user.ID.Hex() {
+		t.Errorf("sub = %q", sub)
+	}
+	if aud, _ := claims.GetAudience(); len(aud) != 1 || aud[0] != "app" {
+		t.Errorf("aud = %v", aud)
+	}
+	if claims["nonce"] != "n-1" || claims["email"] != "alice@example.com" {
+		t.Errorf("claims = %v", claims)
+	}
+}
@@ -1,15 +1,234 @@
 package security
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
 
-func EncryptPassword(password string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch   = errors.New("password does not match")
+	ErrUnknownHashFormat  = errors.New("unknown password hash format")
+	ErrMalformedPHCString = errors.New("malformed argon2id hash")
+)
+
+// PasswordHasher produces and checks self-describing hashes, so stored
+// passwords keep verifying after the default algorithm or its parameters
+// change.
+type PasswordHasher interface {
+	// ID is the algorithm identifier at the start of the hash ("argon2id").
+	ID() string
+	Hash(password string) (string, error)
+	Verify(hash, password string) error
+	// NeedsRehash reports whether hash, which this hasher can verify, was
+	// made with weaker parameters than it currently uses.
+	NeedsRehash(hash string) bool
+}
+
+type Argon2idParams struct {
+	Memory  uint32 // KiB
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2idParams follows the RFC 9106 recommendation for memory
+// constrained environments.
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:  64 * 1024,
+	Time:    3,
+	Threads: 2,
+	SaltLen: 16,
+	KeyLen:  32,
+}
+
+type argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) PasswordHasher {
+	return &argon2idHasher{params: params}
+}
+
+func (a *argon2idHasher) ID() string {
+	return "argon2id"
+}
+
+// Hash returns a PHC string: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>.
+func (a *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, a.params.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.params.Time, a.params.Memory, a.params.Threads, a.params.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.params.Memory, a.params.Time, a.params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *argon2idHasher) Verify(hash, password string) error {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLen)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (a *argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, _, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory < a.params.Memory ||
+		params.Time < a.params.Time ||
+		params.Threads != a.params.Threads ||
+		params.KeyLen < a.params.KeyLen ||
+		uint32(len(salt)) < a.params.SaltLen
+}
+
+func parseArgon2id(hash string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrMalformedPHCString
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrMalformedPHCString
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, ErrMalformedPHCString
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrMalformedPHCString
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrMalformedPHCString
+	}
+
+	params.SaltLen = uint32(len(salt))
+	params.KeyLen = uint32(len(key))
+	return params, salt, key, nil
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) PasswordHasher {
+	return &bcryptHasher{cost: cost}
+}
+
+func (b *bcryptHasher) ID() string {
+	return "2b"
+}
+
+func (b *bcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), b.cost)
 	if err != nil {
 		return "", err
 	}
 	return string(hashed), nil
 }
 
+func (b *bcryptHasher) Verify(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (b *bcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < b.cost
+}
+
+var (
+	passwordHasherOnce sync.Once
+	passwordHasher     PasswordHasher
+	legacyHashers      []PasswordHasher
+)
+
+// GetPasswordHasher returns the hasher new passwords are stored with:
+// argon2id unless PASSWORD_HASHER=bcrypt.
+func GetPasswordHasher() PasswordHasher {
+	passwordHasherOnce.Do(func() {
+		argon := NewArgon2idHasher(DefaultArgon2idParams)
+		bc := NewBcryptHasher(bcrypt.DefaultCost)
+
+		if os.Getenv("PASSWORD_HASHER") == "bcrypt" {
+			passwordHasher, legacyHashers = bc, []PasswordHasher{argon}
+		} else {
+			passwordHasher, legacyHashers = argon, []PasswordHasher{bc}
+		}
+	})
+	return passwordHasher
+}
+
+// hasherFor picks the hasher that produced hash from its "$<id>$" prefix.
+func hasherFor(hash string) (PasswordHasher, error) {
+	current := GetPasswordHasher()
+
+	id := strings.SplitN(strings.TrimPrefix(hash, "$"), "$", 2)[0]
+	switch id {
+	case "2a", "2b", "2y":
+		id = "2b"
+	}
+
+	for _, h := range append([]PasswordHasher{current}, legacyHashers...) {
+		if h.ID() == id {
+			return h, nil
+		}
+	}
+	return nil, ErrUnknownHashFormat
+}
+
+func EncryptPassword(password string) (string, error) {
+	return GetPasswordHasher().Hash(password)
+}
+
 func VerifyPassword(hashed, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password))
+	hasher, err := hasherFor(hashed)
+	if err != nil {
+		return err
+	}
+	return hasher.Verify(hashed, password)
+}
+
+// PasswordNeedsRehash reports whether hashed should be replaced with a fresh
+// EncryptPassword result, because it uses a different algorithm than the
+// current default or weaker parameters.
+func PasswordNeedsRehash(hashed string) bool {
+	hasher, err := hasherFor(hashed)
+	if err != nil {
+		return true
+	}
+	return hasher != GetPasswordHasher() || hasher.NeedsRehash(hashed)
 }
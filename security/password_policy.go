@@ -0,0 +1,187 @@
+package security
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Password policy rule names, reported in PolicyViolation.Rule.
+const (
+	RuleMinLength        = "min_length"
+	RuleMaxLength        = "max_length"
+	RuleCharacterClasses = "character_classes"
+	RulePersonalInfo     = "personal_info"
+	RuleBreached         = "breached"
+)
+
+// bcryptMaxBytes is the most bcrypt will look at. Older bcrypt versions
+// silently ignore anything past it and newer ones refuse to hash it, so
+// longer passwords are rejected by the policy instead.
+const bcryptMaxBytes = 72
+
+type PasswordPolicy struct {
+	MinLength  int
+	MaxBytes   int
+	MinClasses int
+	Breached   BreachedPasswordChecker
+}
+
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password broke, so a client can
+// show them all at once.
+type PasswordPolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password does not meet policy: " + strings.Join(messages, "; ")
+}
+
+var (
+	passwordPolicyOnce sync.Once
+	passwordPolicy     PasswordPolicy
+)
+
+// GetPasswordPolicy lazily loads the process-wide policy from
+// PASSWORD_MIN_LENGTH (default 8), PASSWORD_MAX_BYTES (default 72, capped at
+// 72 while bcrypt is the password hasher), PASSWORD_MIN_CLASSES (lower,
+// upper, digit, symbol; default 3) and PASSWORD_BREACHED_FILE.
+func GetPasswordPolicy() PasswordPolicy {
+	passwordPolicyOnce.Do(func() {
+		passwordPolicy = passwordPolicyFromEnv(GetPasswordHasher())
+	})
+	return passwordPolicy
+}
+
+func passwordPolicyFromEnv(hasher PasswordHasher) PasswordPolicy {
+	maxBytes := envInt("PASSWORD_MAX_BYTES", bcryptMaxBytes)
+	if _, ok := hasher.(*bcryptHasher); ok {
+		maxBytes = min(maxBytes, bcryptMaxBytes)
+	}
+
+	policy := PasswordPolicy{
+		MinLength:  envInt("PASSWORD_MIN_LENGTH", 8),
+		MaxBytes:   maxBytes,
+		MinClasses: min(envInt("PASSWORD_MIN_CLASSES", 3), 4),
+	}
+	if path := os.Getenv("PASSWORD_BREACHED_FILE"); path != "" {
+		policy.Breached = NewBreachedPasswordFile(path)
+	}
+	return policy
+}
+
+// ValidatePassword checks password against the process-wide policy.
+// identities are the user's email, username and similar values the
+// password must not contain.
+func ValidatePassword(password string, identities ...string) error {
+	return GetPasswordPolicy().Validate(password, identities...)
+}
+
+func (p PasswordPolicy) Validate(password string, identities ...string) error {
+	var violations []PolicyViolation
+
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("must be at least %d characters", p.MinLength),
+		})
+	}
+
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("must be at most %d bytes", p.MaxBytes),
+		})
+	}
+
+	if classes := characterClasses(password); classes < p.MinClasses {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleCharacterClasses,
+			Message: fmt.Sprintf("must mix at least %d of lowercase, uppercase, digits and symbols", p.MinClasses),
+		})
+	}
+
+	lower := strings.ToLower(password)
+	for _, identity := range personalTerms(identities) {
+		if strings.Contains(lower, identity) {
+			violations = append(violations, PolicyViolation{
+				Rule:    RulePersonalInfo,
+				Message: "must not contain your email or username",
+			})
+			break
+		}
+	}
+
+	// Only worth a lookup once the cheap rules pass.
+	if len(violations) == 0 && p.Breached != nil {
+		breached, err := p.Breached.IsBreached(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, PolicyViolation{
+				Rule:    RuleBreached,
+				Message: "appears in a known data breach, choose another",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// personalTerms turns identities into lowercase substrings to forbid: the
+// value itself, or the local part for emails. Terms shorter than three
+// characters would reject too many good passwords and are skipped.
+func personalTerms(identities []string) []string {
+	var terms []string
+	for _, identity := range identities {
+		identity = strings.ToLower(strings.TrimSpace(identity))
+		if local, _, ok := strings.Cut(identity, "@"); ok {
+			identity = local
+		}
+		if len(identity) >= 3 {
+			terms = append(terms, identity)
+		}
+	}
+	return terms
+}
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v >= 0 {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,135 @@
+package security
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeBreached map[string]bool
+
+func (f fakeBreached) IsBreached(password string) (bool, error) {
+	if f == nil {
+		return false, errors.New("corpus unavailable")
+	}
+	return f[password], nil
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:  8,
+		MaxBytes:   bcryptMaxBytes,
+		MinClasses: 3,
+		Breached:   fakeBreached{"Password1!": true},
+	}
+
+	tests := []struct {
+		name       string
+		password   string
+		identities []string
+		want       []string
+	}{
+		{"valid", "Tr0ub4dor&3", nil, nil},
+		{"too short", "Ab1!", nil, []string{RuleMinLength}},
+		{"length counts runes", "Ññññ1!aa", nil, nil},
+		{"72 bytes", strings.Repeat("Aa1!", 18), nil, nil},
+		{"73 bytes", strings.Repeat("Aa1!", 18) + "x", nil, []string{RuleMaxLength}},
+		{"multibyte over the byte cap", strings.Repeat("ñ", 36) + "A1", nil, []string{RuleMaxLength}},
+		{"two classes", "abcdefgh12", nil, []string{RuleCharacterClasses}},
+		{"symbols count", "abcdefgh!!12", nil, nil},
+		{"contains username", "xJohnDoe99!", []string{"johndoe"}, []string{RulePersonalInfo}},
+		{"contains email local part", "Alice.Smith#1", []string{"alice.smith@example.com"}, []string{RulePersonalInfo}},
+		{"domain is not personal", "Example.com#1", []string{"alice@example.com"}, nil},
+		{"short identity ignored", "Jo#Secret12", []string{"jo"}, nil},
+		{"every violation", "bob", []string{"bob"}, []string{RuleMinLength, RuleCharacterClasses, RulePersonalInfo}},
+		{"breached", "Password1!", nil, []string{RuleBreached}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.password, tt.identities...)
+			var got []string
+			var policyErr *PasswordPolicyError
+			if errors.As(err, &policyErr) {
+				for _, v := range policyErr.Violations {
+					got = append(got, v.Rule)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyBreachedLookup(t *testing.T) {
+	// A failed lookup is an error, not a pass.
+	policy := PasswordPolicy{MinLength: 8, MinClasses: 3, Breached: fakeBreached(nil)}
+	if err := policy.Validate("Tr0ub4dor&3"); err == nil {
+		t.Error("failed breach lookup accepted the password")
+	}
+
+	// Cheap violations skip the lookup altogether.
+	var policyErr *PasswordPolicyError
+	if err := policy.Validate("short"); !errors.As(err, &policyErr) {
+		t.Errorf("err = %v, want a policy error", err)
+	}
+}
+
+func TestPasswordPolicyFromEnv(t *testing.T) {
+	argon := NewArgon2idHasher(DefaultArgon2idParams)
+	bc := NewBcryptHasher(4)
+
+	tests := []struct {
+		name     string
+		maxBytes string
+		hasher   PasswordHasher
+		want     int
+	}{
+		{"bcrypt default", "", bc, 72},
+		{"argon2id default", "", argon, 72},
+		{"bcrypt caps a larger limit", "128", bc, 72},
+		{"argon2id allows a larger limit", "128", argon, 128},
+		{"bcrypt lower limit", "64", bc, 64},
+		{"invalid falls back", "lots", argon, 72},
+		{"negative falls back", "-1", argon, 72},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PASSWORD_MAX_BYTES", tt.maxBytes)
+			t.Setenv("PASSWORD_MIN_LENGTH", "")
+			t.Setenv("PASSWORD_MIN_CLASSES", "9")
+			t.Setenv("PASSWORD_BREACHED_FILE", "")
+
+			p := passwordPolicyFromEnv(tt.hasher)
+			if p.MaxBytes != tt.want {
+				t.Errorf("MaxBytes = %d, want %d", p.MaxBytes, tt.want)
+			}
+			if p.MinLength != 8 || p.MinClasses != 4 || p.Breached != nil {
+				t.Errorf("policy = %+v", p)
+			}
+		})
+	}
+
+	t.Run("argon2id accepts what bcrypt cannot hash", func(t *testing.T) {
+		t.Setenv("PASSWORD_MAX_BYTES", "128")
+		t.Setenv("PASSWORD_MIN_CLASSES", "3")
+		long := strings.Repeat("Aa1!", 25)
+
+		if err := passwordPolicyFromEnv(argon).Validate(long); err != nil {
+			t.Errorf("argon2id: %v", err)
+		}
+		if err := passwordPolicyFromEnv(bc).Validate(long); err == nil {
+			t.Error("bcrypt accepted a password past 72 bytes")
+		}
+
+		// The reason for the cap: bcrypt cannot hash the longer password.
+		if _, err := bc.Hash(long); err == nil {
+			t.Error("bcrypt hashed a password past 72 bytes")
+		}
+	})
+}
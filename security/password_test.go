@@ -0,0 +1,211 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// fastArgon2idParams keep the hasher-level tests quick; the package-level
+// functions still use DefaultArgon2idParams.
+var fastArgon2idParams = Argon2idParams{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+// openwallBcrypt is a bcrypt test vector from the OpenBSD/OpenWall suite, a
+// hash this service never produced itself.
+const (
+	openwallBcryptPassword = "U*U"
+	openwallBcryptHash     = "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW"
+)
+
+var phcPattern = regexp.MustCompile(`^\$argon2id\$v=19\$m=\d+,t=\d+,p=\d+\$[A-Za-z0-9+/]+\$[A-Za-z0-9+/]+$`)
+
+func TestArgon2idPHC(t *testing.T) {
+	h := NewArgon2idHasher(fastArgon2idParams)
+
+	hash, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !phcPattern.MatchString(hash) || !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("hash %q is not a PHC string with the hasher's parameters", hash)
+	}
+
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params != fastArgon2idParams || len(salt) != 16 || len(key) != 32 {
+		t.Errorf("parsed %+v with %d byte salt and %d byte key", params, len(salt), len(key))
+	}
+
+	if err := h.Verify(hash, "correct horse"); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if err := h.Verify(hash, "correct horse "); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("Verify wrong password = %v, want ErrPasswordMismatch", err)
+	}
+
+	other, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == hash {
+		t.Error("two hashes of the same password share a salt")
+	}
+}
+
+func TestParseArgon2idMalformed(t *testing.T) {
+	h := NewArgon2idHasher(fastArgon2idParams)
+	good, err := h.Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(good, "$")
+
+	with := func(i int, value string) string {
+		p := append([]string(nil), parts...)
+		p[i] = value
+		return strings.Join(p, "$")
+	}
+
+	tests := map[string]string{
+		"empty":          "",
+		"too few parts":  strings.Join(parts[:5], "$"),
+		"too many parts": good + "$extra",
+		"argon2i":        with(1, "argon2i"),
+		"old version":    with(2, "v=16"),
+		"no version":     with(2, "19"),
+		"bad params":     with(3, "m=64,t=1"),
+		"params order":   with(3, "t=1,m=64,p=1"),
+		"bad salt":       with(4, "not*base64"),
+		"padded salt":    with(4, parts[4]+"=="),
+		"bad key":        with(5, "not*base64"),
+		"empty key":      with(5, ""),
+	}
+
+	for name, hash := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, _, err := parseArgon2id(hash); !errors.Is(err, ErrMalformedPHCString) {
+				t.Errorf("parseArgon2id(%q) = %v, want ErrMalformedPHCString", hash, err)
+			}
+			if err := h.Verify(hash, "pw"); err == nil {
+				t.Error("Verify accepted a malformed hash")
+			}
+			if !h.NeedsRehash(hash) {
+				t.Error("malformed hash does not need a rehash")
+			}
+		})
+	}
+}
+
+func TestArgon2idNeedsRehash(t *testing.T) {
+	current := Argon2idParams{Memory: 128, Time: 2, Threads: 2, SaltLen: 16, KeyLen: 32}
+	h := NewArgon2idHasher(current)
+
+	tests := []struct {
+		name   string
+		params Argon2idParams
+		want   bool
+	}{
+		{"same", current, false},
+		{"stronger", Argon2idParams{Memory: 256, Time: 3, Threads: 2, SaltLen: 32, KeyLen: 64}, false},
+		{"less memory", Argon2idParams{Memory: 64, Time: 2, Threads: 2, SaltLen: 16, KeyLen: 32}, true},
+		{"fewer passes", Argon2idParams{Memory: 128, Time: 1, Threads: 2, SaltLen: 16, KeyLen: 32}, true},
+		{"other threads", Argon2idParams{Memory: 128, Time: 2, Threads: 4, SaltLen: 16, KeyLen: 32}, true},
+		{"shorter salt", Argon2idParams{Memory: 128, Time: 2, Threads: 2, SaltLen: 8, KeyLen: 32}, true},
+		{"shorter key", Argon2idParams{Memory: 128, Time: 2, Threads: 2, SaltLen: 16, KeyLen: 16}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := NewArgon2idHasher(tt.params).Hash("pw")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := h.NeedsRehash(hash); got != tt.want {
+				t.Errorf("NeedsRehash = %v, want %v", got, tt.want)
+			}
+			// Older parameters must keep verifying until the rehash happens.
+			if err := h.Verify(hash, "pw"); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestBcryptHasher(t *testing.T) {
+	h := NewBcryptHasher(5)
+
+	if err := h.Verify(openwallBcryptHash, openwallBcryptPassword); err != nil {
+		t.Errorf("Verify known vector: %v", err)
+	}
+	if err := h.Verify(openwallBcryptHash, "U*V"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("Verify wrong password = %v, want ErrPasswordMismatch", err)
+	}
+	if h.NeedsRehash(openwallBcryptHash) {
+		t.Error("cost 5 hash needs a rehash at cost 5")
+	}
+	if !NewBcryptHasher(10).NeedsRehash(openwallBcryptHash) {
+		t.Error("cost 5 hash does not need a rehash at cost 10")
+	}
+	if !h.NeedsRehash("$2a$xx$garbage") {
+		t.Error("malformed bcrypt hash does not need a rehash")
+	}
+}
+
+// TestLegacyBcryptRehash walks a stored bcrypt hash through the login-time
+// upgrade to argon2id.
+func TestLegacyBcryptRehash(t *testing.T) {
+	if GetPasswordHasher().ID() != "argon2id" {
+		t.Skip("PASSWORD_HASHER selects bcrypt")
+	}
+
+	legacy := []string{openwallBcryptHash, strings.Replace(openwallBcryptHash, "$2a$", "$2b$", 1)}
+	for _, hash := range legacy {
+		t.Run(hash[:4], func(t *testing.T) {
+			if err := VerifyPassword(hash, openwallBcryptPassword); err != nil {
+				t.Fatalf("VerifyPassword legacy: %v", err)
+			}
+			if !PasswordNeedsRehash(hash) {
+				t.Fatal("legacy bcrypt hash does not need a rehash")
+			}
+
+			upgraded, err := EncryptPassword(openwallBcryptPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(upgraded, fmt.Sprintf("$argon2id$v=19$m=%d,t=%d,p=%d$",
+				DefaultArgon2idParams.Memory, DefaultArgon2idParams.Time, DefaultArgon2idParams.Threads)) {
+				t.Fatalf("upgraded hash %q", upgraded)
+			}
+			if err := VerifyPassword(upgraded, openwallBcryptPassword); err != nil {
+				t.Errorf("VerifyPassword upgraded: %v", err)
+			}
+			if PasswordNeedsRehash(upgraded) {
+				t.Error("fresh argon2id hash needs a rehash")
+			}
+		})
+	}
+
+	weak, err := NewArgon2idHasher(fastArgon2idParams).Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyPassword(weak, "pw"); err != nil {
+		t.Errorf("VerifyPassword weak argon2id: %v", err)
+	}
+	if !PasswordNeedsRehash(weak) {
+		t.Error("argon2id hash with weaker parameters does not need a rehash")
+	}
+
+	for _, hash := range []string{"", "plaintext", "$1$md5crypt$hash", "$scrypt$ln=15$salt$key"} {
+		if err := VerifyPassword(hash, "pw"); !errors.Is(err, ErrUnknownHashFormat) {
+			t.Errorf("VerifyPassword(%q) = %v, want ErrUnknownHashFormat", hash, err)
+		}
+		if !PasswordNeedsRehash(hash) {
+			t.Errorf("PasswordNeedsRehash(%q) = false", hash)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package security
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+const PKCEMethodS256 = "S256"
+
+// RFC 7636 section 4.1: 43-128 characters from the unreserved set.
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// A S256 challenge is an unpadded base64url SHA-256 digest.
+var codeChallengePattern = regexp.MustCompile(`^[A-Za-z0-9\-_]{43}$`)
+
+func ValidCodeChallenge(challenge string) bool {
+	return codeChallengePattern.MatchString(challenge)
+}
+
+// VerifyPKCE checks verifier against an S256 challenge.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
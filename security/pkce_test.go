@@ -0,0 +1,69 @@
+package security
+
+import (
+	"strings"
+	"testing"
+)
+
+// RFC 7636 Appendix B.
+const (
+	rfc7636Verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	rfc7636Challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"rfc 7636 appendix b", rfc7636Verifier, rfc7636Challenge, true},
+		{"wrong verifier", "eBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk", rfc7636Challenge, false},
+		{"plain method", rfc7636Verifier, rfc7636Verifier, false},
+		{"padded challenge", rfc7636Verifier, rfc7636Challenge + "=", false},
+		{"verifier too short", rfc7636Verifier[:42], rfc7636Challenge, false},
+		{"verifier too long", strings.Repeat("a", 129), rfc7636Challenge, false},
+		{"verifier bad character", rfc7636Verifier[:42] + "+", rfc7636Challenge, false},
+		{"empty", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("VerifyPKCE = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The 43 and 128 character limits are inclusive.
+	for _, n := range []int{43, 128} {
+		verifier := strings.Repeat("A-._~", 26)[:n]
+		if VerifyPKCE(verifier, rfc7636Challenge) {
+			t.Errorf("%d character verifier matched an unrelated challenge", n)
+		}
+		if !codeVerifierPattern.MatchString(verifier) {
+			t.Errorf("%d character verifier rejected", n)
+		}
+	}
+}
+
+func TestValidCodeChallenge(t *testing.T) {
+	tests := []struct {
+		challenge string
+		want      bool
+	}{
+		{rfc7636Challenge, true},
+		{rfc7636Challenge[:42], false},
+		{rfc7636Challenge + "A", false},
+		{rfc7636Challenge[:42] + "=", false},
+		{rfc7636Challenge[:42] + "+", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidCodeChallenge(tt.challenge); got != tt.want {
+			t.Errorf("ValidCodeChallenge(%q) = %v, want %v", tt.challenge, got, tt.want)
+		}
+	}
+}
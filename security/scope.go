@@ -0,0 +1,59 @@
+package security
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// API scopes, on top of the OIDC ones. Reading is covered by "profile".
+const (
+	ScopeProfileWrite = "profile:write"
+	ScopeAPIKeys      = "api_keys"
+)
+
+// UserScopes is every scope a user can grant. A direct password login that
+// asks for nothing in particular gets all of them.
+var UserScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeProfileWrite, ScopeAPIKeys}
+
+// InvalidScopeError names the first requested scope outside what was allowed.
+type InvalidScopeError struct {
+	Scope string
+}
+
+func (e *InvalidScopeError) Error() string {
+	return fmt.Sprintf("scope not allowed: %s", e.Scope)
+}
+
+// ValidateScopes checks that every requested scope is in allowed.
+func ValidateScopes(requested []string, allowed []string) error {
+	for _, scope := range requested {
+		if !HasScope(allowed, scope) {
+			return &InvalidScopeError{Scope: scope}
+		}
+	}
+	return nil
+}
+
+// ClaimScopes returns the scopes granted to a token.
+func ClaimScopes(claims jwt.MapClaims) []string {
+	scope, _ := claims["scope"].(string)
+	return ParseScope(scope)
+}
+
+// MissingScopes returns the required scopes absent from granted.
+func MissingScopes(granted []string, required ...string) []string {
+	var missing []string
+	for _, scope := range required {
+		if !HasScope(granted, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// JoinScopes is the inverse of ParseScope.
+func JoinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
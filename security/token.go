@@ -1,20 +1,74 @@
 package security
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/sing3demons/users/model"
 )
 
+const (
+	AccessTokenExpiration       = 30 * time.Minute
+	RefreshTokenExpiration      = 7 * 24 * time.Hour
+	MFAChallengeExpiration      = 5 * time.Minute
+	EmailVerificationExpiration = 24 * time.Hour
+)
+
+// token_use values for single-purpose tokens. Any token carrying a token_use
+// must never be accepted as an access token.
+const (
+	TokenUseMFAChallenge      = "mfa_challenge"
+	TokenUseEmailVerification = "email_verification"
+	TokenUseID                = "id"
+)
+
+// sub_type values telling a human user apart from a client acting on its own.
+const (
+	SubjectTypeUser   = "user"
+	SubjectTypeClient = "client"
+)
+
 type RegisteredClaims struct {
 	jwt.RegisteredClaims
-	UserName string `json:"username,omitempty"`
-	Email    string `json:"email,omitempty"`
+	UserName    string   `json:"username,omitempty"`
+	Email       string   `json:"email,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Tenant      string   `json:"tenant,omitempty"`
+	SessionID   string   `json:"sid,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	SubjectType string   `json:"sub_type,omitempty"`
+	TokenUse    string   `json:"token_use,omitempty"`
+}
+
+type TokenOption func(*RegisteredClaims)
+
+func WithScopes(scopes ...string) TokenOption {
+	return func(c *RegisteredClaims) {
+		c.Scope = strings.Join(scopes, " ")
+	}
+}
+
+func WithClientID(clientId string) TokenOption {
+	return func(c *RegisteredClaims) {
+		c.ClientID = clientId
+	}
+}
+
+// WithSessionID binds the token to a server-side session; Authorization
+// rejects it once the session is revoked.
+func WithSessionID(sid string) TokenOption {
+	return func(c *RegisteredClaims) {
+		c.SessionID = sid
+	}
 }
 
 /*
@@ -22,26 +76,124 @@ type RegisteredClaims struct {
 	    mkdir -p cert
 		openssl genrsa -out cert/id_rsa 4096
 		openssl rsa -in cert/id_rsa -pubout -out cert/id_rsa.pub
+
+	 -> Rotate key (JWT_KEYS_DIR=keys)
+		openssl genrsa -out keys/2024-02.pem 4096
+		openssl rsa -in keys/2024-01.pem -pubout -out keys/2024-01.pub && rm keys/2024-01.pem
 */
-func GenerateToken(user model.User) (token string, err error) {
-	privateKey, err := getSecretPrivateKeyFromEnv()
+func GenerateToken(user model.User, opts ...TokenOption) (token string, err error) {
+	keys, err := GetKeySet()
+	if err != nil {
+		return "", err
+	}
+
+	claims := newClaims(user.ID.Hex(), SubjectTypeUser)
+
+	if user.Email != "" {
+		claims.Email = user.Email
+	}
+
+	if user.Username != "" {
+		claims.UserName = user.Username
+	}
+
+	claims.Roles = []string{user.RoleName()}
+	claims.Tenant = user.Tenant
+
+	for _, opt := range opts {
+		opt(claims)
+	}
+
+	// Roles grant admin permissions regardless of scope, so they stay out of
+	// tokens issued to OAuth clients.
+	if claims.ClientID != "" {
+		claims.Roles = nil
+	}
+
+	return signWithActiveKey(keys, claims)
+}
+
+// GenerateClientToken issues an access token for a client acting on its own
+// behalf (client_credentials); its subject is the client id.
+func GenerateClientToken(client model.OAuthClient, opts ...TokenOption) (string, error) {
+	keys, err := GetKeySet()
 	if err != nil {
 		return "", err
 	}
 
-	rsa, err := jwt.ParseRSAPrivateKeyFromPEM(privateKey)
+	claims := newClaims(client.ClientID, SubjectTypeClient)
+	claims.ClientID = client.ClientID
+
+	for _, opt := range opts {
+		opt(claims)
+	}
+
+	return signWithActiveKey(keys, claims)
+}
+
+// GenerateMFAChallenge issues the short-lived token exchanged, together with
+// a second factor, at /auth/mfa/verify.
+func GenerateMFAChallenge(user model.User, opts ...TokenOption) (string, error) {
+	return generatePurposeToken(user, TokenUseMFAChallenge, MFAChallengeExpiration, opts...)
+}
+
+func ValidateMFAChallenge(token string) (jwt.MapClaims, error) {
+	return validatePurposeToken(token, TokenUseMFAChallenge)
+}
+
+// GenerateEmailVerificationToken signs the link emailed after registration.
+// It is bound to the address so it stops working if the email changes.
+func GenerateEmailVerificationToken(user model.User) (string, error) {
+	return generatePurposeToken(user, TokenUseEmailVerification, EmailVerificationExpiration, func(c *RegisteredClaims) {
+		c.Email = user.Email
+	})
+}
+
+func ValidateEmailVerificationToken(token string) (jwt.MapClaims, error) {
+	return validatePurposeToken(token, TokenUseEmailVerification)
+}
+
+func generatePurposeToken(user model.User, use string, ttl time.Duration, opts ...TokenOption) (string, error) {
+	keys, err := GetKeySet()
 	if err != nil {
 		return "", err
 	}
 
+	claims := newClaims(user.ID.Hex(), SubjectTypeUser)
+	claims.TokenUse = use
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(ttl))
+
+	for _, opt := range opts {
+		opt(claims)
+	}
+
+	return signWithActiveKey(keys, claims)
+}
+
+func validatePurposeToken(token string, use string) (jwt.MapClaims, error) {
+	claims, err := ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if got, _ := claims["token_use"].(string); got != use {
+		return nil, fmt.Errorf("validate: token_use is not %s", use)
+	}
+
+	return claims, nil
+}
+
+func newClaims(subject, subjectType string) *RegisteredClaims {
 	claims := &RegisteredClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   user.ID.Hex(),
+			ID:        uuid.NewString(),
+			Subject:   subject,
 			Issuer:    os.Getenv("ISSUER"),
 			Audience:  jwt.ClaimStrings{},
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 30)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenExpiration)),
 		},
+		SubjectType: subjectType,
 	}
 
 	if os.Getenv("AUDIENCE") != "" {
@@ -49,33 +201,38 @@ func GenerateToken(user model.User) (token string, err error) {
 		claims.Audience = append(claims.Audience, audience...)
 	}
 
-	if user.Email != "" {
-		claims.Email = user.Email
-	}
-
-	if user.Username != "" {
-		claims.UserName = user.Username
-	}
+	return claims
+}
 
-	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(rsa)
+func signWithActiveKey(keys *KeySet, claims jwt.Claims) (string, error) {
+	active := keys.Active()
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = active.KID
+	return t.SignedString(active.PrivateKey)
 }
 
 func ValidateToken(token string) (jwt.MapClaims, error) {
-	publicKey, err := getSecretPublicKeyFromEnv()
+	keys, err := GetKeySet()
 	if err != nil {
 		return nil, err
 	}
 
-	key, err := jwt.ParseRSAPublicKeyFromPEM(publicKey)
-	if err != nil {
-		return nil, fmt.Errorf("validate: parse key: %w", err)
-	}
-
 	tok, err := jwt.Parse(token, func(jwtToken *jwt.Token) (interface{}, error) {
 		if _, ok := jwtToken.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, fmt.Errorf("unexpected method: %s", jwtToken.Header["alg"])
 		}
-		return key, nil
+
+		// Tokens issued before kids were introduced carry none.
+		kid, _ := jwtToken.Header["kid"].(string)
+		if kid == "" {
+			return keys.Active().PublicKey, nil
+		}
+
+		key, ok := keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown kid: %s", kid)
+		}
+		return key.PublicKey, nil
 	})
 	if err != nil {
 		return nil, fmt.Errorf("validate: %w", err)
@@ -88,6 +245,22 @@ func ValidateToken(token string) (jwt.MapClaims, error) {
 
 	return claims, nil
 }
+
+// GenerateOpaqueToken returns a random URL-safe token. Only its HashToken
+// digest should be persisted.
+func GenerateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func getSecretPrivateKeyFromEnv() (privateKey []byte, err error) {
 	private := os.Getenv("PRIVATE_KEY")
 	if private == "" {
@@ -103,19 +276,3 @@ func getSecretPrivateKeyFromEnv() (privateKey []byte, err error) {
 	}
 	return privateKey, nil
 }
-
-func getSecretPublicKeyFromEnv() (publicKey []byte, err error) {
-	public := os.Getenv("PUBLIC_KEY")
-	if public == "" {
-		b, err := os.ReadFile("cert/id_rsa.pub")
-		if err != nil {
-			return nil, err
-		}
-		public = base64.StdEncoding.EncodeToString(b)
-	}
-	publicKey, err = base64.StdEncoding.DecodeString(public)
-	if err != nil {
-		return nil, err
-	}
-	return publicKey, nil
-}
@@ -0,0 +1,141 @@
+package security
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of RFC 6238 Appendix B,
+// "12345678901234567890", in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 Appendix B SHA-1 vectors. The RFC lists 8 digits; a 6 digit code
+// is the same value mod 10^6, i.e. its last six digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != "12345678901234567890" {
+		t.Fatalf("secret decodes to %q", key)
+	}
+
+	for _, v := range rfc6238Vectors {
+		want := v.code[len(v.code)-totpDigits:]
+		if got := totpCode(key, v.unix/totpPeriod); got != want {
+			t.Errorf("T=%d: code = %s, want %s", v.unix, got, want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		code := v.code[len(v.code)-totpDigits:]
+		at := time.Unix(v.unix, 0)
+		step := v.unix / totpPeriod
+
+		tests := []struct {
+			name   string
+			secret string
+			code   string
+			now    time.Time
+			ok     bool
+		}{
+			{"exact", rfc6238Secret, code, at, true},
+			{"lowercase secret", strings.ToLower(rfc6238Secret), code, at, true},
+			{"one step late", rfc6238Secret, code, at.Add(totpPeriod * time.Second), true},
+			{"one step early", rfc6238Secret, code, at.Add(-totpPeriod * time.Second), true},
+			{"two steps late", rfc6238Secret, code, at.Add(2 * totpPeriod * time.Second), false},
+			{"two steps early", rfc6238Secret, code, at.Add(-2 * totpPeriod * time.Second), false},
+			{"eight digits", rfc6238Secret, v.code, at, false},
+			{"short", rfc6238Secret, code[1:], at, false},
+			{"wrong secret", "JBSWY3DPEHPK3PXP", code, at, false},
+			{"invalid secret", "not base32!", code, at, false},
+		}
+
+		for _, tt := range tests {
+			if tt.now.Unix() < 0 {
+				continue
+			}
+			gotStep, ok := ValidateTOTP(tt.secret, tt.code, tt.now)
+			if ok != tt.ok {
+				t.Errorf("T=%d %s: ok = %v, want %v", v.unix, tt.name, ok, tt.ok)
+			}
+			if ok && gotStep != step {
+				t.Errorf("T=%d %s: step = %d, want %d", v.unix, tt.name, gotStep, step)
+			}
+		}
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("Acme Users", "alice@example.com", rfc6238Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Acme Users:alice@example.com" {
+		t.Errorf("uri = %s", uri)
+	}
+	q := uri.Query()
+	for key, want := range map[string]string{
+		"secret": rfc6238Secret, "issuer": "Acme Users", "algorithm": "SHA1", "digits": "6", "period": "30",
+	} {
+		if got := q.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("got %d codes", len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || code != strings.ToLower(code) {
+			t.Errorf("code %q is not xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+
+		compact := strings.ToUpper(strings.ReplaceAll(code, "-", ""))
+		for _, input := range []string{code, compact, " " + code + " ", code[:5] + " " + code[6:]} {
+			if got := NormalizeRecoveryCode(input); got != code {
+				t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", input, got, code)
+			}
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package security
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers accepted for credentials.
+const (
+	COSEAlgES256 = -7
+	COSEAlgRS256 = -257
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// AAGUID extension carried by packed attestation certificates.
+var oidAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+var ErrWebAuthnVerification = errors.New("webauthn verification failed")
+
+type AuthenticatorData struct {
+	RPIDHash            []byte
+	Flags               byte
+	SignCount           uint32
+	AAGUID              []byte
+	CredentialID        []byte
+	CredentialPublicKey []byte
+}
+
+func (a *AuthenticatorData) UserPresent() bool {
+	return a.Flags&flagUserPresent != 0
+}
+
+func (a *AuthenticatorData) UserVerified() bool {
+	return a.Flags&flagUserVerified != 0
+}
+
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin,omitempty"`
+}
+
+type AttestationObject struct {
+	Format      string
+	Statement   map[any]any
+	RawAuthData []byte
+	AuthData    *AuthenticatorData
+}
+
+func ParseClientData(raw []byte) (*ClientData, error) {
+	cd := ClientData{}
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, fmt.Errorf("webauthn: client data: %w", err)
+	}
+	return &cd, nil
+}
+
+func ParseAuthenticatorData(raw []byte) (*AuthenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, errors.New("webauthn: authenticator data too short")
+	}
+
+	ad := AuthenticatorData{
+		RPIDHash:  raw[:32],
+		Flags:     raw[32],
+		SignCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	if ad.Flags&flagAttested == 0 {
+		return &ad, nil
+	}
+
+	rest := raw[37:]
+	if len(rest) < 18 {
+		return nil, errors.New("webauthn: attested credential data too short")
+	}
+	ad.AAGUID = rest[:16]
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return nil, errors.New("webauthn: credential id truncated")
+	}
+	ad.CredentialID = rest[:idLen]
+	rest = rest[idLen:]
+
+	_, n, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: credential public key: %w", err)
+	}
+	ad.CredentialPublicKey = rest[:n]
+
+	return &ad, nil
+}
+
+func ParseAttestationObject(raw []byte) (*AttestationObject, error) {
+	v, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: attestation object: %w", err)
+	}
+
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.New("webauthn: attestation object is not a map")
+	}
+
+	format, _ := m["fmt"].(string)
+	statement, _ := m["attStmt"].(map[any]any)
+	authData, _ := m["authData"].([]byte)
+	if format == "" || statement == nil || authData == nil {
+		return nil, errors.New("webauthn: attestation object is incomplete")
+	}
+
+	ad, err := ParseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if ad.CredentialID == nil {
+		return nil, errors.New("webauthn: attestation has no credential")
+	}
+
+	return &AttestationObject{Format: format, Statement: statement, RawAuthData: authData, AuthData: ad}, nil
+}
+
+// VerifyAttestation checks the attestation statement and returns its type:
+// "none", "self" or "basic". Basic attestation certificates are checked for
+// well-formedness but not chained to a vendor root.
+func VerifyAttestation(att *AttestationObject, clientDataHash []byte) (string, error) {
+	switch att.Format {
+	case "none":
+		if len(att.Statement) != 0 {
+			return "", errors.New("webauthn: none attestation with statement")
+		}
+		return "none", nil
+	case "packed":
+		return verifyPacked(att, clientDataHash)
+	default:
+		return "", fmt.Errorf("webauthn: unsupported attestation format %q", att.Format)
+	}
+}
+
+func verifyPacked(att *AttestationObject, clientDataHash []byte) (string, error) {
+	alg, ok := att.Statement["alg"].(int64)
+	if !ok {
+		return "", errors.New("webauthn: packed attestation without alg")
+	}
+	sig, ok := att.Statement["sig"].([]byte)
+	if !ok {
+		return "", errors.New("webauthn: packed attestation without sig")
+	}
+
+	signed := append(append([]byte{}, att.RawAuthData...), clientDataHash...)
+
+	x5c, hasCert := att.Statement["x5c"].([]any)
+	if !hasCert {
+		key, credAlg, err := ParseCOSEKey(att.AuthData.CredentialPublicKey)
+		if err != nil {
+			return "", err
+		}
+		if credAlg != alg {
+			return "", errors.New("webauthn: self attestation alg mismatch")
+		}
+		if err := verifySignature(key, alg, signed, sig); err != nil {
+			return "", err
+		}
+		return "self", nil
+	}
+
+	if len(x5c) == 0 {
+		return "", errors.New("webauthn: empty x5c")
+	}
+	der, ok := x5c[0].([]byte)
+	if !ok {
+		return "", errors.New("webauthn: malformed x5c")
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return "", fmt.Errorf("webauthn: attestation certificate: %w", err)
+	}
+
+	if err := checkPackedCertificate(cert, att.AuthData.AAGUID); err != nil {
+		return "", err
+	}
+	if err := verifySignature(cert.PublicKey, alg, signed, sig); err != nil {
+		return "", err
+	}
+
+	return "basic", nil
+}
+
+// checkPackedCertificate applies the WebAuthn §8.2.1 certificate requirements.
+func checkPackedCertificate(cert *x509.Certificate, aaguid []byte) error {
+	if cert.Version != 3 {
+		return errors.New("webauthn: attestation certificate must be v3")
+	}
+	if cert.BasicConstraintsValid && cert.IsCA {
+		return errors.New("webauthn: attestation certificate must not be a CA")
+	}
+
+	subject := cert.Subject
+	if len(subject.Country) == 0 || len(subject.Organization) == 0 || subject.CommonName == "" ||
+		len(subject.OrganizationalUnit) == 0 || subject.OrganizationalUnit[0] != "Authenticator Attestation" {
+		return errors.New("webauthn: attestation certificate subject is invalid")
+	}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidAAGUID) {
+			continue
+		}
+		if ext.Critical {
+			return errors.New("webauthn: aaguid extension must not be critical")
+		}
+		var value []byte
+		if _, err := asn1.Unmarshal(ext.Value, &value); err != nil || !bytes.Equal(value, aaguid) {
+			return errors.New("webauthn: aaguid mismatch")
+		}
+	}
+
+	return nil
+}
+
+// ParseCOSEKey decodes an EC2 P-256 or RSA COSE_Key.
+func ParseCOSEKey(raw []byte) (crypto.PublicKey, int64, error) {
+	v, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("webauthn: cose key: %w", err)
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, 0, errors.New("webauthn: cose key is not a map")
+	}
+
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == COSEAlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, errors.New("webauthn: invalid EC2 key")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, 0, errors.New("webauthn: EC2 point not on curve")
+		}
+		return key, alg, nil
+	case kty == 3 && alg == COSEAlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, errors.New("webauthn: invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, alg, nil
+	default:
+		return nil, 0, fmt.Errorf("webauthn: unsupported key type %d alg %d", kty, alg)
+	}
+}
+
+// VerifyAssertion checks an assertion signature over authData and the hash
+// of clientDataJSON using the stored COSE public key.
+func VerifyAssertion(coseKey, authData, clientDataJSON, sig []byte) error {
+	key, alg, err := ParseCOSEKey(coseKey)
+	if err != nil {
+		return err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+	return verifySignature(key, alg, signed, sig)
+}
+
+func verifySignature(key crypto.PublicKey, alg int64, signed, sig []byte) error {
+	digest := sha256.Sum256(signed)
+
+	switch alg {
+	case COSEAlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || !ecdsa.VerifyASN1(pub, digest[:], sig) {
+			return ErrWebAuthnVerification
+		}
+		return nil
+	case COSEAlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return ErrWebAuthnVerification
+		}
+		return nil
+	default:
+		return fmt.Errorf("webauthn: unsupported alg %d", alg)
+	}
+}
@@ -0,0 +1,314 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAAGUID = []byte("0123456789abcdef")
+
+// softAuthenticator produces attestations and assertions the way a
+// hardware authenticator would, with a P-256 credential key.
+type softAuthenticator struct {
+	t            *testing.T
+	rpID         string
+	credentialID []byte
+	key          *ecdsa.PrivateKey
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{t: t, rpID: "example.com", credentialID: []byte("credential-1"), key: key}
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	x := a.key.X.FillBytes(make([]byte, 32))
+	y := a.key.Y.FillBytes(make([]byte, 32))
+	return encodeCBOR(cborMap{
+		{int64(1), int64(2)},
+		{int64(3), int64(COSEAlgES256)},
+		{int64(-1), int64(1)},
+		{int64(-2), x},
+		{int64(-3), y},
+	})
+}
+
+func (a *softAuthenticator) authData(flags byte, signCount uint32, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	out := append(rpIDHash[:], flags)
+	out = binary.BigEndian.AppendUint32(out, signCount)
+	if attested {
+		out = append(out, testAAGUID...)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(a.credentialID)))
+		out = append(out, a.credentialID...)
+		out = append(out, a.coseKey()...)
+	}
+	return out
+}
+
+func (a *softAuthenticator) sign(key *ecdsa.PrivateKey, authData, clientDataHash []byte) []byte {
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash...))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return sig
+}
+
+func (a *softAuthenticator) attestationObject(format string, statement cborMap, authData []byte) []byte {
+	return encodeCBOR(cborMap{{"fmt", format}, {"attStmt", statement}, {"authData", authData}})
+}
+
+// attestationCertificate is a batch certificate meeting WebAuthn §8.2.1,
+// adjusted by edit.
+func attestationCertificate(t *testing.T, key *ecdsa.PrivateKey, edit func(*x509.Certificate)) []byte {
+	t.Helper()
+
+	aaguid, err := asn1.Marshal(testAAGUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Country:            []string{"US"},
+			Organization:       []string{"Test Vendor"},
+			OrganizationalUnit: []string{"Authenticator Attestation"},
+			CommonName:         "Test Batch 1",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		ExtraExtensions:       []pkix.Extension{{Id: oidAAGUID, Value: aaguid}},
+	}
+	if edit != nil {
+		edit(template)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestParseAuthenticatorData(t *testing.T) {
+	a := newSoftAuthenticator(t)
+	full := a.authData(flagUserPresent|flagUserVerified|flagAttested, 7, true)
+
+	ad, err := ParseAuthenticatorData(full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ad.UserPresent() || !ad.UserVerified() || ad.SignCount != 7 ||
+		string(ad.AAGUID) != string(testAAGUID) || string(ad.CredentialID) != "credential-1" ||
+		string(ad.CredentialPublicKey) != string(a.coseKey()) {
+		t.Errorf("parsed %+v", ad)
+	}
+
+	// Extensions may follow the key; they must not end up in it.
+	withExtensions := append(append([]byte{}, full...), encodeCBOR(cborMap{{"credProtect", int64(2)}})...)
+	withExtensions[32] |= 0x80
+	if ad, err := ParseAuthenticatorData(withExtensions); err != nil || string(ad.CredentialPublicKey) != string(a.coseKey()) {
+		t.Errorf("with extensions: %v", err)
+	}
+
+	assertion := a.authData(flagUserPresent, 8, false)
+	if ad, err := ParseAuthenticatorData(assertion); err != nil || ad.UserVerified() || ad.CredentialID != nil {
+		t.Errorf("assertion data: %+v, %v", ad, err)
+	}
+
+	idLen := 37 + 16
+	for name, raw := range map[string][]byte{
+		"empty":                   nil,
+		"short":                   full[:36],
+		"attested without data":   full[:37],
+		"attested short aaguid":   full[:idLen+1],
+		"credential id truncated": full[:idLen+2+5],
+		"key truncated":           full[:len(full)-3],
+		"key not cbor":            append(append([]byte{}, full[:idLen+2+len(a.credentialID)]...), 0xff),
+	} {
+		if _, err := ParseAuthenticatorData(raw); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestParseAttestationObjectRejects(t *testing.T) {
+	a := newSoftAuthenticator(t)
+	authData := a.authData(flagUserPresent|flagAttested, 0, true)
+
+	for name, raw := range map[string][]byte{
+		"not cbor":         {0xff},
+		"not a map":        encodeCBOR([]any{"none"}),
+		"no fmt":           encodeCBOR(cborMap{{"attStmt", cborMap{}}, {"authData", authData}}),
+		"no attStmt":       encodeCBOR(cborMap{{"fmt", "none"}, {"authData", authData}}),
+		"authData as text": encodeCBOR(cborMap{{"fmt", "none"}, {"attStmt", cborMap{}}, {"authData", "x"}}),
+		"no credential":    a.attestationObject("none", cborMap{}, a.authData(flagUserPresent, 0, false)),
+		"truncated":        a.attestationObject("none", cborMap{}, authData)[:40],
+	} {
+		if _, err := ParseAttestationObject(raw); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestVerifyAttestation(t *testing.T) {
+	a := newSoftAuthenticator(t)
+	batchKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientDataHash := sha256.Sum256([]byte(`{"type":"webauthn.create","challenge":"abc","origin":"https://example.com"}`))
+	authData := a.authData(flagUserPresent|flagUserVerified|flagAttested, 0, true)
+	selfSig := a.sign(a.key, authData, clientDataHash[:])
+	batchSig := a.sign(batchKey, authData, clientDataHash[:])
+	cert := attestationCertificate(t, batchKey, nil)
+
+	tests := []struct {
+		name      string
+		format    string
+		statement cborMap
+		hash      []byte
+		want      string
+		wantErr   string
+	}{
+		{name: "none", format: "none", statement: cborMap{}, want: "none"},
+		{name: "packed self", format: "packed",
+			statement: cborMap{{"alg", int64(COSEAlgES256)}, {"sig", selfSig}}, want: "self"},
+		{name: "packed basic", format: "packed",
+			statement: cborMap{{"alg", int64(COSEAlgES256)}, {"sig", batchSig}, {"x5c", []any{cert}}}, want: "basic"},
+
+		{name: "none with statement", format: "none",
+			statement: cborMap{{"alg", int64(COSEAlgES256)}}, wantErr: "none attestation with statement"},
+		{name: "unsupported format", format: "tpm", statement: cborMap{}, wantErr: "unsupported attestation format"},
+		{name: "packed without alg", format: "packed",
+			statement: cborMap{{"sig", selfSig}}, wantErr: "without alg"},
+		{name: "packed without sig", format: "packed",
+			statement: cborMap{{"alg", int64(COSEAlgES256)}}, wantErr: "without sig"},
+		{name: "self for other client data", format: "packed",
+			statement: cborMap{{"alg", int64(COSEAlgES256)}, {"sig", selfSig}},
+			hash:      make([]byte, 32), wantErr: ErrWebAuthnVerification.Error()},
+		{name: "self alg mismatch", format: "packed",
+			statement: cborMap{{"alg", int64(COSEAlgRS256)}, {"sig", selfSig}}, wantErr: "alg mismatch"},
+		{name: "self signed by batch key", format: "packed",
+			statement: cborMap{{"alg", int64(COSEAlgES256)}, {"sig", batchSig}}, wantErr: ErrWebAuthnVerification.Error()},
+		{name: "basic signed by credential key", format: "packed",
+			statement: cborMap{{"alg", int64(COSEAlgES256)}, {"sig", selfSig}, {"x5c", []any{cert}}},
+			wantErr:   ErrWebAuthnVerification.Error()},
+		{name: "empty x5c", format: "packed",
+			statement: cborMap{{"alg", int64(COSEAlgES256)}, {"sig", batchSig}, {"x5c", []any{}}}, wantErr: "empty x5c"},
+		{name: "x5c not bytes", format: "packed",
+			statement: cborMap{{"alg", int64(COSEAlgES256)}, {"sig", batchSig}, {"x5c", []any{"cert"}}}, wantErr: "malformed x5c"},
+		{name: "x5c garbage", format: "packed",
+			statement: cborMap{{"alg", int64(COSEAlgES256)}, {"sig", batchSig}, {"x5c", []any{[]byte{1, 2, 3}}}},
+			wantErr:   "attestation certificate"},
+		{name: "CA certificate", format: "packed",
+			statement: cborMap{{"alg", int64(COSEAlgES256)}, {"sig", batchSig}, {"x5c", []any{
+				attestationCertificate(t, batchKey, func(c *x509.Certificate) { c.IsCA = true }),
+			}}}, wantErr: "must not be a CA"},
+		{name: "wrong OU", format: "packed",
+			statement: cborMap{{"alg", int64(COSEAlgES256)}, {"sig", batchSig}, {"x5c", []any{
+				attestationCertificate(t, batchKey, func(c *x509.Certificate) { c.Subject.OrganizationalUnit = []string{"Sales"} }),
+			}}}, wantErr: "subject is invalid"},
+		{name: "aaguid mismatch", format: "packed",
+			statement: cborMap{{"alg", int64(COSEAlgES256)}, {"sig", batchSig}, {"x5c", []any{
+				attestationCertificate(t, batchKey, func(c *x509.Certificate) {
+					other, _ := asn1.Marshal([]byte("fedcba9876543210"))
+					c.ExtraExtensions = []pkix.Extension{{Id: oidAAGUID, Value: other}}
+				}),
+			}}}, wantErr: "aaguid mismatch"},
+		{name: "critical aaguid", format: "packed",
+			statement: cborMap{{"alg", int64(COSEAlgES256)}, {"sig", batchSig}, {"x5c", []any{
+				attestationCertificate(t, batchKey, func(c *x509.Certificate) { c.ExtraExtensions[0].Critical = true }),
+			}}}, wantErr: "must not be critical"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			att, err := ParseAttestationObject(a.attestationObject(tt.format, tt.statement, authData))
+			if err != nil {
+				t.Fatalf("ParseAttestationObject: %v", err)
+			}
+			hash := tt.hash
+			if hash == nil {
+				hash = clientDataHash[:]
+			}
+
+			got, err := VerifyAttestation(att, hash)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	a := newSoftAuthenticator(t)
+	clientDataJSON := []byte(`{"type":"webauthn.get","challenge":"abc","origin":"https://example.com"}`)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	authData := a.authData(flagUserPresent|flagUserVerified, 9, false)
+	sig := a.sign(a.key, authData, clientDataHash[:])
+
+	if err := VerifyAssertion(a.coseKey(), authData, clientDataJSON, sig); err != nil {
+		t.Fatalf("valid assertion: %v", err)
+	}
+
+	tampered := append([]byte{}, authData...)
+	tampered[32] &^= flagUserVerified
+	if err := VerifyAssertion(a.coseKey(), tampered, clientDataJSON, sig); !errors.Is(err, ErrWebAuthnVerification) {
+		t.Errorf("tampered flags: %v", err)
+	}
+	if err := VerifyAssertion(a.coseKey(), authData, []byte(`{}`), sig); !errors.Is(err, ErrWebAuthnVerification) {
+		t.Errorf("other client data: %v", err)
+	}
+	if err := VerifyAssertion(newSoftAuthenticator(t).coseKey(), authData, clientDataJSON, sig); !errors.Is(err, ErrWebAuthnVerification) {
+		t.Errorf("other key: %v", err)
+	}
+}
+
+func TestParseCOSEKeyRejects(t *testing.T) {
+	a := newSoftAuthenticator(t)
+	x := a.key.X.FillBytes(make([]byte, 32))
+
+	for name, raw := range map[string][]byte{
+		"not cbor":  {0xff},
+		"not a map": encodeCBOR([]any{int64(2)}),
+		"okp key":   encodeCBOR(cborMap{{int64(1), int64(1)}, {int64(3), int64(-8)}}),
+		"es256 rsa": encodeCBOR(cborMap{{int64(1), int64(3)}, {int64(3), int64(COSEAlgES256)}}),
+		"wrong curve": encodeCBOR(cborMap{{int64(1), int64(2)}, {int64(3), int64(COSEAlgES256)},
+			{int64(-1), int64(2)}, {int64(-2), x}, {int64(-3), x}}),
+		"short coordinate": encodeCBOR(cborMap{{int64(1), int64(2)}, {int64(3), int64(COSEAlgES256)},
+			{int64(-1), int64(1)}, {int64(-2), x[:31]}, {int64(-3), x}}),
+		"off curve": encodeCBOR(cborMap{{int64(1), int64(2)}, {int64(3), int64(COSEAlgES256)},
+			{int64(-1), int64(1)}, {int64(-2), x}, {int64(-3), x}}),
+		"small rsa": encodeCBOR(cborMap{{int64(1), int64(3)}, {int64(3), int64(COSEAlgRS256)},
+			{int64(-1), make([]byte, 128)}, {int64(-2), []byte{1, 0, 1}}}),
+	} {
+		if _, _, err := ParseCOSEKey(raw); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/repository"
+	"github.com/sing3demons/users/security"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	maxAPIKeysPerUser = 25
+	maxAPIKeyDays     = 365
+	apiKeyTouchEvery  = time.Minute
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrTooManyAPIKeys = errors.New("too many api keys")
+)
+
+type IAPIKeyService interface {
+	Create(session string, userId string, req model.CreateAPIKeyRequest) (*model.CreatedAPIKey, error)
+	List(session string, userId string) ([]model.APIKey, error)
+	Revoke(session string, userId string, id string) error
+	Authenticate(session string, key string) (*model.APIKey, error)
+}
+
+type apiKeyService struct {
+	repo repository.IUserRepository
+	keys repository.IAPIKeyRepository
+}
+
+func NewAPIKeyService(repo repository.IUserRepository, keys repository.IAPIKeyRepository) IAPIKeyService {
+	return &apiKeyService{repo: repo, keys: keys}
+}
+
+func (a *apiKeyService) Create(session string, userId string, req model.CreateAPIKeyRequest) (*model.CreatedAPIKey, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, errors.New("name is required and must be at most 100 characters")
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAPIKeyDays {
+		return nil, errors.New("expires_in_days must be between 0 and 365")
+	}
+
+	existing, err := a.keys.ListByUser(session, userId)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxAPIKeysPerUser {
+		return nil, ErrTooManyAPIKeys
+	}
+
+	// A key never gets more than the token creating it was granted, so a
+	// narrowly scoped OAuth token cannot mint a broader, longer-lived key.
+	scopes := security.ParseScope(req.Scope)
+	if len(scopes) == 0 {
+		for _, scope := range security.DefaultScopes {
+			if security.HasScope(req.Granted, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	if err := security.ValidateScopes(scopes, req.Granted); err != nil {
+		return nil, err
+	}
+
+	key, lookup, err := security.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	record := model.APIKey{
+		UserID:    userId,
+		Name:      name,
+		Prefix:    lookup,
+		KeyHash:   security.HashToken(key),
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, req.ExpiresInDays)
+		record.ExpiresAt = &expiresAt
+	}
+
+	created, err := a.keys.Create(session, record)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":   session,
+		"func":   "Create",
+		"file":   "service/apikey.go",
+		"tag":    "apikey",
+		"userId": userId,
+		"prefix": lookup,
+	}).Info("api key created")
+
+	return &model.CreatedAPIKey{APIKey: *created, Key: key}, nil
+}
+
+func (a *apiKeyService) List(session string, userId string) ([]model.APIKey, error) {
+	return a.keys.ListByUser(session, userId)
+}
+
+func (a *apiKeyService) Revoke(session string, userId string, id string) error {
+	revoked, err := a.keys.Revoke(session, userId, id)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrAPIKeyNotFound
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":   session,
+		"func":   "Revoke",
+		"file":   "service/apikey.go",
+		"tag":    "apikey",
+		"userId": userId,
+		"keyId":  id,
+	}).Info("api key revoked")
+
+	return nil
+}
+
+// Authenticate resolves a presented key to its record. Every failure is
+// ErrInvalidAPIKey.
+func (a *apiKeyService) Authenticate(session string, key string) (*model.APIKey, error) {
+	lookup, ok := security.ParseAPIKey(key)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	record, err := a.keys.FindByPrefix(session, lookup)
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	hash := security.HashToken(key)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(record.KeyHash)) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if record.RevokedAt != nil || (record.ExpiresAt != nil && !record.ExpiresAt.After(now)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Keys die with their owner.
+	owner, err := a.repo.FindOne(session, bson.M{
+		"_id":        a.repo.ConvertStringToObjectID(record.UserID),
+		"deleteDate": nil,
+	})
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	record.Tenant = owner.Tenant
+
+	if err := a.keys.Touch(session, record.ID.Hex(), now, apiKeyTouchEvery); err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "Touch",
+			"file":  "service/apikey.go",
+			"tag":   "apikey",
+		}).Error("error")
+	}
+
+	return record, nil
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/repository"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/text/language"
+)
+
+const (
+	maxProfilesPerUser = 20
+	maxProfileName     = 100
+)
+
+var (
+	ErrInvalidLanguage = errors.New("languageCode must be a BCP 47 language tag, e.g. en or th-TH")
+	ErrProfileNotFound = errors.New("profile not found")
+	ErrDefaultProfile  = errors.New("the default language's profile cannot be deleted; change the default first")
+	ErrTooManyProfiles = errors.New("too many profiles")
+)
+
+type IProfileService interface {
+	List(session string, userId string) (*model.User, error)
+	Save(session string, userId string, languageCode string, req model.ProfileRequest) (*model.Profile, error)
+	Delete(session string, userId string, languageCode string) error
+	SetDefault(session string, userId string, languageCode string) error
+}
+
+type profileService struct {
+	repo repository.IUserRepository
+}
+
+func NewProfileService(repo repository.IUserRepository) IProfileService {
+	return &profileService{repo: repo}
+}
+
+// List returns the user's profiles and default language only.
+func (p *profileService) List(session string, userId string) (*model.User, error) {
+	user, err := p.repo.FindOne(session, bson.M{
+		"_id":        p.repo.ConvertStringToObjectID(userId),
+		"deleteDate": nil,
+	}, &options.FindOneOptions{Projection: bson.M{"profiles": 1, "defaultLanguage": 1}})
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.Profiles == nil {
+		user.Profiles = []model.Profile{}
+	}
+
+	return user, nil
+}
+
+// Save creates or replaces the profile in languageCode. The first profile
+// also becomes the default.
+func (p *profileService) Save(session string, userId string, languageCode string, req model.ProfileRequest) (*model.Profile, error) {
+	code, err := NormalizeLanguage(languageCode)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := model.Profile{
+		LanguageCode: code,
+		Prefix:       strings.TrimSpace(req.Prefix),
+		FirstName:    strings.TrimSpace(req.FirstName),
+		LastName:     strings.TrimSpace(req.LastName),
+		NickName:     strings.TrimSpace(req.NickName),
+	}
+	if profile.FirstName == "" && profile.LastName == "" && profile.NickName == "" {
+		return nil, errors.New("firstName, lastName or nickname is required")
+	}
+	for _, name := range []string{profile.Prefix, profile.FirstName, profile.LastName, profile.NickName} {
+		if utf8.RuneCountInString(name) > maxProfileName {
+			return nil, errors.New("names must be at most 100 characters")
+		}
+	}
+
+	user, err := p.List(session, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	profile.ID = uuid.NewString()
+	existing := findProfile(user.Profiles, code)
+	if existing != nil {
+		profile.ID = existing.ID
+	} else if len(user.Profiles) >= maxProfilesPerUser {
+		return nil, ErrTooManyProfiles
+	}
+
+	saved, err := p.repo.SaveProfile(session, userId, profile)
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, ErrUserNotFound
+	}
+
+	if user.DefaultLanguage == "" {
+		if _, err := p.repo.SetDefaultLanguage(session, userId, code); err != nil {
+			return nil, err
+		}
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":         session,
+		"func":         "Save",
+		"file":         "service/language.go",
+		"tag":          "profile",
+		"userId":       userId,
+		"languageCode": code,
+	}).Info("profile saved")
+
+	return &profile, nil
+}
+
+// Delete removes the profile in languageCode. The default language's profile
+// can only go when it is the last one, which also clears the default.
+func (p *profileService) Delete(session string, userId string, languageCode string) error {
+	code, err := NormalizeLanguage(languageCode)
+	if err != nil {
+		return err
+	}
+
+	user, err := p.List(session, userId)
+	if err != nil {
+		return err
+	}
+	if findProfile(user.Profiles, code) == nil {
+		return ErrProfileNotFound
+	}
+
+	isDefault := code == user.DefaultLanguage
+	if isDefault && len(user.Profiles) > 1 {
+		return ErrDefaultProfile
+	}
+
+	// RemoveProfile applies the same rule atomically; the checks above only
+	// pick the error to report.
+	removed, err := p.repo.RemoveProfile(session, userId, code)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		if isDefault {
+			return ErrDefaultProfile
+		}
+		return ErrProfileNotFound
+	}
+
+	return nil
+}
+
+func (p *profileService) SetDefault(session string, userId string, languageCode string) error {
+	code, err := NormalizeLanguage(languageCode)
+	if err != nil {
+		return err
+	}
+
+	updated, err := p.repo.SetDefaultLanguage(session, userId, code)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrProfileNotFound
+	}
+
+	return nil
+}
+
+// NormalizeLanguage returns the canonical form of a BCP 47 tag, so "EN-us"
+// and "en-US" name the same profile.
+func NormalizeLanguage(code string) (string, error) {
+	tag, err := language.Parse(strings.TrimSpace(code))
+	if err != nil || tag == language.Und {
+		return "", ErrInvalidLanguage
+	}
+	return tag.String(), nil
+}
+
+// DefaultLanguage is the language of names given at registration when the
+// client does not say, from DEFAULT_LANGUAGE or "en".
+func DefaultLanguage() string {
+	if code, err := NormalizeLanguage(os.Getenv("DEFAULT_LANGUAGE")); err == nil {
+		return code
+	}
+	return "en"
+}
+
+// SelectProfile picks the user's profile for an Accept-Language header: the
+// best match among the user's languages (so en-GB finds en), else the
+// default language's profile, else the first one. It returns nil when the
+// user has no profiles.
+func SelectProfile(user model.User, acceptLanguage string) *model.Profile {
+	if len(user.Profiles) == 0 {
+		return nil
+	}
+
+	// The matcher falls back to the first supported tag, so the default
+	// language goes first.
+	profiles := make([]model.Profile, 0, len(user.Profiles))
+	if def := findProfile(user.Profiles, user.DefaultLanguage); def != nil {
+		profiles = append(profiles, *def)
+	}
+	for _, profile := range user.Profiles {
+		if profile.LanguageCode != user.DefaultLanguage {
+			profiles = append(profiles, profile)
+		}
+	}
+
+	supported := make([]language.Tag, len(profiles))
+	for i, profile := range profiles {
+		supported[i] = language.Make(profile.LanguageCode)
+	}
+
+	desired, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(desired) == 0 {
+		return &profiles[0]
+	}
+
+	_, index, confidence := language.NewMatcher(supported).Match(desired...)
+	if confidence == language.No {
+		return &profiles[0]
+	}
+	return &profiles[index]
+}
+
+func findProfile(profiles []model.Profile, code string) *model.Profile {
+	for i := range profiles {
+		if profiles[i].LanguageCode == code {
+			return &profiles[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/sing3demons/users/model"
+)
+
+func TestSelectProfile(t *testing.T) {
+	profiles := func(codes ...string) []model.Profile {
+		out := make([]model.Profile, len(codes))
+		for i, code := range codes {
+			out[i] = model.Profile{ID: code, LanguageCode: code}
+		}
+		return out
+	}
+
+	enDefault := model.User{DefaultLanguage: "en", Profiles: profiles("th", "en", "ja")}
+	thDefault := model.User{DefaultLanguage: "th", Profiles: profiles("en", "th")}
+	regional := model.User{DefaultLanguage: "en-US", Profiles: profiles("en-US", "en-GB", "pt-BR")}
+
+	tests := []struct {
+		name           string
+		user           model.User
+		acceptLanguage string
+		want           string
+	}{
+		{"exact match", enDefault, "ja", "ja"},
+		{"exact match over default", thDefault, "en", "en"},
+		{"base language", thDefault, "en-GB", "en"},
+		{"region to base", enDefault, "th-TH", "th"},
+		{"case insensitive", enDefault, "JA-jp", "ja"},
+		{"quality order", enDefault, "fr, ja;q=0.4, th;q=0.8", "th"},
+		{"first acceptable", enDefault, "de, ja", "ja"},
+		{"regional exact", regional, "en-GB", "en-GB"},
+		{"regional by base", regional, "pt", "pt-BR"},
+		{"unknown falls back to default", enDefault, "fr-FR", "en"},
+		{"unknown falls back to default th", thDefault, "de", "th"},
+		{"wildcard", thDefault, "*", "th"},
+		{"empty header", thDefault, "", "th"},
+		{"malformed header", enDefault, "en-;;q=x,", "en"},
+		{"garbage", thDefault, "%%%", "th"},
+		{"missing default uses first", model.User{DefaultLanguage: "de", Profiles: profiles("th", "en")}, "fr", "th"},
+		{"no default uses first", model.User{Profiles: profiles("ja", "en")}, "", "ja"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SelectProfile(tt.user, tt.acceptLanguage)
+			if got == nil {
+				t.Fatal("no profile selected")
+			}
+			if got.LanguageCode != tt.want {
+				t.Errorf("SelectProfile(%q) = %s, want %s", tt.acceptLanguage, got.LanguageCode, tt.want)
+			}
+		})
+	}
+
+	if got := SelectProfile(model.User{DefaultLanguage: "en"}, "en"); got != nil {
+		t.Errorf("user without profiles got %+v", got)
+	}
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := []struct {
+		code    string
+		want    string
+		wantErr bool
+	}{
+		{"en", "en", false},
+		{"EN-us", "en-US", false},
+		{" th-th ", "th-TH", false},
+		{"zh-hant-tw", "zh-Hant-TW", false},
+		{"", "", true},
+		{"und", "", true},
+		{"english", "", true},
+		{"en_US!", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeLanguage(tt.code)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeLanguage(%q) = %q, %v; want %q, error %v", tt.code, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/repository"
+	"github.com/sing3demons/users/security"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	recoveryCodeCount  = 10
+	maxMFAAttempts     = 5
+	mfaLockoutDuration = 15 * time.Minute
+)
+
+var (
+	ErrInvalidMFACode   = errors.New("invalid mfa code")
+	ErrMFANotEnrolled   = errors.New("mfa not enrolled")
+	ErrMFAAlreadyActive = errors.New("mfa already enabled")
+	ErrInvalidMFAToken  = errors.New("invalid mfa token")
+)
+
+// MFARequiredError is returned by Login when the password was correct but a
+// second factor is still needed. Challenge is exchanged at /auth/mfa/verify.
+type MFARequiredError struct {
+	Challenge string
+	ExpiresIn int64
+}
+
+func (e *MFARequiredError) Error() string {
+	return "mfa required"
+}
+
+type IMFAService interface {
+	EnrollTOTP(session string, userId string) (*model.TOTPEnrollment, error)
+	ConfirmTOTP(session string, userId string, code string) ([]string, error)
+	DisableTOTP(session string, userId string, code string) error
+	Verify(session string, req model.MFAVerifyRequest) (*model.Token, error)
+	CheckCode(session string, user model.User, code string, recoveryCode string) error
+}
+
+type mfaService struct {
+	repo        repository.IUserRepository
+	tokens      ITokenService
+	revocations repository.IRevocationRepository
+}
+
+func NewMFAService(repo repository.IUserRepository, tokens ITokenService, revocations repository.IRevocationRepository) IMFAService {
+	return &mfaService{repo: repo, tokens: tokens, revocations: revocations}
+}
+
+// EnrollTOTP stores a pending secret; it only takes effect after ConfirmTOTP
+// proves the authenticator app was set up correctly.
+func (m *mfaService) EnrollTOTP(session string, userId string) (*model.TOTPEnrollment, error) {
+	user, err := m.findUser(session, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.MFA != nil && user.MFA.Enabled {
+		return nil, ErrMFAAlreadyActive
+	}
+
+	secret, err := security.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.repo.SetPendingTOTP(session, userId, secret); err != nil {
+		return nil, err
+	}
+
+	issuer := os.Getenv("MFA_ISSUER")
+	if issuer == "" {
+		issuer = "users-service"
+	}
+
+	account := user.Email
+	if account == "" {
+		account = user.Username
+	}
+
+	return &model.TOTPEnrollment{
+		Secret: secret,
+		URI:    security.TOTPURI(issuer, account, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables MFA and returns the recovery codes, which are never
+// shown again.
+func (m *mfaService) ConfirmTOTP(session string, userId string, code string) ([]string, error) {
+	user, err := m.findUser(session, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.MFA == nil || user.MFA.PendingTOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	step, ok := security.ValidateTOTP(user.MFA.PendingTOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, err := security.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, c := range codes {
+		hashes = append(hashes, security.HashToken(c))
+	}
+
+	if err := m.repo.EnableTOTP(session, userId, user.MFA.PendingTOTPSecret, hashes); err != nil {
+		return nil, err
+	}
+
+	if _, err := m.repo.ConsumeTOTPStep(session, userId, step); err != nil {
+		return nil, err
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":   session,
+		"func":   "ConfirmTOTP",
+		"file":   "service/mfa.go",
+		"tag":    "mfa",
+		"userId": userId,
+	}).Info("totp enabled")
+
+	return codes, nil
+}
+
+func (m *mfaService) DisableTOTP(session string, userId string, code string) error {
+	user, err := m.findUser(session, userId)
+	if err != nil {
+		return err
+	}
+
+	if err := m.CheckCode(session, *user, code, ""); err != nil {
+		return err
+	}
+
+	return m.repo.DisableMFA(session, userId)
+}
+
+func (m *mfaService) Verify(session string, req model.MFAVerifyRequest) (*model.Token, error) {
+	claims, err := security.ValidateMFAChallenge(req.MFAToken)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+
+	// A challenge is good for one attempt. Its jti is revoked before the
+	// code is checked, atomically, so concurrent requests with the same
+	// challenge cannot both get through; a wrong code means signing in again.
+	jti, _ := claims["jti"].(string)
+	expiresAt, _ := claims.GetExpirationTime()
+	if jti == "" || expiresAt == nil {
+		return nil, ErrInvalidMFAToken
+	}
+	first, err := m.revocations.RevokeOnce(session, jti, expiresAt.Time)
+	if err != nil {
+		return nil, err
+	}
+	if !first {
+		return nil, ErrInvalidMFAToken
+	}
+
+	sub, _ := claims.GetSubject()
+	user, err := m.findUser(session, sub)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+
+	if err := m.CheckCode(session, *user, req.Code, req.RecoveryCode); err != nil {
+		return nil, err
+	}
+
+	scope, _ := claims["scope"].(string)
+	issuedAt, _ := claims.GetIssuedAt()
+	grant := model.Grant{Scopes: security.ParseScope(scope), AuthTime: time.Now(), Device: req.Device}
+	if issuedAt != nil {
+		grant.AuthTime = issuedAt.Time
+	}
+
+	return m.tokens.IssueTokens(session, *user, grant)
+}
+
+// CheckCode verifies a TOTP code or, failing that, a recovery code. Accepted
+// codes are consumed so they cannot be replayed.
+func (m *mfaService) CheckCode(session string, user model.User, code string, recoveryCode string) error {
+	if user.MFA == nil || !user.MFA.Enabled {
+		return ErrMFANotEnrolled
+	}
+
+	userId := user.ID.Hex()
+	if user.MFA.LockedUntil != nil && time.Now().Before(*user.MFA.LockedUntil) {
+		return ErrInvalidMFACode
+	}
+
+	if code != "" {
+		if step, ok := security.ValidateTOTP(user.MFA.TOTPSecret, code, time.Now()); ok {
+			consumed, err := m.repo.ConsumeTOTPStep(session, userId, step)
+			if err != nil {
+				return err
+			}
+			if consumed {
+				return nil
+			}
+		}
+	}
+
+	if recoveryCode != "" {
+		hash := security.HashToken(security.NormalizeRecoveryCode(recoveryCode))
+		consumed, err := m.repo.ConsumeRecoveryCode(session, userId, hash)
+		if err != nil {
+			return err
+		}
+		if consumed {
+			logger.WithFields(logger.Fields{
+				"uuid":   session,
+				"func":   "CheckCode",
+				"file":   "service/mfa.go",
+				"tag":    "mfa",
+				"userId": userId,
+			}).Warn("recovery code used")
+			return nil
+		}
+	}
+
+	if err := m.repo.RecordMFAFailure(session, userId, maxMFAAttempts, mfaLockoutDuration); err != nil {
+		return err
+	}
+
+	return ErrInvalidMFACode
+}
+
+func (m *mfaService) findUser(session string, userId string) (*model.User, error) {
+	return m.repo.FindOne(session, bson.M{
+		"_id":        m.repo.ConvertStringToObjectID(userId),
+		"deleteDate": nil,
+	})
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/repository"
+	"github.com/sing3demons/users/security"
+	logger "github.com/sirupsen/logrus"
+)
+
+const authorizationCodeExpiration = 5 * time.Minute
+
+// OAuthError is an RFC 6749 error response.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrMFARequired        = errors.New("mfa required")
+	ErrInvalidClient      = &OAuthError{Code: "invalid_client", Description: "unknown client"}
+	ErrInvalidRedirectURI = &OAuthError{Code: "invalid_request", Description: "redirect_uri is not registered for this client"}
+	ErrInvalidGrant       = &OAuthError{Code: "invalid_grant", Description: "authorization grant is invalid, expired or already used"}
+)
+
+type IOAuthService interface {
+	// ValidateAuthorize checks an authorization request. On error the returned
+	// redirect URI is empty when the error must not be sent to the client.
+	ValidateAuthorize(session string, req model.AuthorizeRequest) (redirectURI string, err error)
+	Authorize(session string, req model.AuthorizeLogin) (location string, err error)
+	Token(session string, req model.TokenRequest) (*model.Token, error)
+}
+
+type oauthService struct {
+	users   IUserService
+	mfa     IMFAService
+	tokens  ITokenService
+	clients repository.IOAuthClientRepository
+	codes   repository.IAuthorizationCodeRepository
+}
+
+func NewOAuthService(users IUserService, mfa IMFAService, tokens ITokenService, clients repository.IOAuthClientRepository, codes repository.IAuthorizationCodeRepository) IOAuthService {
+	return &oauthService{users: users, mfa: mfa, tokens: tokens, clients: clients, codes: codes}
+}
+
+func (o *oauthService) ValidateAuthorize(session string, req model.AuthorizeRequest) (string, error) {
+	_, redirectURI, _, err := o.validateAuthorize(session, req)
+	return redirectURI, err
+}
+
+func (o *oauthService) validateAuthorize(session string, req model.AuthorizeRequest) (*model.OAuthClient, string, []string, error) {
+	if req.ClientID == "" {
+		return nil, "", nil, ErrInvalidClient
+	}
+
+	client, err := o.clients.FindByClientID(session, req.ClientID)
+	if err != nil {
+		return nil, "", nil, ErrInvalidClient
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+
+	// Redirect URIs are compared exactly, never by prefix.
+	registered := false
+	for _, uri := range client.RedirectURIs {
+		if uri == redirectURI {
+			registered = true
+			break
+		}
+	}
+	if !registered {
+		return nil, "", nil, ErrInvalidRedirectURI
+	}
+
+	if !client.AllowsGrant("authorization_code") {
+		return nil, redirectURI, nil, &OAuthError{Code: "unauthorized_client", Description: "client may not use the authorization code grant"}
+	}
+
+	if req.ResponseType != "code" {
+		return nil, redirectURI, nil, &OAuthError{Code: "unsupported_response_type", Description: "only response_type=code is supported"}
+	}
+
+	if req.CodeChallengeMethod != security.PKCEMethodS256 || !security.ValidCodeChallenge(req.CodeChallenge) {
+		return nil, redirectURI, nil, &OAuthError{Code: "invalid_request", Description: "a S256 code_challenge is required"}
+	}
+
+	scopes := security.ParseScope(req.Scope)
+	if len(scopes) == 0 {
+		scopes = security.DefaultScopes
+	}
+
+	allowed := client.Scopes
+	if len(allowed) == 0 {
+		allowed = security.UserScopes
+	}
+	for _, scope := range scopes {
+		if !security.HasScope(allowed, scope) {
+			return nil, redirectURI, nil, &OAuthError{Code: "invalid_scope", Description: "scope not allowed for this client: " + scope}
+		}
+	}
+
+	return client, redirectURI, scopes, nil
+}
+
+func (o *oauthService) Authorize(session string, req model.AuthorizeLogin) (string, error) {
+	client, redirectURI, scopes, err := o.validateAuthorize(session, req.AuthorizeRequest)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := o.users.Authenticate(session, model.Login{Identifier: req.Identifier, Email: req.Email, Password: req.Password, ClientIP: req.ClientIP})
+	if errors.Is(err, ErrEmailNotVerified) {
+		return "", err
+	}
+	if err != nil {
+		return "", ErrInvalidCredentials
+	}
+
+	// The hosted login page collects the second factor in the same post.
+	if user.MFA != nil && user.MFA.Enabled {
+		if req.Code == "" && req.RecoveryCode == "" {
+			return "", ErrMFARequired
+		}
+		if err := o.mfa.CheckCode(session, *user, req.Code, req.RecoveryCode); err != nil {
+			return "", ErrInvalidCredentials
+		}
+	}
+
+	code, err := security.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	// The token request must repeat redirect_uri exactly as it was sent here,
+	// including leaving it out when the registered default was used.
+	now := time.Now()
+	if _, err := o.codes.Create(session, model.AuthorizationCode{
+		CodeHash:      security.HashToken(code),
+		ClientID:      client.ClientID,
+		UserID:        user.ID.Hex(),
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      now,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(authorizationCodeExpiration),
+	}); err != nil {
+		return "", err
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":     session,
+		"func":     "Authorize",
+		"file":     "service/oauth.go",
+		"tag":      "oauth",
+		"clientId": client.ClientID,
+		"userId":   user.ID.Hex(),
+	}).Info("authorization code issued")
+
+	return AuthorizeRedirect(redirectURI, url.Values{"code": {code}}, req.State), nil
+}
+
+func (o *oauthService) Token(session string, req model.TokenRequest) (*model.Token, error) {
+	switch req.GrantType {
+	case "authorization_code":
+		return o.exchangeCode(session, req)
+	case "client_credentials":
+		return o.clientCredentials(session, req)
+	case "refresh_token":
+		return o.refresh(session, req)
+	default:
+		return nil, &OAuthError{Code: "unsupported_grant_type", Description: "grant_type not supported: " + req.GrantType}
+	}
+}
+
+func (o *oauthService) exchangeCode(session string, req model.TokenRequest) (*model.Token, error) {
+	if req.Code == "" || req.ClientID == "" || req.CodeVerifier == "" {
+		return nil, &OAuthError{Code: "invalid_request", Description: "code, client_id and code_verifier are required"}
+	}
+
+	if _, err := o.authenticateClient(session, req); err != nil {
+		return nil, err
+	}
+
+	// Consume before any other check so a code can never be tried twice.
+	code, err := o.codes.Consume(session, security.HashToken(req.Code))
+	if err != nil {
+		return nil, ErrInvalidGrant
+	}
+
+	if time.Now().After(code.ExpiresAt) ||
+		code.ClientID != req.ClientID ||
+		code.RedirectURI != req.RedirectURI ||
+		!security.VerifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+		return nil, ErrInvalidGrant
+	}
+
+	user, err := o.users.GetProfile(session, code.UserID)
+	if err != nil {
+		return nil, ErrInvalidGrant
+	}
+
+	return o.tokens.IssueTokens(session, *user, model.Grant{
+		Scopes:   code.Scopes,
+		ClientID: code.ClientID,
+		Nonce:    code.Nonce,
+		AuthTime: code.AuthTime,
+		Device:   req.Device,
+	})
+}
+
+// refresh only redeems tokens bound to the authenticated client, so a
+// confidential client's tokens are useless without its secret.
+func (o *oauthService) refresh(session string, req model.TokenRequest) (*model.Token, error) {
+	if req.RefreshToken == "" {
+		return nil, &OAuthError{Code: "invalid_request", Description: "refresh_token is required"}
+	}
+
+	client, err := o.authenticateClient(session, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.AllowsGrant("refresh_token") {
+		return nil, &OAuthError{Code: "unauthorized_client", Description: "client may not use the refresh_token grant"}
+	}
+
+	token, err := o.tokens.Refresh(session, req.RefreshToken, client.ClientID)
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		return nil, ErrInvalidGrant
+	}
+	return token, err
+}
+
+func (o *oauthService) clientCredentials(session string, req model.TokenRequest) (*model.Token, error) {
+	client, err := o.authenticateClient(session, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.Confidential() || !client.AllowsGrant("client_credentials") {
+		return nil, &OAuthError{Code: "unauthorized_client", Description: "client may not use the client_credentials grant"}
+	}
+
+	scopes := security.ParseScope(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+
+	for _, scope := range scopes {
+		if !security.HasScope(client.Scopes, scope) {
+			return nil, &OAuthError{Code: "invalid_scope", Description: "scope not allowed for this client: " + scope}
+		}
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":     session,
+		"func":     "clientCredentials",
+		"file":     "service/oauth.go",
+		"tag":      "oauth",
+		"clientId": client.ClientID,
+		"scopes":   scopes,
+	}).Info("client token issued")
+
+	return o.tokens.IssueClientToken(session, *client, scopes)
+}
+
+// authenticateClient loads the client and, for confidential clients, checks
+// the secret. Public clients are identified by client_id alone.
+func (o *oauthService) authenticateClient(session string, req model.TokenRequest) (*model.OAuthClient, error) {
+	if req.ClientID == "" {
+		return nil, ErrInvalidClient
+	}
+
+	client, err := o.clients.FindByClientID(session, req.ClientID)
+	if err != nil {
+		return nil, ErrInvalidClient
+	}
+
+	if client.Confidential() {
+		if req.ClientSecret == "" || security.VerifyPassword(client.SecretHash, req.ClientSecret) != nil {
+			return nil, ErrInvalidClient
+		}
+	}
+
+	return client, nil
+}
+
+// AuthorizeRedirect appends params and state to a registered redirect URI.
+func AuthorizeRedirect(redirectURI string, params url.Values, state string) string {
+	if state != "" {
+		params.Set("state", state)
+	}
+	return appendQuery(redirectURI, params)
+}
+
+func appendQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String()
+}
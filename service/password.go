@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sing3demons/users/mailer"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/repository"
+	"github.com/sing3demons/users/security"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const passwordResetExpiration = 30 * time.Minute
+
+var (
+	ErrInvalidResetToken      = errors.New("invalid or expired reset token")
+	ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+	ErrPasswordUnchanged      = errors.New("new password must differ from the current one")
+)
+
+type IPasswordService interface {
+	Forgot(session string, req model.ForgotPasswordRequest)
+	Reset(session string, req model.ResetPasswordRequest) error
+	Change(session string, userId string, scopes []string, req model.ChangePasswordRequest) (*model.Token, error)
+}
+
+type passwordService struct {
+	repo    repository.IUserRepository
+	resets  repository.IPasswordResetRepository
+	tokens  ITokenService
+	mailer  mailer.Mailer
+	lockout ILockoutService
+}
+
+func NewPasswordService(repo repository.IUserRepository, resets repository.IPasswordResetRepository, tokens ITokenService, mailer mailer.Mailer, lockout ILockoutService) IPasswordService {
+	return &passwordService{repo: repo, resets: resets, tokens: tokens, mailer: mailer, lockout: lockout}
+}
+
+// Forgot emails a reset link when the account exists. It reports nothing to
+// the caller and does its work in the background so neither the response
+// nor its timing reveals whether the email is registered.
+func (p *passwordService) Forgot(session string, req model.ForgotPasswordRequest) {
+	go p.sendResetLink(session, strings.TrimSpace(req.Email))
+}
+
+func (p *passwordService) sendResetLink(session string, email string) {
+	user, err := p.repo.FindOneByEmail(session, email)
+	if err != nil {
+		return
+	}
+
+	token, err := security.GenerateOpaqueToken()
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	if err := p.resets.Create(session, model.PasswordReset{
+		TokenHash: security.HashToken(token),
+		UserID:    user.ID.Hex(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(passwordResetExpiration),
+	}); err != nil {
+		return
+	}
+
+	link := resetLink(token)
+	if err := p.mailer.Send(session, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("We received a request to reset your password.\n\n"+
+			"Open this link within %d minutes to choose a new one:\n%s\n\n"+
+			"If you did not ask for this you can ignore this email.\n",
+			int(passwordResetExpiration.Minutes()), link),
+	}); err != nil {
+		return
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":   session,
+		"func":   "Forgot",
+		"file":   "service/password.go",
+		"tag":    "password",
+		"userId": user.ID.Hex(),
+	}).Info("password reset link sent")
+}
+
+func (p *passwordService) Reset(session string, req model.ResetPasswordRequest) error {
+	if req.Token == "" {
+		return ErrInvalidResetToken
+	}
+	if req.Password == "" {
+		return errors.New("password is required")
+	}
+
+	hash := security.HashToken(req.Token)
+
+	// Check the policy before consuming so a rejected password does not
+	// burn the link.
+	pending, err := p.resets.Find(session, hash)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	user, err := p.repo.FindOne(session, bson.M{
+		"_id":        p.repo.ConvertStringToObjectID(pending.UserID),
+		"deleteDate": nil,
+	})
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	if err := security.ValidatePassword(req.Password, user.Email, user.Username); err != nil {
+		return err
+	}
+
+	reset, err := p.resets.Consume(session, hash)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+
+	passwordHash, err := security.EncryptPassword(req.Password)
+	if err != nil {
+		return err
+	}
+
+	if err := p.repo.UpdatePassword(session, reset.UserID, passwordHash); err != nil {
+		return err
+	}
+
+	// Outstanding links and sessions were created with the old password.
+	if err := p.resets.DeleteByUser(session, reset.UserID); err != nil {
+		return err
+	}
+	if err := p.tokens.RevokeUserTokens(session, reset.UserID); err != nil {
+		return err
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":   session,
+		"func":   "Reset",
+		"file":   "service/password.go",
+		"tag":    "password",
+		"userId": reset.UserID,
+	}).Info("password reset")
+
+	return nil
+}
+
+// Change sets a new password for a signed-in user. Every token issued before
+// the change stops working, so a fresh pair carrying scopes is returned for
+// the caller's own session.
+func (p *passwordService) Change(session string, userId string, scopes []string, req model.ChangePasswordRequest) (*model.Token, error) {
+	user, err := p.repo.FindOne(session, bson.M{
+		"_id":        p.repo.ConvertStringToObjectID(userId),
+		"deleteDate": nil,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	// Wrong current passwords count towards the same lockout as failed
+	// logins, so a stolen token cannot be used to guess the password.
+	clientIP := req.Device.IPAddress
+	if p.lockout.Check(session, user.Email, clientIP) {
+		return nil, ErrInvalidCurrentPassword
+	}
+	if err := security.VerifyPassword(user.Password, req.CurrentPassword); err != nil {
+		p.lockout.Failure(session, user.Email, clientIP)
+		return nil, ErrInvalidCurrentPassword
+	}
+	p.lockout.Success(session, user.Email)
+
+	if req.NewPassword == req.CurrentPassword {
+		return nil, ErrPasswordUnchanged
+	}
+	if err := security.ValidatePassword(req.NewPassword, user.Email, user.Username); err != nil {
+		return nil, err
+	}
+
+	hash, err := security.EncryptPassword(req.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.repo.UpdatePassword(session, userId, hash); err != nil {
+		return nil, err
+	}
+	if err := p.resets.DeleteByUser(session, userId); err != nil {
+		return nil, err
+	}
+	if err := p.tokens.RevokeUserTokens(session, userId); err != nil {
+		return nil, err
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":   session,
+		"func":   "Change",
+		"file":   "service/password.go",
+		"tag":    "password",
+		"userId": userId,
+	}).Info("password changed")
+
+	return p.tokens.IssueTokens(session, *user, model.Grant{
+		Scopes:   scopes,
+		AuthTime: time.Now(),
+		Device:   req.Device,
+	})
+}
+
+// resetLink points at PASSWORD_RESET_URL, the frontend page that posts the
+// token to /auth/password/reset.
+func resetLink(token string) string {
+	base := os.Getenv("PASSWORD_RESET_URL")
+	if base == "" {
+		base = strings.TrimSuffix(os.Getenv("ISSUER"), "/") + "/reset-password"
+	}
+	return appendQuery(base, url.Values{"token": {token}})
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// readOnlyProfileFields have their own flows (verification, roles, password
+// change, admin tooling) and may not be patched.
+var readOnlyProfileFields = map[string]bool{
+	"email":    true,
+	"role":     true,
+	"password": true,
+	"status":   true,
+}
+
+const maxProfileImageURL = 2048
+
+// ProfileFieldError rejects one member of a profile patch.
+type ProfileFieldError struct {
+	Field    string
+	Reason   string
+	ReadOnly bool
+}
+
+func (e *ProfileFieldError) Error() string {
+	return e.Field + ": " + e.Reason
+}
+
+// UpdateProfile applies an RFC 7396 merge patch to the user's editable
+// fields: members set to a value change the field, members set to null
+// remove it, and absent members are left alone.
+func (u *userService) UpdateProfile(session string, userId string, patch map[string]any) (*model.User, error) {
+	current, err := u.GetProfile(session, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	update, err := u.parseProfilePatch(session, *current, patch)
+	if err != nil {
+		return nil, err
+	}
+	if update.Empty() {
+		return current, nil
+	}
+
+	user, err := u.repo.UpdateUser(session, userId, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrUsernameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.Href = fmt.Sprintf("/%s/%s", user.Type, user.ID.Hex())
+
+	logger.WithFields(logger.Fields{
+		"uuid":   session,
+		"func":   "UpdateProfile",
+		"file":   "service/profile.go",
+		"tag":    "profile",
+		"userId": userId,
+	}).Info("profile updated")
+
+	return user, nil
+}
+
+func (u *userService) parseProfilePatch(session string, current model.User, patch map[string]any) (model.ProfilePatch, error) {
+	var update model.ProfilePatch
+
+	for field, value := range patch {
+		if readOnlyProfileFields[field] {
+			return update, &ProfileFieldError{Field: field, Reason: "cannot be changed here", ReadOnly: true}
+		}
+
+		var target **string
+		switch field {
+		case "username":
+			target = &update.Username
+		case "gender":
+			target = &update.Gender
+		case "birthday":
+			target = &update.Birthday
+		case "profileImage":
+			target = &update.ProfileImage
+		default:
+			return update, &ProfileFieldError{Field: field, Reason: "is not an editable field"}
+		}
+
+		var s string
+		switch v := value.(type) {
+		case nil:
+		case string:
+			s = strings.TrimSpace(v)
+			if s == "" {
+				return update, &ProfileFieldError{Field: field, Reason: "must not be empty; use null to remove it"}
+			}
+		default:
+			return update, &ProfileFieldError{Field: field, Reason: "must be a string or null"}
+		}
+		*target = &s
+	}
+
+	if update.Username != nil && *update.Username != "" && !strings.EqualFold(*update.Username, current.Username) {
+		if !usernamePattern.MatchString(*update.Username) {
+			return update, &ProfileFieldError{Field: "username", Reason: ErrInvalidUsername.Error()}
+		}
+		if u.repo.CheckUsernameExist(session, *update.Username) {
+			return update, ErrUsernameTaken
+		}
+	}
+
+	if update.Gender != nil && *update.Gender != "" {
+		*update.Gender = strings.ToLower(*update.Gender)
+		if !slices.Contains(model.Genders, *update.Gender) {
+			return update, &ProfileFieldError{Field: "gender", Reason: "must be one of " + strings.Join(model.Genders, ", ")}
+		}
+	}
+
+	if update.Birthday != nil && *update.Birthday != "" {
+		if err := validateBirthday(*update.Birthday); err != nil {
+			return update, &ProfileFieldError{Field: "birthday", Reason: err.Error()}
+		}
+	}
+
+	if update.ProfileImage != nil && *update.ProfileImage != "" {
+		if err := validateImageURL(*update.ProfileImage); err != nil {
+			return update, &ProfileFieldError{Field: "profileImage", Reason: err.Error()}
+		}
+	}
+
+	return update, nil
+}
+
+func validateBirthday(value string) error {
+	birthday, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return errors.New("must be a date as YYYY-MM-DD")
+	}
+	if birthday.Year() < 1900 || birthday.After(time.Now()) {
+		return errors.New("must be between 1900-01-01 and today")
+	}
+	return nil
+}
+
+func validateImageURL(value string) error {
+	if len(value) > maxProfileImageURL {
+		return errors.New("must be at most 2048 characters")
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return errors.New("must be an absolute http(s) URL")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/sing3demons/users/imaging"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/repository"
+	"github.com/sing3demons/users/storage"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const defaultProfileImageMaxBytes = 5 << 20
+
+var (
+	ErrImageTooLarge    = errors.New("image is too large")
+	ErrUnsupportedImage = imaging.ErrUnsupported
+	ErrInvalidImage     = imaging.ErrInvalid
+	ErrImageDimensions  = imaging.ErrDimensions
+)
+
+// profileImageSizes are what an upload is stored as: the image itself, no
+// larger than 1024px, and the square thumbnails.
+var profileImageSizes = []imaging.Size{
+	{Name: "image", Max: 1024},
+	{Name: "256", Max: 256, Square: true},
+	{Name: "128", Max: 128, Square: true},
+	{Name: "64", Max: 64, Square: true},
+}
+
+type IProfileImageService interface {
+	Upload(session string, userId string, data []byte) (*model.ProfileImage, error)
+	// MaxBytes is the largest upload accepted.
+	MaxBytes() int64
+}
+
+type profileImageService struct {
+	repo     repository.IUserRepository
+	store    storage.BlobStore
+	maxBytes int64
+}
+
+func NewProfileImageService(repo repository.IUserRepository, store storage.BlobStore) IProfileImageService {
+	return &profileImageService{repo: repo, store: store, maxBytes: ProfileImageMaxBytes()}
+}
+
+// ProfileImageMaxBytes is the upload limit, from PROFILE_IMAGE_MAX_BYTES or
+// 5 MiB.
+func ProfileImageMaxBytes() int64 {
+	if n, err := strconv.ParseInt(os.Getenv("PROFILE_IMAGE_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return defaultProfileImageMaxBytes
+}
+
+func (p *profileImageService) MaxBytes() int64 {
+	return p.maxBytes
+}
+
+// Upload validates and re-encodes the image, stores every rendition under a
+// new prefix and points the user at them. The previous upload's blobs are
+// deleted afterwards; failing that is only logged.
+func (p *profileImageService) Upload(session string, userId string, data []byte) (*model.ProfileImage, error) {
+	if int64(len(data)) > p.maxBytes {
+		return nil, ErrImageTooLarge
+	}
+
+	variants, err := imaging.Process(data, profileImageSizes)
+	if err != nil {
+		return nil, err
+	}
+
+	// A fresh prefix per upload keeps URLs immutable, so they can be cached
+	// forever.
+	prefix := "users/" + userId + "/" + uuid.NewString() + "/"
+	image := model.ProfileImage{Thumbnails: map[string]string{}}
+	keys := make([]string, 0, len(variants))
+	for _, variant := range variants {
+		key := prefix + variant.Name + "." + variant.Ext
+		url, err := p.store.Put(session, key, variant.ContentType, variant.Data)
+		if err != nil {
+			p.deleteBlobs(session, keys)
+			return nil, err
+		}
+		keys = append(keys, key)
+
+		if variant.Name == "image" {
+			image.URL = url
+		} else {
+			image.Thumbnails[variant.Name] = url
+		}
+	}
+
+	previous, err := p.repo.SetProfileImage(session, userId, image, keys)
+	if err != nil {
+		p.deleteBlobs(session, keys)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	p.deleteBlobs(session, previous)
+
+	logger.WithFields(logger.Fields{
+		"uuid":   session,
+		"func":   "Upload",
+		"file":   "service/profile_image.go",
+		"tag":    "profile",
+		"userId": userId,
+		"bytes":  len(data),
+	}).Info("profile image uploaded")
+
+	return &image, nil
+}
+
+func (p *profileImageService) deleteBlobs(session string, keys []string) {
+	for _, key := range keys {
+		if err := p.store.Delete(session, key); err != nil {
+			logger.WithFields(logger.Fields{
+				"uuid":  session,
+				"error": err.Error(),
+				"func":  "Delete",
+				"file":  "service/profile_image.go",
+				"tag":   "profile",
+				"key":   key,
+			}).Error("error")
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/repository"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// roleCacheTTL bounds how long a changed custom role may take to apply on
+// other instances; changes made through this instance apply immediately.
+const roleCacheTTL = 30 * time.Second
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+	ErrRoleBuiltIn  = errors.New("built-in roles cannot be changed")
+	ErrRoleInUse    = errors.New("role is still assigned to users")
+	ErrLastAdmin    = errors.New("cannot remove the last admin")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+var (
+	roleNamePattern   = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+	permissionPattern = regexp.MustCompile(`^(\*|[a-z_]+:[a-z_*]+)$`)
+)
+
+var builtInRoles = map[string]model.Role{
+	model.RoleUser: {
+		Name:        model.RoleUser,
+		Description: "Default role for every account",
+		Permissions: []string{},
+		BuiltIn:     true,
+	},
+	model.RoleAdmin: {
+		Name:        model.RoleAdmin,
+		Description: "Full administrative access",
+		Permissions: []string{model.PermissionAll},
+		BuiltIn:     true,
+	},
+}
+
+type IRoleService interface {
+	// Permissions returns the union of the permissions of roles. Unknown
+	// roles contribute nothing.
+	Permissions(session string, roles []string) ([]string, error)
+	List(session string) ([]model.Role, error)
+	Save(session string, role model.Role) error
+	Delete(session string, name string) error
+	Assign(session string, actorId string, userId string, role string) error
+}
+
+type roleService struct {
+	users repository.IUserRepository
+	roles repository.IRoleRepository
+
+	mu    sync.Mutex
+	cache map[string]cachedRole
+}
+
+type cachedRole struct {
+	role      *model.Role
+	expiresAt time.Time
+}
+
+func NewRoleService(users repository.IUserRepository, roles repository.IRoleRepository) IRoleService {
+	return &roleService{users: users, roles: roles, cache: map[string]cachedRole{}}
+}
+
+func (r *roleService) Permissions(session string, roles []string) ([]string, error) {
+	seen := map[string]bool{}
+	permissions := []string{}
+
+	for _, name := range roles {
+		role, err := r.find(session, name)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			continue
+		}
+
+		for _, p := range role.Permissions {
+			if !seen[p] {
+				seen[p] = true
+				permissions = append(permissions, p)
+			}
+		}
+	}
+
+	return permissions, nil
+}
+
+func (r *roleService) List(session string) ([]model.Role, error) {
+	custom, err := r.roles.FindAll(session)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]model.Role, 0, len(builtInRoles)+len(custom))
+	for _, role := range builtInRoles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+
+	return append(roles, custom...), nil
+}
+
+func (r *roleService) Save(session string, role model.Role) error {
+	if _, ok := builtInRoles[role.Name]; ok {
+		return ErrRoleBuiltIn
+	}
+	if !roleNamePattern.MatchString(role.Name) {
+		return errors.New("role name must be 2-32 lowercase letters, digits, '_' or '-'")
+	}
+	for _, p := range role.Permissions {
+		if !permissionPattern.MatchString(p) {
+			return errors.New("invalid permission: " + p)
+		}
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+
+	if err := r.roles.Upsert(session, role); err != nil {
+		return err
+	}
+
+	r.forget(role.Name)
+	return nil
+}
+
+func (r *roleService) Delete(session string, name string) error {
+	if _, ok := builtInRoles[name]; ok {
+		return ErrRoleBuiltIn
+	}
+
+	count, err := r.users.CountByRole(session, name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+
+	deleted, err := r.roles.Delete(session, name)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrRoleNotFound
+	}
+
+	r.forget(name)
+	return nil
+}
+
+// Assign changes userId's role. The new role shows up in the user's tokens
+// from their next login or refresh.
+func (r *roleService) Assign(session string, actorId string, userId string, role string) error {
+	found, err := r.find(session, role)
+	if err != nil {
+		return err
+	}
+	if found == nil {
+		return ErrRoleNotFound
+	}
+
+	user, err := r.users.FindOne(session, bson.M{
+		"_id":        r.users.ConvertStringToObjectID(userId),
+		"deleteDate": nil,
+	})
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	// DemoteAdmin re-checks for a remaining admin after the change and
+	// undoes it if there is none, so concurrent demotions cannot leave zero.
+	if user.RoleName() == model.RoleAdmin && role != model.RoleAdmin {
+		demoted, err := r.users.DemoteAdmin(session, userId, role)
+		if err != nil {
+			return err
+		}
+		if !demoted {
+			return ErrLastAdmin
+		}
+	} else if _, err := r.users.SetRole(session, userId, role); err != nil {
+		return err
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":     session,
+		"func":     "Assign",
+		"file":     "service/role.go",
+		"tag":      "role",
+		"actorId":  actorId,
+		"userId":   userId,
+		"role":     role,
+		"previous": user.RoleName(),
+	}).Info("role assigned")
+
+	return nil
+}
+
+// find returns nil, nil for a role that does not exist.
+func (r *roleService) find(session string, name string) (*model.Role, error) {
+	if role, ok := builtInRoles[name]; ok {
+		return &role, nil
+	}
+
+	r.mu.Lock()
+	cached, ok := r.cache[name]
+	r.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.role, nil
+	}
+
+	role, err := r.roles.FindByName(session, name)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		role, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cache[name] = cachedRole{role: role, expiresAt: time.Now().Add(roleCacheTTL)}
+	r.mu.Unlock()
+
+	return role, nil
+}
+
+func (r *roleService) forget(name string) {
+	r.mu.Lock()
+	delete(r.cache, name)
+	r.mu.Unlock()
+}
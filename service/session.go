@@ -0,0 +1,99 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/repository"
+	logger "github.com/sirupsen/logrus"
+)
+
+const sessionTouchEvery = time.Minute
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionRevoked  = errors.New("session revoked")
+)
+
+type ISessionService interface {
+	// List returns the user's active sessions, flagging currentSid.
+	List(session string, userId string, currentSid string) ([]model.Session, error)
+	Revoke(session string, userId string, sid string) error
+	// Validate reports ErrSessionRevoked unless sid is a live session, and
+	// records it as seen.
+	Validate(session string, sid string) error
+}
+
+type sessionService struct {
+	sessions      repository.ISessionRepository
+	refreshTokens repository.IRefreshTokenRepository
+}
+
+func NewSessionService(sessions repository.ISessionRepository, refreshTokens repository.IRefreshTokenRepository) ISessionService {
+	return &sessionService{sessions: sessions, refreshTokens: refreshTokens}
+}
+
+func (s *sessionService) List(session string, userId string, currentSid string) ([]model.Session, error) {
+	sessions, err := s.sessions.ListActive(session, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSid
+	}
+
+	return sessions, nil
+}
+
+// Revoke ends the session and its refresh tokens. Its access tokens are
+// rejected from the next request on.
+func (s *sessionService) Revoke(session string, userId string, sid string) error {
+	revoked, err := s.sessions.Revoke(session, userId, sid)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrSessionNotFound
+	}
+
+	if _, err := s.refreshTokens.RevokeFamily(session, sid); err != nil {
+		return err
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":   session,
+		"func":   "Revoke",
+		"file":   "service/session.go",
+		"tag":    "session",
+		"userId": userId,
+		"sid":    sid,
+	}).Info("session revoked")
+
+	return nil
+}
+
+func (s *sessionService) Validate(session string, sid string) error {
+	found, err := s.sessions.FindByID(session, sid)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+
+	now := time.Now()
+	if found.RevokedAt != nil || !found.ExpiresAt.After(now) {
+		return ErrSessionRevoked
+	}
+
+	if err := s.sessions.Touch(session, sid, now, sessionTouchEvery); err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "Touch",
+			"file":  "service/session.go",
+			"tag":   "session",
+		}).Error("error")
+	}
+
+	return nil
+}
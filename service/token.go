@@ -0,0 +1,286 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/repository"
+	"github.com/sing3demons/users/security"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+type ITokenService interface {
+	IssueTokens(session string, user model.User, grant model.Grant) (*model.Token, error)
+	IssueClientToken(session string, client model.OAuthClient, scopes []string) (*model.Token, error)
+	Refresh(session string, refreshToken string, clientId string) (*model.Token, error)
+	Logout(session string, userId string, sid string, jti string, expiresAt time.Time, refreshToken string) error
+	RevokeUserTokens(session string, userId string) error
+}
+
+type tokenService struct {
+	users         repository.IUserRepository
+	refreshTokens repository.IRefreshTokenRepository
+	revocations   repository.IRevocationRepository
+	sessions      repository.ISessionRepository
+}
+
+func NewTokenService(users repository.IUserRepository, refreshTokens repository.IRefreshTokenRepository, revocations repository.IRevocationRepository, sessions repository.ISessionRepository) ITokenService {
+	return &tokenService{users: users, refreshTokens: refreshTokens, revocations: revocations, sessions: sessions}
+}
+
+// IssueTokens starts a new session, and with it a new refresh token family,
+// for the user.
+func (t *tokenService) IssueTokens(session string, user model.User, grant model.Grant) (*model.Token, error) {
+	sid := uuid.NewString()
+
+	now := time.Now()
+	if err := t.sessions.Create(session, model.Session{
+		ID:         sid,
+		UserID:     user.ID.Hex(),
+		ClientID:   grant.ClientID,
+		Device:     grant.Device,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(security.RefreshTokenExpiration),
+	}); err != nil {
+		return nil, err
+	}
+
+	return t.issue(session, user, grant, sid)
+}
+
+// IssueClientToken issues an access token without a refresh token; clients
+// using client_credentials simply request a new one.
+func (t *tokenService) IssueClientToken(session string, client model.OAuthClient, scopes []string) (*model.Token, error) {
+	accessToken, err := security.GenerateClientToken(client, security.WithScopes(scopes...))
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":     session,
+			"error":    err.Error(),
+			"func":     "GenerateClientToken",
+			"file":     "service/token.go",
+			"tag":      "IssueClientToken",
+			"clientId": client.ClientID,
+		}).Error("error")
+
+		return nil, err
+	}
+
+	return &model.Token{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(security.AccessTokenExpiration.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// Refresh rotates refreshToken. Presenting a token that was already rotated
+// is treated as theft and revokes every token in its family.
+func (t *tokenService) Refresh(session string, refreshToken string, clientId string) (*model.Token, error) {
+	current, err := t.refreshTokens.FindByHash(session, security.HashToken(refreshToken))
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// A token can only be redeemed by the client it was issued to; tokens
+	// from /auth/login belong to no client.
+	if current.ClientID != clientId {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if current.RotatedAt != nil {
+		t.revokeFamily(session, current.FamilyID)
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if err := t.extendSession(session, current); err != nil {
+		return nil, err
+	}
+
+	user, err := t.users.FindOne(session, bson.M{
+		"_id":        t.users.ConvertStringToObjectID(current.UserID),
+		"deleteDate": nil,
+	}, &options.FindOneOptions{Projection: bson.M{"password": 0}})
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	next, err := security.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	rotated, err := t.refreshTokens.MarkRotated(session, current.ID, security.HashToken(next))
+	if err != nil {
+		return nil, err
+	}
+
+	// Another request rotated the same token first.
+	if !rotated {
+		t.revokeFamily(session, current.FamilyID)
+		return nil, ErrInvalidRefreshToken
+	}
+
+	grant := model.Grant{
+		Scopes:   current.Scopes,
+		ClientID: current.ClientID,
+		AuthTime: current.AuthTime,
+	}
+	return t.store(session, *user, grant, current.FamilyID, next)
+}
+
+// Logout revokes the access token identified by jti, its session sid and,
+// when given, the refresh token family it was issued with.
+func (t *tokenService) Logout(session string, userId string, sid string, jti string, expiresAt time.Time, refreshToken string) error {
+	if err := t.revocations.Revoke(session, jti, expiresAt); err != nil {
+		return err
+	}
+
+	if sid != "" {
+		if _, err := t.sessions.Revoke(session, userId, sid); err != nil {
+			return err
+		}
+		if _, err := t.refreshTokens.RevokeFamily(session, sid); err != nil {
+			return err
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	current, err := t.refreshTokens.FindByHash(session, security.HashToken(refreshToken))
+	if err != nil || current.UserID != userId {
+		return nil
+	}
+
+	_, err = t.refreshTokens.RevokeFamily(session, current.FamilyID)
+	return err
+}
+
+// RevokeUserTokens revokes every session and refresh token of the user,
+// e.g. after the password was reset.
+func (t *tokenService) RevokeUserTokens(session string, userId string) error {
+	if _, err := t.sessions.RevokeByUser(session, userId); err != nil {
+		return err
+	}
+	_, err := t.refreshTokens.RevokeByUser(session, userId)
+	return err
+}
+
+// extendSession keeps the refresh token's session alive. Families started
+// before sessions were tracked get a session on their first refresh.
+func (t *tokenService) extendSession(session string, token *model.RefreshToken) error {
+	now := time.Now()
+	expiresAt := now.Add(security.RefreshTokenExpiration)
+
+	extended, err := t.sessions.Extend(session, token.FamilyID, now, expiresAt)
+	if err != nil || extended {
+		return err
+	}
+
+	if _, err := t.sessions.FindByID(session, token.FamilyID); err == nil {
+		// The session was revoked.
+		return ErrInvalidRefreshToken
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	return t.sessions.Create(session, model.Session{
+		ID:         token.FamilyID,
+		UserID:     token.UserID,
+		ClientID:   token.ClientID,
+		CreatedAt:  token.CreatedAt,
+		LastSeenAt: now,
+		ExpiresAt:  expiresAt,
+	})
+}
+
+func (t *tokenService) issue(session string, user model.User, grant model.Grant, familyId string) (*model.Token, error) {
+	refreshToken, err := security.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return t.store(session, user, grant, familyId, refreshToken)
+}
+
+func (t *tokenService) store(session string, user model.User, grant model.Grant, familyId, refreshToken string) (*model.Token, error) {
+	opts := []security.TokenOption{security.WithScopes(grant.Scopes...), security.WithSessionID(familyId)}
+	if grant.ClientID != "" {
+		opts = append(opts, security.WithClientID(grant.ClientID))
+	}
+
+	accessToken, err := security.GenerateToken(user, opts...)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":   session,
+			"error":  err.Error(),
+			"func":   "GenerateToken",
+			"file":   "service/token.go",
+			"tag":    "IssueTokens",
+			"result": nil,
+		}).Error("error")
+
+		return nil, err
+	}
+
+	var idToken string
+	if security.HasScope(grant.Scopes, security.ScopeOpenID) {
+		idToken, err = security.GenerateIDToken(user, grant)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	if _, err := t.refreshTokens.Create(session, model.RefreshToken{
+		TokenHash: security.HashToken(refreshToken),
+		UserID:    user.ID.Hex(),
+		FamilyID:  familyId,
+		ClientID:  grant.ClientID,
+		Scopes:    grant.Scopes,
+		AuthTime:  grant.AuthTime,
+		CreatedAt: now,
+		ExpiresAt: now.Add(security.RefreshTokenExpiration),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &model.Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		IDToken:      idToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(security.AccessTokenExpiration.Seconds()),
+		Scope:        strings.Join(grant.Scopes, " "),
+	}, nil
+}
+
+func (t *tokenService) revokeFamily(session string, familyId string) {
+	count, err := t.refreshTokens.RevokeFamily(session, familyId)
+	if err != nil {
+		return
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":     session,
+		"func":     "Refresh",
+		"file":     "service/token.go",
+		"tag":      "security",
+		"familyId": familyId,
+		"revoked":  count,
+	}).Warn("refresh token reuse detected")
+}
@@ -1,32 +1,62 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/google/uuid"
 	"github.com/sing3demons/users/model"
 	"github.com/sing3demons/users/repository"
 	"github.com/sing3demons/users/security"
-	"github.com/sing3demons/users/utils"
 	logger "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type IUserService interface {
 	Register(session string, user model.Register) (any, error)
-	Login(session string, req model.Login) (token any, err error)
+	Login(session string, req model.Login) (*model.Token, error)
+	Authenticate(session string, req model.Login) (*model.User, error)
 	GetProfile(session string, userId string) (*model.User, error)
+	List(session string, query model.UserListQuery) (*model.UserPage, error)
+	Search(session string, search model.UserSearch) ([]model.UserSearchResult, error)
+	UpdateProfile(session string, userId string, patch map[string]any) (*model.User, error)
 }
 
 type userService struct {
-	repo repository.IUserRepository
+	repo         repository.IUserRepository
+	tokens       ITokenService
+	verification IVerificationService
+	lockout      ILockoutService
 }
 
-func NewUserService(repo repository.IUserRepository) IUserService {
-	return &userService{repo: repo}
+func NewUserService(repo repository.IUserRepository, tokens ITokenService, verification IVerificationService, lockout ILockoutService) IUserService {
+	return &userService{repo: repo, tokens: tokens, verification: verification, lockout: lockout}
 }
 
+var (
+	ErrInvalidUsername = errors.New("username must be 3-32 letters, digits, '.', '_' or '-'")
+	ErrUsernameTaken   = errors.New("username already taken")
+)
+
+// usernamePattern excludes "@" so a login identifier is never ambiguous
+// between an email and a username.
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,32}$`)
+
+// dummyPasswordHash is compared against when there is no real hash to check,
+// so unknown and locked accounts take as long to reject as a wrong password.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := security.EncryptPassword("dummy password for timing")
+	return hash
+})
+
 func (u *userService) GetProfile(session string, userId string) (*model.User, error) {
 	user, err := u.repo.FindOne(session, bson.M{"_id": u.repo.ConvertStringToObjectID(userId)}, &options.FindOneOptions{Projection: bson.M{"password": 0}})
 	if err != nil {
@@ -50,13 +80,29 @@ func (u *userService) GetProfile(session string, userId string) (*model.User, er
 		"func":   "FindOne",
 		"file":   "service/user.go",
 		"tag":    "GetProfile",
-		"result": utils.MaskSensitiveData(user),
+		"userId": user.ID.Hex(),
 	}).Debug("find user success")
 
 	return user, nil
 }
 
 func (u *userService) Register(session string, user model.Register) (any, error) {
+	user.Email = strings.TrimSpace(user.Email)
+	user.Username = strings.TrimSpace(user.Username)
+
+	if !strings.Contains(user.Email, "@") {
+		return model.User{}, fmt.Errorf("invalid email")
+	}
+
+	if user.Username != "" {
+		if !usernamePattern.MatchString(user.Username) {
+			return model.User{}, ErrInvalidUsername
+		}
+		if u.repo.CheckUsernameExist(session, user.Username) {
+			return model.User{}, ErrUsernameTaken
+		}
+	}
+
 	exist := u.repo.CheckUserExist(session, user.Email)
 	if exist {
 		logger.WithFields(logger.Fields{
@@ -71,6 +117,19 @@ func (u *userService) Register(session string, user model.Register) (any, error)
 		return model.User{}, fmt.Errorf("user already exist")
 	}
 
+	if err := security.ValidatePassword(user.Password, user.Email, user.Username); err != nil {
+		return model.User{}, err
+	}
+
+	languageCode := DefaultLanguage()
+	if user.LanguageCode != "" {
+		code, err := NormalizeLanguage(user.LanguageCode)
+		if err != nil {
+			return model.User{}, err
+		}
+		languageCode = code
+	}
+
 	hash, err := security.EncryptPassword(user.Password)
 	if err != nil {
 		logger.WithFields(logger.Fields{
@@ -85,14 +144,39 @@ func (u *userService) Register(session string, user model.Register) (any, error)
 		return model.User{}, err
 	}
 
-	result, err := u.repo.CreateUser(session, model.User{
+	newUser := model.User{
+		ID:        primitive.NewObjectID(),
 		Username:  user.Username,
 		Email:     user.Email,
 		Password:  hash,
 		Type:      "users",
+		Status:    model.UserStatusPending,
+		Role:      model.RoleUser,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
-	})
+	}
+
+	profile := model.Profile{
+		ID:           uuid.NewString(),
+		LanguageCode: languageCode,
+		FirstName:    strings.TrimSpace(user.FistName),
+		LastName:     strings.TrimSpace(user.LastName),
+		NickName:     strings.TrimSpace(user.NickName),
+	}
+	for _, name := range []string{profile.FirstName, profile.LastName, profile.NickName} {
+		if utf8.RuneCountInString(name) > maxProfileName {
+			return model.User{}, errors.New("names must be at most 100 characters")
+		}
+	}
+	if profile.FirstName != "" || profile.LastName != "" || profile.NickName != "" {
+		newUser.Profiles = []model.Profile{profile}
+		newUser.DefaultLanguage = languageCode
+	}
+
+	result, err := u.repo.CreateUser(session, newUser)
+	if mongo.IsDuplicateKeyError(err) {
+		return model.User{}, ErrUsernameTaken
+	}
 	if err != nil {
 		logger.WithFields(logger.Fields{
 			"uuid":    session,
@@ -116,31 +200,136 @@ func (u *userService) Register(session string, user model.Register) (any, error)
 		"result":  result,
 	}).Debug("insert success")
 
+	// The account exists either way; the user can ask for another link.
+	if err := u.verification.Send(session, newUser); err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":    session,
+			"error":   err.Error(),
+			"func":    "Send",
+			"file":    "service/user.go",
+			"tag":     "Register",
+			"headers": nil,
+			"result":  nil,
+		}).Error("error")
+	}
+
 	return result, nil
 }
 
-func (u *userService) Login(session string, req model.Login) (any, error) {
-	user, err := u.repo.FindOne(session, bson.M{"email": req.Email})
+func (u *userService) Login(session string, req model.Login) (*model.Token, error) {
+	scopes := security.ParseScope(req.Scope)
+	if len(scopes) == 0 {
+		scopes = security.UserScopes
+	}
+	if err := security.ValidateScopes(scopes, security.UserScopes); err != nil {
+		return nil, err
+	}
+
+	user, err := u.Authenticate(session, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.MFA != nil && user.MFA.Enabled {
+		challenge, err := security.GenerateMFAChallenge(*user, security.WithScopes(scopes...))
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, &MFARequiredError{
+			Challenge: challenge,
+			ExpiresIn: int64(security.MFAChallengeExpiration.Seconds()),
+		}
+	}
+
+	token, err := u.tokens.IssueTokens(session, *user, model.Grant{
+		Scopes:   scopes,
+		AuthTime: time.Now(),
+		Device:   req.Device,
+	})
 	if err != nil {
 		logger.WithFields(logger.Fields{
 			"uuid":   session,
 			"error":  err.Error(),
-			"func":   "FindOne",
+			"func":   "IssueTokens",
 			"file":   "service/user.go",
 			"tag":    "Login",
 			"result": nil,
 		}).Error("error")
 
-		return nil, fmt.Errorf("user not found")
+		return nil, err
 	}
 
 	logger.WithFields(logger.Fields{
 		"uuid":   session,
 		"error":  nil,
-		"func":   "FindOne",
+		"func":   "IssueTokens",
 		"file":   "service/user.go",
 		"tag":    "Login",
-		"result": utils.MaskSensitiveData(user),
+		"result": nil,
+	}).Debug("generate token success")
+
+	return token, nil
+}
+
+// Authenticate verifies the user's email or username and password without
+// issuing tokens. Unknown users, wrong passwords and locked accounts all
+// fail with ErrInvalidCredentials.
+func (u *userService) Authenticate(session string, req model.Login) (*model.User, error) {
+	identifier := strings.TrimSpace(req.Identifier)
+	if identifier == "" {
+		identifier = strings.TrimSpace(req.Email)
+	}
+	if identifier == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	user, err := u.repo.FindByIdentifier(session, identifier)
+
+	// Count failures against the account's email whichever identifier was
+	// used, so email and username do not get separate allowances.
+	lockKey := identifier
+	if err == nil {
+		lockKey = user.Email
+	}
+
+	if u.lockout.Check(session, lockKey, req.ClientIP) {
+		_ = security.VerifyPassword(dummyPasswordHash(), req.Password)
+
+		logger.WithFields(logger.Fields{
+			"uuid":     session,
+			"error":    "locked",
+			"func":     "Check",
+			"file":     "service/user.go",
+			"tag":      "Login",
+			"clientIp": req.ClientIP,
+		}).Warn("login rejected")
+
+		return nil, ErrInvalidCredentials
+	}
+
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":   session,
+			"error":  err.Error(),
+			"func":   "FindByIdentifier",
+			"file":   "service/user.go",
+			"tag":    "Login",
+			"result": nil,
+		}).Error("error")
+
+		_ = security.VerifyPassword(dummyPasswordHash(), req.Password)
+		u.lockout.Failure(session, lockKey, req.ClientIP)
+		return nil, ErrInvalidCredentials
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":   session,
+		"error":  nil,
+		"func":   "FindByIdentifier",
+		"file":   "service/user.go",
+		"tag":    "Login",
+		"userId": user.ID.Hex(),
 	}).Debug("find user success")
 
 	if err := security.VerifyPassword(user.Password, req.Password); err != nil {
@@ -153,31 +342,47 @@ func (u *userService) Login(session string, req model.Login) (any, error) {
 			"result": nil,
 		}).Error("error")
 
+		u.lockout.Failure(session, lockKey, req.ClientIP)
+		return nil, ErrInvalidCredentials
+	}
+
+	u.lockout.Success(session, lockKey)
+
+	if security.PasswordNeedsRehash(user.Password) {
+		u.rehashPassword(session, user, req.Password)
+	}
+
+	if err := checkAccountStatus(user); err != nil {
 		return nil, err
 	}
 
-	token, err := security.GenerateToken(*user)
+	return user, nil
+}
+
+// rehashPassword upgrades user's stored hash to the current algorithm and
+// parameters. Failure is logged only; the old hash still verifies.
+func (u *userService) rehashPassword(session string, user *model.User, password string) {
+	hash, err := security.EncryptPassword(password)
+	if err == nil {
+		_, err = u.repo.RehashPassword(session, user.ID.Hex(), user.Password, hash)
+	}
 	if err != nil {
 		logger.WithFields(logger.Fields{
 			"uuid":   session,
 			"error":  err.Error(),
-			"func":   "GenerateToken",
+			"func":   "RehashPassword",
 			"file":   "service/user.go",
 			"tag":    "Login",
 			"result": nil,
 		}).Error("error")
-
-		return nil, err
+		return
 	}
 
 	logger.WithFields(logger.Fields{
 		"uuid":   session,
-		"error":  nil,
-		"func":   "GenerateToken",
+		"func":   "RehashPassword",
 		"file":   "service/user.go",
 		"tag":    "Login",
-		"result": utils.MaskSensitiveData(token),
-	}).Debug("generate token success")
-
-	return token, nil
+		"userId": user.ID.Hex(),
+	}).Info("password hash upgraded")
 }
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sing3demons/users/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+	maxUserSearchSize   = 50
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// userSortFields are the fields GET /admin/users may sort on; "-" in front
+// sorts descending.
+var userSortFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"email":      true,
+	"username":   true,
+}
+
+// userCursor is the opaque next_cursor, bound to the sort it was made for.
+type userCursor struct {
+	Sort  string `json:"s"`
+	Value any    `json:"v"`
+	ID    string `json:"id"`
+}
+
+// List pages through users for admins. The next page is requested with the
+// returned cursor and the same filters and sort.
+func (u *userService) List(session string, query model.UserListQuery) (*model.UserPage, error) {
+	filter, err := parseUserFilter(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.Sort == "" {
+		query.Sort = "-created_at"
+	}
+	sort := model.UserSort{Field: strings.TrimPrefix(query.Sort, "-"), Desc: strings.HasPrefix(query.Sort, "-")}
+	if !userSortFields[sort.Field] {
+		return nil, errors.New("sort must be one of created_at, updated_at, email, username, optionally prefixed with -")
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultUserPageSize
+	}
+	if limit < 1 || limit > maxUserPageSize {
+		return nil, errors.New("limit must be between 1 and 100")
+	}
+
+	var after *model.UserCursor
+	if query.Cursor != "" {
+		after, err = decodeUserCursor(query.Cursor, query.Sort)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// One extra row tells whether there is a next page.
+	users, err := u.repo.FindPage(session, filter, sort, after, int64(limit)+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.UserPage{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		page.NextCursor = encodeUserCursor(query.Sort, page.Users[limit-1])
+	}
+
+	if query.IncludeTotal {
+		total, err := u.repo.Count(session, filter)
+		if err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+
+	return page, nil
+}
+
+func parseUserFilter(query model.UserListQuery) (model.UserFilter, error) {
+	filter := model.UserFilter{
+		Status:      query.Status,
+		Role:        query.Role,
+		EmailDomain: strings.ToLower(strings.TrimPrefix(strings.TrimSpace(query.EmailDomain), "@")),
+	}
+
+	var err error
+	if filter.CreatedFrom, err = parseDateBound(query.CreatedFrom, false); err != nil {
+		return filter, errors.New("created_from must be RFC 3339 or YYYY-MM-DD")
+	}
+	if filter.CreatedTo, err = parseDateBound(query.CreatedTo, true); err != nil {
+		return filter, errors.New("created_to must be RFC 3339 or YYYY-MM-DD")
+	}
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedFrom.Before(*filter.CreatedTo) {
+		return filter, errors.New("created_from must be before created_to")
+	}
+
+	return filter, nil
+}
+
+// parseDateBound accepts a timestamp or a UTC date. A date used as an upper
+// bound includes that whole day.
+func parseDateBound(value string, upper bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+func encodeUserCursor(sort string, last model.User) string {
+	cursor := userCursor{Sort: sort, ID: last.ID.Hex()}
+
+	switch strings.TrimPrefix(sort, "-") {
+	case "created_at":
+		if !last.CreatedAt.IsZero() {
+			cursor.Value = last.CreatedAt.Format(time.RFC3339Nano)
+		}
+	case "updated_at":
+		if !last.UpdatedAt.IsZero() {
+			cursor.Value = last.UpdatedAt.Format(time.RFC3339Nano)
+		}
+	case "email":
+		if last.Email != "" {
+			cursor.Value = last.Email
+		}
+	case "username":
+		if last.Username != "" {
+			cursor.Value = last.Username
+		}
+	}
+
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeUserCursor(value string, sort string) (*model.UserCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor userCursor
+	if err := json.Unmarshal(b, &cursor); err != nil || cursor.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+
+	id, err := primitive.ObjectIDFromHex(cursor.ID)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	after := &model.UserCursor{ID: id}
+	switch v := cursor.Value.(type) {
+	case nil:
+	case string:
+		after.Value = v
+		if field := strings.TrimPrefix(sort, "-"); field == "created_at" || field == "updated_at" {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, ErrInvalidCursor
+			}
+			after.Value = t
+		}
+	default:
+		return nil, ErrInvalidCursor
+	}
+
+	return after, nil
+}
+
+// Search finds users by whole words of their username, email or profile
+// names, or by a prefix of their username or email.
+func (u *userService) Search(session string, search model.UserSearch) ([]model.UserSearchResult, error) {
+	search.Text = strings.TrimSpace(search.Text)
+	if n := utf8.RuneCountInString(search.Text); n < 2 || n > 100 {
+		return nil, errors.New("q must be 2-100 characters")
+	}
+
+	if search.Limit == 0 {
+		search.Limit = defaultUserPageSize
+	}
+	if search.Limit < 1 || search.Limit > maxUserSearchSize {
+		return nil, errors.New("limit must be between 1 and 50")
+	}
+
+	return u.repo.Search(session, search)
+}
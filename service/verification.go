@@ -0,0 +1,175 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sing3demons/users/mailer"
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/repository"
+	"github.com/sing3demons/users/security"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// verificationResendCooldown is the minimum gap between two verification
+// emails to the same account.
+const verificationResendCooldown = 2 * time.Minute
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification link")
+	ErrEmailNotVerified         = errors.New("email address has not been verified")
+)
+
+type IVerificationService interface {
+	Send(session string, user model.User) error
+	Verify(session string, token string) error
+	Resend(session string, req model.ResendVerificationRequest)
+}
+
+type verificationService struct {
+	repo   repository.IUserRepository
+	mailer mailer.Mailer
+}
+
+func NewVerificationService(repo repository.IUserRepository, mailer mailer.Mailer) IVerificationService {
+	return &verificationService{repo: repo, mailer: mailer}
+}
+
+// Send emails a signed verification link to a pending user.
+func (v *verificationService) Send(session string, user model.User) error {
+	sent, err := v.repo.MarkVerificationSent(session, user.ID.Hex(), verificationResendCooldown)
+	if err != nil {
+		return err
+	}
+	if !sent {
+		logger.WithFields(logger.Fields{
+			"uuid":   session,
+			"func":   "Send",
+			"file":   "service/verification.go",
+			"tag":    "verification",
+			"userId": user.ID.Hex(),
+		}).Info("verification email throttled")
+		return nil
+	}
+
+	token, err := security.GenerateEmailVerificationToken(user)
+	if err != nil {
+		return err
+	}
+
+	link := verificationLink(token)
+	if err := v.mailer.Send(session, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Welcome! Please confirm your email address.\n\n"+
+			"Open this link within %d hours to activate your account:\n%s\n\n"+
+			"If you did not create an account you can ignore this email.\n",
+			int(security.EmailVerificationExpiration.Hours()), link),
+	}); err != nil {
+		return err
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":   session,
+		"func":   "Send",
+		"file":   "service/verification.go",
+		"tag":    "verification",
+		"userId": user.ID.Hex(),
+	}).Info("verification email sent")
+
+	return nil
+}
+
+func (v *verificationService) Verify(session string, token string) error {
+	if token == "" {
+		return ErrInvalidVerificationToken
+	}
+
+	claims, err := security.ValidateEmailVerificationToken(token)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	userId, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	if userId == "" || email == "" {
+		return ErrInvalidVerificationToken
+	}
+
+	activated, err := v.repo.ActivateEmail(session, userId, email)
+	if err != nil {
+		return err
+	}
+	if !activated {
+		// Clicking the link twice is not an error.
+		user, err := v.repo.FindOne(session, bson.M{
+			"_id":        v.repo.ConvertStringToObjectID(userId),
+			"email":      email,
+			"deleteDate": nil,
+		})
+		if err != nil || user.Status == model.UserStatusPending {
+			return ErrInvalidVerificationToken
+		}
+		return nil
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":   session,
+		"func":   "Verify",
+		"file":   "service/verification.go",
+		"tag":    "verification",
+		"userId": userId,
+	}).Info("email verified")
+
+	return nil
+}
+
+// Resend issues a fresh link for a pending account. Like Forgot it reports
+// nothing, so it cannot be used to probe which addresses are registered.
+func (v *verificationService) Resend(session string, req model.ResendVerificationRequest) {
+	go func(email string) {
+		user, err := v.repo.FindOneByEmail(session, email)
+		if err != nil || user.Status != model.UserStatusPending {
+			return
+		}
+
+		if err := v.Send(session, *user); err != nil {
+			logger.WithFields(logger.Fields{
+				"uuid":  session,
+				"error": err.Error(),
+				"func":  "Resend",
+				"file":  "service/verification.go",
+				"tag":   "verification",
+			}).Error("error")
+		}
+	}(strings.TrimSpace(req.Email))
+}
+
+// requireEmailVerification reports whether REQUIRE_EMAIL_VERIFICATION is set,
+// in which case pending accounts cannot log in.
+func requireEmailVerification() bool {
+	return os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
+}
+
+// checkAccountStatus applies the login policy to an authenticated user.
+func checkAccountStatus(user *model.User) error {
+	if user.Status == model.UserStatusPending && requireEmailVerification() {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// verificationLink points at EMAIL_VERIFICATION_URL, or this service's own
+// GET /auth/verify-email when no frontend page is configured.
+func verificationLink(token string) string {
+	base := os.Getenv("EMAIL_VERIFICATION_URL")
+	if base == "" {
+		base = strings.TrimSuffix(os.Getenv("ISSUER"), "/") + "/auth/verify-email"
+	}
+	return appendQuery(base, url.Values{"token": {token}})
+}
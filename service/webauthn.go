@@ -0,0 +1,419 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sing3demons/users/model"
+	"github.com/sing3demons/users/repository"
+	"github.com/sing3demons/users/security"
+	logger "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	webAuthnCeremonyRegistration   = "registration"
+	webAuthnCeremonyAuthentication = "authentication"
+	webAuthnTimeout                = 5 * time.Minute
+)
+
+var (
+	ErrWebAuthnFailed            = errors.New("passkey verification failed")
+	ErrWebAuthnCredentialExists  = errors.New("passkey already registered")
+	ErrWebAuthnCredentialUnknown = errors.New("passkey not found")
+)
+
+type IWebAuthnService interface {
+	BeginRegistration(session string, userId string) (*model.WebAuthnCreationOptions, error)
+	FinishRegistration(session string, userId string, credential model.WebAuthnCredentialResponse) (*model.WebAuthnCredential, error)
+	RemoveCredential(session string, userId string, credentialId string) error
+	BeginLogin(session string, req model.WebAuthnLoginRequest) (*model.WebAuthnRequestOptions, error)
+	FinishLogin(session string, credential model.WebAuthnCredentialResponse) (*model.Token, error)
+}
+
+type webAuthnService struct {
+	repo       repository.IUserRepository
+	challenges repository.IWebAuthnChallengeRepository
+	tokens     ITokenService
+}
+
+func NewWebAuthnService(repo repository.IUserRepository, challenges repository.IWebAuthnChallengeRepository, tokens ITokenService) IWebAuthnService {
+	return &webAuthnService{repo: repo, challenges: challenges, tokens: tokens}
+}
+
+func (w *webAuthnService) BeginRegistration(session string, userId string) (*model.WebAuthnCreationOptions, error) {
+	user, err := w.repo.FindOne(session, bson.M{
+		"_id":        w.repo.ConvertStringToObjectID(userId),
+		"deleteDate": nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := w.newChallenge(session, webAuthnCeremonyRegistration, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	name := user.Email
+	if name == "" {
+		name = user.Username
+	}
+	displayName := user.Username
+	if displayName == "" {
+		displayName = name
+	}
+
+	rpID, rpName := webAuthnRelyingParty()
+	return &model.WebAuthnCreationOptions{
+		Challenge: challenge,
+		RP:        model.WebAuthnRelyingParty{ID: rpID, Name: rpName},
+		User: model.WebAuthnUserEntity{
+			ID:          base64.RawURLEncoding.EncodeToString(user.ID[:]),
+			Name:        name,
+			DisplayName: displayName,
+		},
+		PubKeyCredParams: []model.WebAuthnCredentialParameter{
+			{Type: "public-key", Alg: security.COSEAlgES256},
+			{Type: "public-key", Alg: security.COSEAlgRS256},
+		},
+		Timeout:            webAuthnTimeout.Milliseconds(),
+		ExcludeCredentials: credentialDescriptors(user.WebAuthnCredentials),
+		AuthenticatorSelection: model.WebAuthnAuthenticatorSelection{
+			ResidentKey: "preferred",
+			// Passkeys replace the password and second factor at login, where
+			// verification is required; registering one that cannot do it
+			// would leave it unusable.
+			UserVerification: "required",
+		},
+		Attestation: "direct",
+	}, nil
+}
+
+func (w *webAuthnService) FinishRegistration(session string, userId string, credential model.WebAuthnCredentialResponse) (*model.WebAuthnCredential, error) {
+	clientDataJSON, err := decodeBase64URL(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrWebAuthnFailed
+	}
+	attestationObject, err := decodeBase64URL(credential.Response.AttestationObject)
+	if err != nil {
+		return nil, ErrWebAuthnFailed
+	}
+
+	if _, err := w.verifyClientData(session, clientDataJSON, "webauthn.create", webAuthnCeremonyRegistration, userId); err != nil {
+		return nil, err
+	}
+
+	att, err := security.ParseAttestationObject(attestationObject)
+	if err != nil {
+		return nil, w.fail(session, "FinishRegistration", err)
+	}
+
+	if err := checkAuthenticatorData(att.AuthData); err != nil {
+		return nil, w.fail(session, "FinishRegistration", err)
+	}
+
+	_, alg, err := security.ParseCOSEKey(att.AuthData.CredentialPublicKey)
+	if err != nil {
+		return nil, w.fail(session, "FinishRegistration", err)
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	attestationType, err := security.VerifyAttestation(att, clientDataHash[:])
+	if err != nil {
+		return nil, w.fail(session, "FinishRegistration", err)
+	}
+
+	credentialId := base64.RawURLEncoding.EncodeToString(att.AuthData.CredentialID)
+
+	stored := model.WebAuthnCredential{
+		ID:              credentialId,
+		Name:            credential.Name,
+		PublicKey:       att.AuthData.CredentialPublicKey,
+		Algorithm:       alg,
+		SignCount:       int64(att.AuthData.SignCount),
+		AAGUID:          hex.EncodeToString(att.AuthData.AAGUID),
+		AttestationType: attestationType,
+		Transports:      credential.Response.Transports,
+		CreatedAt:       time.Now(),
+	}
+
+	added, err := w.repo.AddWebAuthnCredential(session, userId, stored)
+	if err != nil {
+		return nil, err
+	}
+	if !added {
+		return nil, ErrWebAuthnCredentialExists
+	}
+
+	logger.WithFields(logger.Fields{
+		"uuid":            session,
+		"func":            "FinishRegistration",
+		"file":            "service/webauthn.go",
+		"tag":             "webauthn",
+		"userId":          userId,
+		"attestationType": attestationType,
+	}).Info("passkey registered")
+
+	return &stored, nil
+}
+
+func (w *webAuthnService) RemoveCredential(session string, userId string, credentialId string) error {
+	removed, err := w.repo.RemoveWebAuthnCredential(session, userId, credentialId)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrWebAuthnCredentialUnknown
+	}
+	return nil
+}
+
+// BeginLogin issues an assertion challenge. Without an email the browser
+// offers any discoverable passkey for this relying party.
+func (w *webAuthnService) BeginLogin(session string, req model.WebAuthnLoginRequest) (*model.WebAuthnRequestOptions, error) {
+	allow := []model.WebAuthnCredentialDescriptor{}
+	if req.Email != "" {
+		// Unknown emails get an empty list rather than an error so the
+		// response does not reveal which accounts exist.
+		if user, err := w.repo.FindOneByEmail(session, strings.TrimSpace(req.Email)); err == nil {
+			allow = credentialDescriptors(user.WebAuthnCredentials)
+		}
+	}
+
+	challenge, err := w.newChallenge(session, webAuthnCeremonyAuthentication, "")
+	if err != nil {
+		return nil, err
+	}
+
+	rpID, _ := webAuthnRelyingParty()
+	return &model.WebAuthnRequestOptions{
+		Challenge:        challenge,
+		RPID:             rpID,
+		Timeout:          webAuthnTimeout.Milliseconds(),
+		AllowCredentials: allow,
+		UserVerification: "required",
+	}, nil
+}
+
+func (w *webAuthnService) FinishLogin(session string, credential model.WebAuthnCredentialResponse) (*model.Token, error) {
+	clientDataJSON, err := decodeBase64URL(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrWebAuthnFailed
+	}
+	authData, err := decodeBase64URL(credential.Response.AuthenticatorData)
+	if err != nil {
+		return nil, ErrWebAuthnFailed
+	}
+	signature, err := decodeBase64URL(credential.Response.Signature)
+	if err != nil {
+		return nil, ErrWebAuthnFailed
+	}
+
+	credentialId := credential.RawID
+	if credentialId == "" {
+		credentialId = credential.ID
+	}
+	credentialId = strings.TrimRight(credentialId, "=")
+
+	user, err := w.repo.FindByWebAuthnCredential(session, credentialId)
+	if err != nil {
+		return nil, ErrWebAuthnFailed
+	}
+
+	var stored *model.WebAuthnCredential
+	for i := range user.WebAuthnCredentials {
+		if user.WebAuthnCredentials[i].ID == credentialId {
+			stored = &user.WebAuthnCredentials[i]
+			break
+		}
+	}
+	if stored == nil {
+		return nil, ErrWebAuthnFailed
+	}
+
+	if credential.Response.UserHandle != "" {
+		handle, err := decodeBase64URL(credential.Response.UserHandle)
+		if err != nil || !bytes.Equal(handle, user.ID[:]) {
+			return nil, w.fail(session, "FinishLogin", errors.New("user handle mismatch"))
+		}
+	}
+
+	if _, err := w.verifyClientData(session, clientDataJSON, "webauthn.get", webAuthnCeremonyAuthentication, ""); err != nil {
+		return nil, err
+	}
+
+	ad, err := security.ParseAuthenticatorData(authData)
+	if err != nil {
+		return nil, w.fail(session, "FinishLogin", err)
+	}
+	if err := checkAuthenticatorData(ad); err != nil {
+		return nil, w.fail(session, "FinishLogin", err)
+	}
+	// A passkey login skips the password and MFA, so possession of the
+	// authenticator is not enough: it must have verified the user (PIN,
+	// biometric).
+	if !ad.UserVerified() {
+		return nil, w.fail(session, "FinishLogin", errors.New("user not verified"))
+	}
+
+	if err := security.VerifyAssertion(stored.PublicKey, authData, clientDataJSON, signature); err != nil {
+		return nil, w.fail(session, "FinishLogin", err)
+	}
+
+	// Authenticators without counters always report zero. Otherwise the
+	// counter must grow; anything else suggests a cloned authenticator.
+	next := int64(ad.SignCount)
+	if (next != 0 || stored.SignCount != 0) && next <= stored.SignCount {
+		return nil, w.fail(session, "FinishLogin", errors.New("sign counter did not increase"))
+	}
+
+	updated, err := w.repo.UpdateWebAuthnSignCount(session, user.ID.Hex(), stored.ID, stored.SignCount, next)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, w.fail(session, "FinishLogin", errors.New("concurrent assertion"))
+	}
+
+	if err := checkAccountStatus(user); err != nil {
+		return nil, err
+	}
+
+	return w.tokens.IssueTokens(session, *user, model.Grant{
+		Scopes:   security.UserScopes,
+		AuthTime: time.Now(),
+		Device:   credential.Device,
+	})
+}
+
+func (w *webAuthnService) newChallenge(session string, ceremony string, userId string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := w.challenges.Create(session, model.WebAuthnChallenge{
+		ChallengeHash: security.HashToken(challenge),
+		Ceremony:      ceremony,
+		UserID:        userId,
+		ExpiresAt:     time.Now().Add(webAuthnTimeout),
+	}); err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+func (w *webAuthnService) verifyClientData(session string, raw []byte, typ string, ceremony string, userId string) (*security.ClientData, error) {
+	clientData, err := security.ParseClientData(raw)
+	if err != nil {
+		return nil, w.fail(session, "verifyClientData", err)
+	}
+
+	if clientData.Type != typ {
+		return nil, w.fail(session, "verifyClientData", errors.New("unexpected client data type"))
+	}
+
+	if !webAuthnOriginAllowed(clientData.Origin) {
+		return nil, w.fail(session, "verifyClientData", errors.New("origin not allowed: "+clientData.Origin))
+	}
+
+	challenge, err := w.challenges.Consume(session, security.HashToken(clientData.Challenge), ceremony)
+	if err != nil || time.Now().After(challenge.ExpiresAt) {
+		return nil, w.fail(session, "verifyClientData", errors.New("unknown or expired challenge"))
+	}
+
+	if challenge.UserID != userId {
+		return nil, w.fail(session, "verifyClientData", errors.New("challenge issued to another user"))
+	}
+
+	return clientData, nil
+}
+
+func (w *webAuthnService) fail(session string, fn string, err error) error {
+	logger.WithFields(logger.Fields{
+		"uuid":  session,
+		"error": err.Error(),
+		"func":  fn,
+		"file":  "service/webauthn.go",
+		"tag":   "webauthn",
+	}).Warn("webauthn verification failed")
+
+	return ErrWebAuthnFailed
+}
+
+func checkAuthenticatorData(ad *security.AuthenticatorData) error {
+	rpID, _ := webAuthnRelyingParty()
+	expected := sha256.Sum256([]byte(rpID))
+	if !bytes.Equal(ad.RPIDHash, expected[:]) {
+		return errors.New("rp id hash mismatch")
+	}
+	if !ad.UserPresent() {
+		return errors.New("user not present")
+	}
+	return nil
+}
+
+// webAuthnRelyingParty reads WEBAUTHN_RP_ID (default: the ISSUER host) and
+// WEBAUTHN_RP_NAME.
+func webAuthnRelyingParty() (string, string) {
+	id := os.Getenv("WEBAUTHN_RP_ID")
+	if id == "" {
+		if u, err := url.Parse(os.Getenv("ISSUER")); err == nil {
+			id = u.Hostname()
+		}
+	}
+
+	name := os.Getenv("WEBAUTHN_RP_NAME")
+	if name == "" {
+		name = id
+	}
+
+	return id, name
+}
+
+// webAuthnOriginAllowed checks origin against WEBAUTHN_ORIGINS, a comma
+// separated list defaulting to the ISSUER origin.
+func webAuthnOriginAllowed(origin string) bool {
+	allowed := os.Getenv("WEBAUTHN_ORIGINS")
+	if allowed == "" {
+		u, err := url.Parse(os.Getenv("ISSUER"))
+		if err != nil {
+			return false
+		}
+		allowed = u.Scheme + "://" + u.Host
+	}
+
+	for _, o := range strings.Split(allowed, ",") {
+		if strings.TrimSpace(o) == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func credentialDescriptors(credentials []model.WebAuthnCredential) []model.WebAuthnCredentialDescriptor {
+	descriptors := []model.WebAuthnCredentialDescriptor{}
+	for _, c := range credentials {
+		descriptors = append(descriptors, model.WebAuthnCredentialDescriptor{
+			Type:       "public-key",
+			ID:         c.ID,
+			Transports: c.Transports,
+		})
+	}
+	return descriptors
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/sing3demons/users/security"
+)
+
+func TestCheckAuthenticatorData(t *testing.T) {
+	t.Setenv("WEBAUTHN_RP_ID", "example.com")
+
+	authData := func(rpID string, flags byte) *security.AuthenticatorData {
+		hash := sha256.Sum256([]byte(rpID))
+		raw := append(hash[:], flags, 0, 0, 0, 1)
+		ad, err := security.ParseAuthenticatorData(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ad
+	}
+
+	tests := []struct {
+		name    string
+		ad      *security.AuthenticatorData
+		wantErr bool
+	}{
+		{"matching rp id", authData("example.com", 0x01), false},
+		{"rp id hash mismatch", authData("evil.example", 0x01), true},
+		{"parent domain", authData("com", 0x01), true},
+		{"user not present", authData("example.com", 0x04), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkAuthenticatorData(tt.ad); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+type localBlobStore struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalBlobStore keeps blobs as files under dir. baseURL is where they
+// are served from, either by this service (see Servable) or a web server.
+func NewLocalBlobStore(dir string, baseURL string) BlobStore {
+	return &localBlobStore{dir: dir, baseURL: baseURL}
+}
+
+func (l *localBlobStore) Put(session string, key string, contentType string, data []byte) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+
+	path := filepath.Join(l.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	// Write then rename so readers never see a partial file.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		// CreateTemp's 0600 would hide the file from a fronting web server.
+		err = tmp.Chmod(0o644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  "Put",
+			"file":  "storage/local.go",
+			"tag":   "storage",
+			"key":   key,
+		}).Error("write blob error")
+
+		return "", err
+	}
+
+	return joinURL(l.baseURL, key), nil
+}
+
+func (l *localBlobStore) Delete(session string, key string) error {
+	if !validKey(key) {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+
+	path := filepath.Join(l.dir, filepath.FromSlash(key))
+	err := os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Drop the directory once its last blob is gone; this fails harmlessly
+	// while it still has files.
+	os.Remove(filepath.Dir(path))
+	return nil
+}
+
+// ServeFrom is only meaningful when baseURL is a path or points at this
+// service.
+func (l *localBlobStore) ServeFrom() (string, string) {
+	path := l.baseURL
+	if u, err := url.Parse(l.baseURL); err == nil {
+		path = u.Path
+	}
+	return path, l.dir
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalBlobStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocalBlobStore(dir, "http://localhost:8080/media")
+
+	url, err := store.Put("test", "users/42/abc/64.png", "image/png", []byte("png"))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if want := "http://localhost:8080/media/users/42/abc/64.png"; url != want {
+		t.Errorf("Put URL = %q, want %q", url, want)
+	}
+
+	path := filepath.Join(dir, "users", "42", "abc", "64.png")
+	if b, err := os.ReadFile(path); err != nil || string(b) != "png" {
+		t.Fatalf("stored file = %q, %v", b, err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+
+	if err := store.Delete("test", "users/42/abc/64.png"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Errorf("empty upload directory was not removed: %v", err)
+	}
+	if err := store.Delete("test", "users/42/abc/64.png"); err != nil {
+		t.Errorf("Delete of a missing key: %v", err)
+	}
+
+	if _, err := store.Put("test", "../escape.png", "image/png", nil); err == nil {
+		t.Error("Put accepted a key outside the store")
+	}
+
+	path, served := store.(Servable).ServeFrom()
+	if path != "/media" || served != dir {
+		t.Errorf("ServeFrom = %q, %q", path, served)
+	}
+}
@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// S3Config points at an S3-compatible service. PathStyle addresses objects
+// as Endpoint/Bucket/key, which MinIO and most stand-ins need; otherwise the
+// bucket is a subdomain of Endpoint. PublicURL, e.g. a CDN, replaces the
+// object URL in returned links; the bucket or CDN must allow public reads.
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	PathStyle       bool
+	PublicURL       string
+}
+
+// S3ConfigFromEnv reads S3_ENDPOINT, S3_REGION (default us-east-1),
+// S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY, S3_PATH_STYLE and
+// S3_PUBLIC_URL.
+func S3ConfigFromEnv() S3Config {
+	region := os.Getenv("S3_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	return S3Config{
+		Endpoint:        os.Getenv("S3_ENDPOINT"),
+		Region:          region,
+		Bucket:          os.Getenv("S3_BUCKET"),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		PathStyle:       os.Getenv("S3_PATH_STYLE") == "true",
+		PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+	}
+}
+
+type s3BlobStore struct {
+	config S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3BlobStore talks to the S3 REST API directly, signing requests with
+// AWS Signature Version 4. A nil client uses a default with a timeout.
+func NewS3BlobStore(config S3Config, client *http.Client) BlobStore {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &s3BlobStore{config: config, client: client, now: time.Now}
+}
+
+func (s *s3BlobStore) Put(session string, key string, contentType string, data []byte) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	if err := s.do(session, "Put", key, req, data); err != nil {
+		return "", err
+	}
+
+	if s.config.PublicURL != "" {
+		return joinURL(s.config.PublicURL, key), nil
+	}
+	return s.objectURL(key), nil
+}
+
+// Delete succeeds for keys that do not exist, as S3 does.
+func (s *s3BlobStore) Delete(session string, key string) error {
+	if !validKey(key) {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+
+	return s.do(session, "Delete", key, req, nil)
+}
+
+func (s *s3BlobStore) do(session string, fn string, key string, req *http.Request, payload []byte) error {
+	signV4(req, payload, s.config.AccessKeyID, s.config.SecretAccessKey, s.config.Region, "s3", s.now())
+
+	resp, err := s.client.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			err = fmt.Errorf("storage: s3 %s %s: %s: %s", req.Method, key, resp.Status, bytes.TrimSpace(body))
+		}
+	}
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"uuid":  session,
+			"error": err.Error(),
+			"func":  fn,
+			"file":  "storage/s3.go",
+			"tag":   "storage",
+			"key":   key,
+		}).Error("s3 request error")
+	}
+
+	return err
+}
+
+func (s *s3BlobStore) objectURL(key string) string {
+	endpoint := strings.TrimSuffix(s.config.Endpoint, "/")
+	if s.config.PathStyle {
+		return joinURL(endpoint+"/"+url.PathEscape(s.config.Bucket), key)
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return joinURL(endpoint, key)
+	}
+	u.Host = s.config.Bucket + "." + u.Host
+	return joinURL(u.String(), key)
+}
+
+// signV4 adds the x-amz-date, x-amz-content-sha256 and Authorization
+// headers of AWS Signature Version 4, signing the host, the x-amz-* headers
+// and Content-Type.
+func signV4(req *http.Request, payload []byte, accessKey, secretKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), values[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything but RFC 3986 unreserved characters.
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
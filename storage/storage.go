@@ -0,0 +1,63 @@
+// Package storage keeps uploaded files such as profile images.
+package storage
+
+import (
+	"net/url"
+	"os"
+	"strings"
+)
+
+// BlobStore stores blobs under slash-separated keys and returns the public
+// URL each can be fetched from.
+type BlobStore interface {
+	Put(session string, key string, contentType string, data []byte) (string, error)
+	Delete(session string, key string) error
+}
+
+// Servable is implemented by stores whose blobs this service serves itself:
+// the files in dir at the URL path.
+type Servable interface {
+	ServeFrom() (path string, dir string)
+}
+
+// NewBlobStoreFromEnv selects the implementation named by BLOB_STORE: "s3"
+// (see S3ConfigFromEnv) or "local" (the default), which writes to
+// MEDIA_DIR and links to MEDIA_BASE_URL.
+func NewBlobStoreFromEnv() BlobStore {
+	switch os.Getenv("BLOB_STORE") {
+	case "s3":
+		return NewS3BlobStore(S3ConfigFromEnv(), nil)
+	default:
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			dir = "_media"
+		}
+		baseURL := os.Getenv("MEDIA_BASE_URL")
+		if baseURL == "" {
+			baseURL = "/media"
+		}
+		return NewLocalBlobStore(dir, baseURL)
+	}
+}
+
+// joinURL appends a key to a base URL, escaping each path segment.
+func joinURL(base string, key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.Join(segments, "/")
+}
+
+// validKey rejects keys that could escape the store's root.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return false
+	}
+	for _, s := range strings.Split(key, "/") {
+		if s == "" || s == "." || s == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -2,14 +2,24 @@ package utils
 
 import (
 	"fmt"
+	"net/url"
 	"reflect"
 	"regexp"
 	"strings"
 	"time"
 )
 
+// sensitiveFields are the keys whose values never reach the logs in clear.
+var sensitiveFields = []string{
+	"Password", "Email", "password", "email",
+	"current_password", "new_password",
+	"client_secret", "code", "code_verifier",
+	"refresh_token",
+	"mfa_token", "recovery_code",
+	"token",
+}
+
 func MaskSensitiveData(data any) any {
-	sensitiveFields := []string{"Password", "Email", "password", "email"}
 	val := reflect.ValueOf(data)
 
 	// Handle structs
@@ -61,6 +71,28 @@ func MaskSensitiveData(data any) any {
 	return data
 }
 
+// MaskValues encodes form or query values with the sensitive ones masked.
+func MaskValues(values url.Values) string {
+	masked := make(url.Values, len(values))
+	for key, vals := range values {
+		if contains(sensitiveFields, key) {
+			vals = []string{maskString(strings.Join(vals, ","))}
+		}
+		masked[key] = vals
+	}
+	return masked.Encode()
+}
+
+// MaskQuery is MaskValues for a raw query string. A query that does not
+// parse is dropped rather than logged as is.
+func MaskQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return ""
+	}
+	return MaskValues(values)
+}
+
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
 		if s == item {